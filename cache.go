@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kennygrant/coronavirus/series"
+)
+
+// cacheMaxAge is the maximum age of a cached response
+// pages show some values relative to the current time, so entries expire even if the data does not change
+const cacheMaxAge = 5 * time.Minute
+
+// cacheMaxEntries limits the number of responses cached for one dataset version
+const cacheMaxEntries = 2000
+
+// responses caches rendered responses until the dataset changes
+var responses = newResponseCache()
+
+// responseCache stores rendered responses keyed on dataset version, path and normalised params
+// all entries are dropped when the dataset version changes
+type responseCache struct {
+	// Stats are updated atomically, and are first for alignment
+	hits   uint64
+	misses uint64
+
+	mutex   sync.RWMutex
+	version uint64
+	entries map[string]*cachedResponse
+}
+
+// cachedResponse stores a rendered response
+type cachedResponse struct {
+	contentType string
+	body        []byte
+	createdAt   time.Time
+}
+
+// cacheStats records the use of the response cache
+type cacheStats struct {
+	Version uint64
+	Entries int
+	Hits    uint64
+	Misses  uint64
+	HitRate float64
+}
+
+// newResponseCache returns an empty response cache
+func newResponseCache() *responseCache {
+	return &responseCache{entries: make(map[string]*cachedResponse)}
+}
+
+// get returns the response for key if cached for this dataset version and not expired
+// entries for older versions are dropped
+func (c *responseCache) get(version uint64, key string, now time.Time) *cachedResponse {
+	c.mutex.RLock()
+	current := c.version
+	entry := c.entries[key]
+	c.mutex.RUnlock()
+
+	if current != version {
+		c.mutex.Lock()
+		if c.version < version {
+			c.version = version
+			c.entries = make(map[string]*cachedResponse)
+		}
+		c.mutex.Unlock()
+		entry = nil
+	}
+
+	if entry == nil || now.Sub(entry.createdAt) > cacheMaxAge {
+		atomic.AddUint64(&c.misses, 1)
+		return nil
+	}
+
+	atomic.AddUint64(&c.hits, 1)
+	return entry
+}
+
+// set stores a response for key, unless the dataset version has changed meanwhile
+// if the cache is full the oldest entry is evicted first
+func (c *responseCache) set(version uint64, key string, entry *cachedResponse) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.version != version {
+		return
+	}
+	if len(c.entries) >= cacheMaxEntries && c.entries[key] == nil {
+		c.evictOldest()
+	}
+	c.entries[key] = entry
+}
+
+// evictOldest removes the entry created first, the mutex must be held by the caller
+func (c *responseCache) evictOldest() {
+	var oldest string
+	var oldestAt time.Time
+	for key, entry := range c.entries {
+		if oldestAt.IsZero() || entry.createdAt.Before(oldestAt) {
+			oldest, oldestAt = key, entry.createdAt
+		}
+	}
+	delete(c.entries, oldest)
+}
+
+// stats returns the current cache stats
+func (c *responseCache) stats() cacheStats {
+	c.mutex.RLock()
+	stats := cacheStats{
+		Version: c.version,
+		Entries: len(c.entries),
+	}
+	c.mutex.RUnlock()
+
+	stats.Hits = atomic.LoadUint64(&c.hits)
+	stats.Misses = atomic.LoadUint64(&c.misses)
+	if stats.Hits+stats.Misses > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(stats.Hits+stats.Misses)
+	}
+	return stats
+}
+
+// cacheKey returns a key for the request path and query params, with params sorted by name
+// empty params are ignored, and vary is added for anything else the response depends on
+func cacheKey(r *http.Request, vary string) string {
+	params := make(url.Values)
+	for name, values := range r.URL.Query() {
+		for _, v := range values {
+			v = strings.TrimSpace(v)
+			if v != "" {
+				params.Add(name, v)
+			}
+		}
+	}
+
+	// Encode sorts params by name, the order of values for a name is kept as it may matter (e.g. compare)
+	return r.URL.Path + "?" + params.Encode() + "|" + vary
+}
+
+// bufferedResponse records a response so that it may be cached
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+
+	// failed records an error status written after the first status, for example by http.Error
+	// when a template fails to render after the handler wrote a 200 status
+	failed int
+}
+
+// Header returns the header of the response being recorded
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+// Write records p in the body
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(p)
+}
+
+// WriteHeader records the status, only the first status is kept as for http.ResponseWriter
+// but a later error status is recorded in failed, so that the response is not cached
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	} else if status >= http.StatusBadRequest && b.failed == 0 {
+		b.failed = status
+	}
+}
+
+// cached wraps a handler which renders from the current dataset, caching successful responses
+// vary returns anything other than path and params which the response depends on (e.g. mobile)
+// in development the cache is only used if COVID_CACHE=on, so that template changes are seen
+func cached(h http.HandlerFunc, vary func(r *http.Request) string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !cacheEnabled || r.Method != http.MethodGet {
+			h(w, r)
+			return
+		}
+
+		v := ""
+		if vary != nil {
+			v = vary(r)
+		}
+		key := cacheKey(r, v)
+		version := series.Version()
+
+		entry := responses.get(version, key, time.Now())
+		if entry != nil {
+			w.Header().Set("Content-Type", entry.contentType)
+			w.Header().Set("X-Cache", "hit")
+			w.WriteHeader(http.StatusOK)
+			w.Write(entry.body)
+			return
+		}
+
+		// Render the response to a buffer, then cache it if it succeeded
+		// responses which wrote an error after their status are sent with the error status instead
+		buf := &bufferedResponse{header: w.Header()}
+		h(buf, r)
+		if buf.failed != 0 {
+			buf.status = buf.failed
+		}
+		if buf.status == http.StatusOK {
+			responses.set(version, key, &cachedResponse{
+				contentType: buf.header.Get("Content-Type"),
+				body:        buf.body.Bytes(),
+				createdAt:   time.Now(),
+			})
+		}
+
+		w.Header().Set("X-Cache", "miss")
+		if buf.status != 0 {
+			w.WriteHeader(buf.status)
+		}
+		w.Write(buf.body.Bytes())
+	}
+}
+
+// varyMobile returns whether the request is from a mobile device, as the home page depends on it
+func varyMobile(r *http.Request) string {
+	return fmt.Sprintf("mobile=%t", isMobile(r))
+}
+
+// handleCacheStats shows stats for the response cache
+// FIXME - require authentication for admin pages
+func handleCacheStats(w http.ResponseWriter, r *http.Request) {
+
+	log.Printf("request:%s", r.URL)
+
+	stats := responses.stats()
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(200)
+	fmt.Fprintf(w, `{"version":%d,"entries":%d,"hits":%d,"misses":%d,"hit_rate":%.3f}`, stats.Version, stats.Entries, stats.Hits, stats.Misses, stats.HitRate)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCacheKey(t *testing.T) {
+	tests := map[string]string{
+		"/uk?period=28&scale=log":          "/uk?period=28&scale=log|",
+		"/uk?scale=log&period=28":          "/uk?period=28&scale=log|",
+		"/uk?scale=log&period=28&compare=": "/uk?period=28&scale=log|",
+		"/uk?scale=+log+":                  "/uk?scale=log|",
+		"/uk?compare=italy,spain":          "/uk?compare=italy%2Cspain|",
+		"/uk?compare=b&compare=a":          "/uk?compare=b&compare=a|",
+	}
+	for target, want := range tests {
+		got := cacheKey(httptest.NewRequest(http.MethodGet, target, nil), "")
+		if got != want {
+			t.Errorf("cache: wrong key for:%s want:%s got:%s", target, want, got)
+		}
+	}
+
+	got := cacheKey(httptest.NewRequest(http.MethodGet, "/uk", nil), "mobile=true")
+	if got != "/uk?|mobile=true" {
+		t.Errorf("cache: wrong key with vary got:%s", got)
+	}
+}
+
+func TestResponseCache(t *testing.T) {
+	c := newResponseCache()
+	now := time.Now()
+
+	// Entries are found for the version they were stored with
+	if c.get(1, "a", now) != nil {
+		t.Fatalf("cache: unexpected entry in empty cache")
+	}
+	c.set(1, "a", &cachedResponse{body: []byte("a"), createdAt: now})
+	entry := c.get(1, "a", now)
+	if entry == nil || string(entry.body) != "a" {
+		t.Fatalf("cache: entry not found got:%v", entry)
+	}
+
+	// Entries expire after the max age
+	if c.get(1, "a", now.Add(cacheMaxAge+time.Second)) != nil {
+		t.Errorf("cache: entry not expired")
+	}
+
+	// A new version drops all entries, and entries for older versions are not stored
+	if c.get(2, "a", now) != nil {
+		t.Errorf("cache: entry found for new version")
+	}
+	c.set(1, "b", &cachedResponse{createdAt: now})
+	if c.get(2, "b", now) != nil || c.stats().Entries != 0 {
+		t.Errorf("cache: entry stored for old version")
+	}
+
+	stats := c.stats()
+	if stats.Version != 2 || stats.Hits != 1 || stats.Misses != 4 {
+		t.Errorf("cache: wrong stats got:%+v", stats)
+	}
+}
+
+func TestResponseCacheEvict(t *testing.T) {
+	c := newResponseCache()
+	c.get(1, "", time.Now())
+
+	// Fill the cache, the first entry is the oldest
+	start := time.Now()
+	for i := 0; i < cacheMaxEntries; i++ {
+		c.set(1, fmt.Sprintf("key-%d", i), &cachedResponse{createdAt: start.Add(time.Duration(i) * time.Millisecond)})
+	}
+
+	c.set(1, "new", &cachedResponse{createdAt: start.Add(time.Minute)})
+	if c.stats().Entries != cacheMaxEntries {
+		t.Errorf("cache: wrong entries after evict want:%d got:%d", cacheMaxEntries, c.stats().Entries)
+	}
+	if c.get(1, "key-0", start) != nil {
+		t.Errorf("cache: oldest entry not evicted")
+	}
+	if c.get(1, "key-1", start) == nil || c.get(1, "new", start) == nil {
+		t.Errorf("cache: wrong entry evicted")
+	}
+}
+
+func TestCachedError(t *testing.T) {
+	responses = newResponseCache()
+
+	// A handler which fails to render after writing its status, as the page handlers may
+	failing := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("partial"))
+		http.Error(w, "render failed", http.StatusInternalServerError)
+	}
+	h := cached(failing, nil)
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest(http.MethodGet, "/fail", nil))
+		if w.Code != http.StatusInternalServerError || w.Header().Get("X-Cache") != "miss" {
+			t.Errorf("cache: failed response wrong status:%d cache:%s", w.Code, w.Header().Get("X-Cache"))
+		}
+	}
+
+	// Successful responses are cached
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	}
+	h = cached(ok, nil)
+	for _, want := range []string{"miss", "hit"} {
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest(http.MethodGet, "/ok", nil))
+		if w.Code != http.StatusOK || w.Body.String() != "ok" || w.Header().Get("X-Cache") != want {
+			t.Errorf("cache: wrong response want:%s got:%d %s %s", want, w.Code, w.Body.String(), w.Header().Get("X-Cache"))
+		}
+	}
+}
@@ -1,15 +1,20 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"html/template"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"golang.org/x/crypto/acme/autocert"
@@ -19,25 +24,94 @@ import (
 
 var development = false
 
+// cacheEnabled controls caching of rendered pages, see cached
+var cacheEnabled = true
+
 // Store our templates globally, don't touch them after server start
 var htmlTemplate *template.Template
 var jsonTemplate *template.Template
+var lockdownHTMLTemplate *template.Template
+var lockdownJSONTemplate *template.Template
+var compareJSONTemplate *template.Template
+var qualityHTMLTemplate *template.Template
+var correctionsHTMLTemplate *template.Template
 
 // Main loads data, sets up a periodic fetch, and starts a web server to serve that data
 func main() {
 
+	// With -replay the series data is rebuilt from archived source payloads and saved, without starting the server
+	replayPath := flag.String("replay", "", "rebuild series data from data/archive and save it at this path")
+	replayBase := flag.String("replay-base", "", "series file to replay archived payloads on top of (optional)")
+	replayUntil := flag.String("replay-until", "", "replay only payloads fetched before this time, e.g. 2020-05-01T12:00:00Z (optional)")
+	flag.Parse()
+	if *replayPath != "" {
+		err := replay(*replayPath, *replayBase, *replayUntil)
+		if err != nil {
+			log.Fatalf("replay: failed:%s", err)
+		}
+		return
+	}
+
 	if os.Getenv("COVID") == "dev" {
 		development = true
 	}
 
 	if development {
 		log.Printf("server: starting in development mode")
+		cacheEnabled = os.Getenv("COVID_CACHE") == "on"
 	} else {
 		log.Printf("server: starting in production mode")
 	}
 
+	// Choose where data is stored - csv files by default, or set COVID_STORAGE to log or memory
+	backend, err := series.NewBackend(os.Getenv("COVID_STORAGE"), "./data")
+	if err != nil {
+		log.Fatalf("server: failed to set up storage:%s", err)
+	}
+	series.SetBackend(backend)
+
+	// Updates are recorded in a journal which is replayed on load and compacted into the series data
+	if os.Getenv("COVID_STORAGE") != series.BackendMemory {
+		series.SetJournal(series.NewJournal("./data/journal.csv"))
+	}
+
+	// Every payload fetched from sources is archived so that updates can be replayed, unless COVID_ARCHIVE=off
+	if os.Getenv("COVID_STORAGE") != series.BackendMemory && os.Getenv("COVID_ARCHIVE") != "off" {
+		series.SetArchive(series.NewArchive("./data/archive"))
+	}
+
+	// Choose which source is used for areas with data from several sources, changes are recorded for auditing
+	priorities, err := series.LoadPriorities("./data/priorities.csv")
+	if err != nil {
+		log.Fatalf("server: failed to load source priorities:%s", err)
+	}
+	if os.Getenv("COVID_STORAGE") != series.BackendMemory {
+		priorities.DecisionsPath = "./data/decisions.csv"
+		err = priorities.LoadDecisions(time.Now().UTC())
+		if err != nil {
+			log.Fatalf("server: failed to load source decisions:%s", err)
+		}
+	}
+	series.SetPriorities(priorities)
+
+	// Suspicious changes from sources are held in quarantine for review at /admin/quarantine
+	validator := series.NewValidator()
+	if os.Getenv("COVID_STORAGE") != series.BackendMemory {
+		validator, err = series.LoadValidator("./data/quarantine.csv")
+		if err != nil {
+			log.Fatalf("server: failed to load quarantine:%s", err)
+		}
+	}
+	series.SetValidator(validator)
+
+	// Manual corrections in data/corrections.csv override values from sources
+	err = loadCorrections()
+	if err != nil {
+		log.Fatalf("server: failed to load corrections:%s", err)
+	}
+
 	// Load our data
-	err := series.LoadData("./data")
+	err = series.LoadData("./data")
 	if err != nil {
 		log.Fatalf("server: failed to load new data:%s", err)
 	}
@@ -47,13 +121,39 @@ func main() {
 		ScheduleUpdates()
 	}
 
+	// On interrupt or termination wait for running jobs to finish before exiting
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		sig := <-signals
+		log.Printf("server: stopping on signal:%s", sig)
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		defer cancel()
+		err := scheduler.Stop(ctx)
+		if err != nil {
+			log.Printf("server: failed to stop jobs:%s", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}()
+
 	// Load our template files into memory
 	loadTemplates()
 
 	// Set up the https server with the handler attached to serve this data in a template
 	http.HandleFunc("/favicon.ico", handleFile)
-	http.HandleFunc("/", handleHome)
+	http.HandleFunc("/", cached(handleHome, varyMobile))
 	http.HandleFunc("/reload", handleReload)
+	http.HandleFunc("/compare.json", cached(handleCompare, nil))
+	http.HandleFunc("/admin/quality", handleQuality)
+	http.HandleFunc("/admin/cache", handleCacheStats)
+	http.HandleFunc("/admin/sources", handleSources)
+	http.HandleFunc("/admin/quarantine", handleQuarantine)
+	http.HandleFunc("/status/jobs", handleJobs)
+	http.HandleFunc("/lockdown", cached(handleLockdown, nil))
+	http.HandleFunc("/corrections", cached(handleCorrections, nil))
+	http.HandleFunc("/corrections.json", cached(handleCorrections, nil))
+	http.HandleFunc("/lockdown.json", cached(handleLockdown, nil))
 
 	// Start a server on port 443 (or another port if dev specified)
 	if development {
@@ -85,6 +185,26 @@ func loadTemplates() {
 	if err != nil {
 		log.Fatalf("template error:%s", err)
 	}
+	compareJSONTemplate, err = template.New("compare.json.got").Funcs(funcMap).ParseFiles("compare.json.got")
+	if err != nil {
+		log.Fatalf("template error:%s", err)
+	}
+	qualityHTMLTemplate, err = template.ParseFiles("quality.html.got")
+	if err != nil {
+		log.Fatalf("template error:%s", err)
+	}
+	correctionsHTMLTemplate, err = template.ParseFiles("corrections.html.got")
+	if err != nil {
+		log.Fatalf("template error:%s", err)
+	}
+	lockdownHTMLTemplate, err = template.ParseFiles("lockdown.html.got")
+	if err != nil {
+		log.Fatalf("template error:%s", err)
+	}
+	lockdownJSONTemplate, err = template.New("lockdown.json.got").Funcs(funcMap).ParseFiles("lockdown.json.got")
+	if err != nil {
+		log.Fatalf("template error:%s", err)
+	}
 }
 
 // handleHome shows our website
@@ -95,25 +215,35 @@ func handleHome(w http.ResponseWriter, r *http.Request) {
 	// Get the parameters from the url
 	country, province, period, startDeaths := parseParams(r)
 
+	// Use the same dataset snapshot (and its index) throughout this request
+	index := series.CurrentIndex()
+	data := index.Slice()
+
 	// Fetch the series concerned - if both are blank we'll get the global series
-	s, err := series.FetchSeries(country, province)
+	s, err := index.FetchSeries(country, province)
 	if err != nil {
 		http.NotFound(w, r)
 		return
 	}
 
+	// Get a data quality report for the whole series
+	quality := data.Quality(s, time.Now().UTC())
+
 	// Get the total counts first for the page
 	allTimeDeaths := s.TotalDeaths()
 	allTimeConfirmed := s.TotalConfirmed()
 	allTimeRecovered := s.TotalRecovered() // unreliable as yet
 	allTimeTested := s.TotalTested()
 
-	mobile := strings.Contains(strings.ToLower(r.UserAgent()), "mobile")
+	mobile := isMobile(r)
 
 	if startDeaths == 0 {
 		startDeaths = 100
 	}
 
+	// Read the alignment for the comparison chart
+	alignment := parseAlignment(r, startDeaths)
+
 	// Use a default period depending on device if none selected
 	if period == 0 {
 		// Default to last 56 days
@@ -125,38 +255,89 @@ func handleHome(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Keep the whole series for selecting comparisons, as trajectories need more days than some periods
+	full := s
+
 	// Limit by period if applied
 	if period > 0 {
 		s = s.Period(period)
 	}
 
-	var scale string
-	var scaleURL string
-	if param(r, "scale") == "linear" {
-		scale = "linear"
-		scaleURL = r.URL.Path + "?scale=log#growth"
-	} else {
-		scale = "logarithmic"
-		scaleURL = r.URL.Path + "?scale=linear#growth"
+	// Use the comparisons requested if any
+	compare := parseCompare(r)
+
+	// Or select comparisons automatically using a strategy (nearest, population, trajectory)
+	strategy := param(r, "strategy")
+	if strategy != "" && !series.ValidStrategy(strategy) {
+		http.Error(w, fmt.Sprintf("compare: invalid strategy:%s", strategy), http.StatusBadRequest)
+		return
 	}
 
+	// Record the reason each comparison was chosen (if any) by key
+	reasons := make(map[string]string)
+
+	// Record which series were requested in the url for the compare select
+	// comparisons chosen automatically are not selected, so that changing other options keeps choosing them
+	compareSelected := make(map[string]bool)
+
 	// For global compare growth rate of top 20 series
 	var comparisons series.Slice
-	if s.IsGlobal() {
-		comparisons = series.TopSeriesGlobal(country, 10)
+	if len(compare) > 0 {
+		comparisons, err = index.CompareSeries(compare)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, c := range comparisons {
+			reasons[c.CompareKey()] = "requested"
+			compareSelected[c.CompareKey()] = true
+		}
+	} else if strategy != "" && !s.IsGlobal() {
+		comparators, err := data.SimilarSeries(full, strategy, 10)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, c := range comparators {
+			reasons[c.Series.CompareKey()] = c.Reason
+		}
+		comparisons = series.Comparators(comparators)
+	} else if s.IsGlobal() {
+		comparisons = data.TopSeriesGlobal(country, 10)
 	} else if s.IsEuropean() {
-		comparisons = series.SelectedEuropeanSeries(country, 10)
+		comparisons = data.SelectedEuropeanSeries(country, 10)
 	} else if s.HasProvinces() {
 		log.Printf("home: comparing provinces for:%s", country)
-		comparisons = series.TopSeries(country, 20)
+		comparisons = data.TopSeries(country, 20)
 	} else {
 		// Else fetch a selection of copmarative series (for example nearby countries)
 		log.Printf("home: generic compare for:%s %s", country, province)
-		comparisons = series.SelectedSeries(country, 10)
+		comparisons = index.SelectedSeries(country, 10)
 	}
 
+	// Only compare series which have data for this alignment (e.g. those with a lockdown date)
+	comparisons = comparisons.Aligned(alignment)
+
 	log.Printf("comparisons:%d", len(comparisons))
 
+	// Keep the alignment and any comparisons requested when switching scale
+	comparisonQuery := alignment.Query()
+	if len(compare) > 0 {
+		comparisonQuery += "&compare=" + strings.Join(compare, ",")
+	} else if strategy != "" {
+		comparisonQuery += "&strategy=" + strategy
+	}
+
+	var scale string
+	var scaleURL string
+	if param(r, "scale") == "linear" {
+		scale = "linear"
+		scaleURL = r.URL.Path + "?scale=log&" + comparisonQuery + "#growth"
+	} else {
+		scale = "logarithmic"
+		scaleURL = r.URL.Path + "?scale=linear&" + comparisonQuery + "#growth"
+	}
+
 	// Set up context with data
 	context := map[string]interface{}{
 		"period":           strconv.Itoa(period),
@@ -169,13 +350,27 @@ func handleHome(w http.ResponseWriter, r *http.Request) {
 		"allTimeRecovered": allTimeRecovered,
 		"allTimeTested":    allTimeTested,
 		"periodOptions":    series.PeriodOptions(),
-		"countryOptions":   series.CountryOptions(),
-		"provinceOptions":  series.ProvinceOptions(s.Country),
+		"countryOptions":   data.CountryOptions(),
+		"provinceOptions":  data.ProvinceOptions(s.Country),
 		"jsonURL":          fmt.Sprintf("%s.json?period=%d", r.URL.Path, period),
 		"scale":            scale,
 		"scaleURL":         scaleURL,
 		"mobile":           mobile,
 		"startDeaths":      startDeaths, // Deaths to start comparison chart from
+		"alignment":        alignment,   // Alignment and values for comparison chart
+		"align":            alignment.AlignName(),
+		"metric":           alignment.MetricName(),
+		"values":           alignment.ValuesName(),
+		"alignOptions":     series.AlignOptions(),
+		"metricOptions":    series.MetricOptions(),
+		"valuesOptions":    series.ValuesOptions(),
+		"compareOptions":   data.CompareOptions(),
+		"compareSelected":  compareSelected,
+		"reasons":          reasons,
+		"strategy":         strategy,
+		"strategyOptions":  series.StrategyOptions(),
+		"quality":          quality,
+		"compareURL":       "/compare.json?" + alignment.Query() + "&compare=" + strings.Join(comparisons.Keys(), ","),
 	}
 
 	// If in development reload templates each time - no mutex as in dev only
@@ -202,13 +397,219 @@ func handleHome(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// handleCompare renders a comparison payload for the series given in the compare param
+// e.g. /compare.json?compare=italy,spain,us/new-york&align=lockdown
+func handleCompare(w http.ResponseWriter, r *http.Request) {
+
+	log.Printf("request:%s", r.URL)
+
+	_, _, _, startDeaths := parseParams(r)
+	if startDeaths == 0 {
+		startDeaths = 100
+	}
+	alignment := parseAlignment(r, startDeaths)
+
+	compare := parseCompare(r)
+	if len(compare) == 0 {
+		http.Error(w, "compare: no series to compare", http.StatusBadRequest)
+		return
+	}
+
+	comparisons, err := series.CurrentIndex().CompareSeries(compare)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	context := map[string]interface{}{
+		"comparisons": comparisons.Aligned(alignment),
+		"alignment":   alignment,
+		"align":       alignment.AlignName(),
+		"metric":      alignment.MetricName(),
+		"values":      alignment.ValuesName(),
+	}
+
+	// If in development reload templates each time - no mutex as in dev only
+	if development {
+		loadTemplates()
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(200)
+	err = compareJSONTemplate.Execute(w, context)
+	if err != nil {
+		log.Printf("template render error:%s", err)
+		http.Error(w, err.Error(), 500)
+	}
+}
+
+// handleQuality shows the areas with the worst data quality
+// FIXME - require authentication for admin pages
+func handleQuality(w http.ResponseWriter, r *http.Request) {
+
+	log.Printf("request:%s", r.URL)
+
+	count := 50
+	v, err := strconv.Atoi(param(r, "count"))
+	if err == nil && v > 0 {
+		count = v
+	}
+
+	context := map[string]interface{}{
+		"reports": series.WorstQuality(count),
+		"count":   count,
+	}
+
+	// If in development reload templates each time - no mutex as in dev only
+	if development {
+		loadTemplates()
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(200)
+	err = qualityHTMLTemplate.Execute(w, context)
+	if err != nil {
+		log.Printf("template render error:%s", err)
+		http.Error(w, err.Error(), 500)
+	}
+}
+
+// handleCorrections lists the manual corrections made to data from sources, as html or json
+func handleCorrections(w http.ResponseWriter, r *http.Request) {
+
+	log.Printf("request:%s", r.URL)
+
+	type correctionJSON struct {
+		AreaID int    `json:"area_id"`
+		Area   string `json:"area"`
+		Date   string `json:"date"`
+		Metric string `json:"metric"`
+		Value  int    `json:"value"`
+		Reason string `json:"reason"`
+		Author string `json:"author"`
+	}
+
+	corrections := []correctionJSON{}
+	for _, c := range series.Corrections() {
+		correction := correctionJSON{
+			AreaID: c.AreaID,
+			Date:   c.Date.Format("2006-01-02"),
+			Metric: c.MetricName(),
+			Value:  c.Value,
+			Reason: c.Reason,
+			Author: c.Author,
+		}
+		s, err := series.FindSeries(c.AreaID)
+		if err == nil {
+			correction.Area = s.Title()
+		}
+		corrections = append(corrections, correction)
+	}
+
+	if strings.HasSuffix(r.URL.Path, ".json") {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(200)
+		json.NewEncoder(w).Encode(corrections)
+		return
+	}
+
+	// If in development reload templates each time - no mutex as in dev only
+	if development {
+		loadTemplates()
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(200)
+	err := correctionsHTMLTemplate.Execute(w, map[string]interface{}{"corrections": corrections})
+	if err != nil {
+		log.Printf("template render error:%s", err)
+		http.Error(w, err.Error(), 500)
+	}
+}
+
+// loadCorrections loads manual corrections from data/corrections.csv into the default store
+func loadCorrections() error {
+	corrections, err := series.LoadCorrections("./data/corrections.csv")
+	if err != nil {
+		return err
+	}
+	series.SetCorrections(corrections)
+	return nil
+}
+
+// handleLockdown shows a table comparing growth before and after lockdown (and other interventions)
+// for all areas with intervention dates recorded
+func handleLockdown(w http.ResponseWriter, r *http.Request) {
+
+	log.Printf("request:%s", r.URL)
+
+	// Compare deaths by default, or confirmed cases if requested
+	metric := "deaths"
+	dataKind := series.DataDeaths
+	lag := 14
+	if param(r, "metric") == "confirmed" {
+		metric = "confirmed"
+		dataKind = series.DataConfirmed
+		lag = 7
+	}
+
+	// Window is the number of days to measure growth over before and after
+	window := 7
+	v, err := strconv.Atoi(param(r, "window"))
+	if err == nil && v > 0 {
+		window = v
+	}
+
+	// Lag is the number of days after the intervention before we expect to see an effect
+	v, err = strconv.Atoi(param(r, "lag"))
+	if err == nil && v >= 0 {
+		lag = v
+	}
+
+	effects := series.LockdownEffects(dataKind, window, lag)
+
+	context := map[string]interface{}{
+		"effects": effects,
+		"metric":  metric,
+		"window":  window,
+		"lag":     lag,
+		"jsonURL": fmt.Sprintf("/lockdown.json?metric=%s&window=%d&lag=%d", metric, window, lag),
+	}
+
+	// If in development reload templates each time - no mutex as in dev only
+	if development {
+		loadTemplates()
+	}
+
+	// Render the template, either html or json
+	if strings.HasSuffix(r.URL.Path, ".json") {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(200)
+		err = lockdownJSONTemplate.Execute(w, context)
+	} else {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(200)
+		err = lockdownHTMLTemplate.Execute(w, context)
+	}
+
+	// Check for errors on render
+	if err != nil {
+		log.Printf("template render error:%s", err)
+		http.Error(w, err.Error(), 500)
+	}
+
+}
+
 // handleReload
 // FIXME - require authentication to avoid DOS
 func handleReload(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("reload:%s", r.URL)
 
-	err := series.LoadData("./data")
+	err := loadCorrections()
+	if err == nil {
+		err = series.LoadData("./data")
+	}
 
 	// Check for errors on reload
 	if err != nil {
@@ -218,8 +619,17 @@ func handleReload(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/", 302)
 	}
 
-	// Also reload today from online data
-	go updateFrequent()
+	// Also reload today from online data, unless an update is already running
+	if development {
+		go updateFrequent()
+	} else if !scheduler.Run("update") {
+		log.Printf("reload: update already running")
+	}
+}
+
+// isMobile returns true if the request is from a mobile device
+func isMobile(r *http.Request) bool {
+	return strings.Contains(strings.ToLower(r.UserAgent()), "mobile")
 }
 
 // param returns one param string value
@@ -295,6 +705,72 @@ func parseParams(r *http.Request) (country, province string, period, startDeaths
 	return country, province, period, startDeaths
 }
 
+// parseCompare parses the list of series to compare from the compare param
+// either as a comma separated list (compare=italy,spain,us/new-york) or repeated params
+func parseCompare(r *http.Request) (keys []string) {
+	for _, v := range r.URL.Query()["compare"] {
+		for _, key := range strings.Split(v, ",") {
+			key = strings.Trim(strings.TrimSpace(key), "/")
+			if key == "" {
+				continue
+			}
+
+			// Allow some abreviations for urls
+			if key == "uk" || strings.HasPrefix(key, "uk/") {
+				key = "united-kingdom" + strings.TrimPrefix(key, "uk")
+			}
+
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// parseAlignment parses the alignment for comparison charts from the query params
+// align may be deaths, confirmed, percapita, lockdown or date
+// start sets the threshold to align on (start_deaths is accepted for deaths) and start_date the date
+// metric may be deaths or confirmed and values may be cumulative or daily
+func parseAlignment(r *http.Request, startDeaths int) series.Alignment {
+	alignment := series.DefaultAlignment()
+	alignment.Threshold = float64(startDeaths)
+
+	switch param(r, "align") {
+	case "confirmed":
+		alignment.Align = series.AlignConfirmed
+		alignment.Threshold = 1000
+	case "percapita":
+		alignment.Align = series.AlignPerCapita
+		alignment.Threshold = 1
+	case "lockdown":
+		alignment.Align = series.AlignLockdown
+	case "date":
+		alignment.Align = series.AlignDate
+		alignment.Date = time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	// Read the threshold if any
+	threshold, err := strconv.ParseFloat(param(r, "start"), 64)
+	if err == nil && threshold > 0 {
+		alignment.Threshold = threshold
+	}
+
+	// Read the start date if any
+	date, err := time.Parse("2006-01-02", param(r, "start_date"))
+	if err == nil {
+		alignment.Date = date
+	}
+
+	if param(r, "metric") == "confirmed" {
+		alignment.Metric = series.DataConfirmed
+	}
+
+	if param(r, "values") == "daily" {
+		alignment.Daily = true
+	}
+
+	return alignment
+}
+
 // handleFile shows a file (if it exists)
 func handleFile(w http.ResponseWriter, r *http.Request) {
 
@@ -0,0 +1,226 @@
+package series
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Alignment kinds for comparison charts - the day on which each series starts
+const (
+	AlignDeaths    = iota // first day deaths reached Threshold
+	AlignConfirmed        // first day confirmed reached Threshold
+	AlignPerCapita        // first day Metric per million reached Threshold
+	AlignLockdown         // day of lockdown (series without a lockdown are omitted)
+	AlignDate             // calendar date Date
+)
+
+// Alignment describes how series in a comparison chart are aligned and which values are shown
+type Alignment struct {
+	// Align is one of the Align constants above
+	Align int
+
+	// Threshold is the count (or count per million for AlignPerCapita) to align on
+	Threshold float64
+
+	// Date is the calendar date to align on for AlignDate
+	Date time.Time
+
+	// Metric is the data kind to show (DataDeaths or DataConfirmed)
+	Metric int
+
+	// Daily shows daily values smoothed over 7 days rather than cumulative totals
+	Daily bool
+}
+
+// DefaultAlignment returns the default alignment - cumulative deaths from death 100
+func DefaultAlignment() Alignment {
+	return Alignment{
+		Align:     AlignDeaths,
+		Threshold: 100,
+		Metric:    DataDeaths,
+	}
+}
+
+// MetricName returns a name for the metric shown
+func (a Alignment) MetricName() string {
+	if a.Metric == DataConfirmed {
+		return "confirmed"
+	}
+	return "deaths"
+}
+
+// AlignName returns a short name for the alignment suitable for urls
+func (a Alignment) AlignName() string {
+	switch a.Align {
+	case AlignConfirmed:
+		return "confirmed"
+	case AlignPerCapita:
+		return "percapita"
+	case AlignLockdown:
+		return "lockdown"
+	case AlignDate:
+		return "date"
+	}
+	return "deaths"
+}
+
+// ValuesName returns a short name for the values shown suitable for urls
+func (a Alignment) ValuesName() string {
+	if a.Daily {
+		return "daily"
+	}
+	return "cumulative"
+}
+
+// Query returns url query parameters representing this alignment
+func (a Alignment) Query() string {
+	values := url.Values{}
+	values.Set("align", a.AlignName())
+	if a.Align == AlignDate {
+		values.Set("start_date", a.Date.Format("2006-01-02"))
+	} else if a.Align != AlignLockdown {
+		values.Set("start", fmt.Sprintf("%g", a.Threshold))
+	}
+	values.Set("metric", a.MetricName())
+	values.Set("values", a.ValuesName())
+	return values.Encode()
+}
+
+// Description returns a description of this alignment for display
+func (a Alignment) Description() string {
+	values := fmt.Sprintf("Growth in %s", a.MetricName())
+	if a.Daily {
+		values = fmt.Sprintf("Daily %s (7 day average)", a.MetricName())
+	}
+
+	switch a.Align {
+	case AlignConfirmed:
+		return fmt.Sprintf("%s from day of confirmed case %.0f", values, a.Threshold)
+	case AlignPerCapita:
+		return fmt.Sprintf("%s from day %s reached %g per million", values, a.MetricName(), a.Threshold)
+	case AlignLockdown:
+		return fmt.Sprintf("%s from day of lockdown", values)
+	case AlignDate:
+		return fmt.Sprintf("%s from %s", values, a.Date.Format("2 Jan"))
+	}
+	return fmt.Sprintf("%s from day of death %.0f", values, a.Threshold)
+}
+
+// AlignIndex returns the index of the first day in this series which satisfies the alignment
+// -1 is returned if no day matches
+func (d *Data) AlignIndex(a Alignment) int {
+	switch a.Align {
+	case AlignLockdown:
+		if !d.HasLockdownAt() {
+			return -1
+		}
+		return d.DayIndex(d.LockdownAt)
+	case AlignDate:
+		return d.DayIndex(a.Date)
+	case AlignPerCapita:
+		if d.Population == 0 {
+			return -1
+		}
+	}
+
+	var values []int
+	switch a.Align {
+	case AlignDeaths:
+		values = d.Deaths()
+	case AlignConfirmed:
+		values = d.Confirmed()
+	case AlignPerCapita:
+		values = d.Values(a.Metric)
+	}
+
+	for i, v := range values {
+		switch a.Align {
+		case AlignDeaths, AlignConfirmed:
+			if float64(v) >= a.Threshold {
+				return i
+			}
+		case AlignPerCapita:
+			if float64(v)*1000000/float64(d.Population) >= a.Threshold {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
+
+// AlignedValues returns values for the alignment metric, starting from the aligned day
+// nil is returned if this series never reaches the alignment start
+// cumulative values are shared with the series and must not be modified
+func (d *Data) AlignedValues(a Alignment) []int {
+	i := d.AlignIndex(a)
+	if i < 0 {
+		return nil
+	}
+
+	if a.Daily {
+		return d.SmoothedDaily(a.Metric, 7)[i:]
+	}
+
+	values := d.Values(a.Metric)
+	return values[i:len(values):len(values)]
+}
+
+// SmoothedDaily returns daily values for dataKind averaged over the previous n days
+// (or fewer at the start of the series)
+func (d *Data) SmoothedDaily(dataKind, n int) []int {
+	totals := d.Values(dataKind)
+	values := make([]int, len(totals))
+	for i := range totals {
+		start := i - n
+		if start < 0 {
+			start = -1
+		}
+		from := d.PreviousDay().Value(dataKind)
+		if start >= 0 {
+			from = totals[start]
+		}
+		values[i] = (totals[i] - from) / (i - start)
+	}
+	return values
+}
+
+// AlignedLabels returns labels for the comparison chart x axis using the longest aligned series
+// labels are dates for calendar alignment and day counts otherwise
+func (slice Slice) AlignedLabels(a Alignment) []string {
+	var longest *Data
+	count := 0
+	for _, s := range slice {
+		values := s.AlignedValues(a)
+		if len(values) > count {
+			count = len(values)
+			longest = s
+		}
+	}
+
+	if longest == nil {
+		return nil
+	}
+
+	// For date alignment use dates from the longest series, else count days from the start
+	labels := make([]string, 0, count)
+	if a.Align == AlignDate {
+		for i := longest.AlignIndex(a); i < longest.Count(); i++ {
+			labels = append(labels, longest.Date(i).Format("Jan 2"))
+		}
+		return labels
+	}
+
+	return longest.DaysFrom(make([]int, count))
+}
+
+// Aligned returns only those series in the slice which have values for this alignment
+func (slice Slice) Aligned(a Alignment) (aligned Slice) {
+	for _, s := range slice {
+		if s.AlignIndex(a) >= 0 {
+			aligned = append(aligned, s)
+		}
+	}
+	return aligned
+}
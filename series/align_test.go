@@ -0,0 +1,78 @@
+package series
+
+import (
+	"testing"
+)
+
+// testAlignData returns a series with deaths rising by 10 a day and confirmed by 100 a day
+func testAlignData() *Data {
+	d := &Data{Country: "Testland", Population: 1000000, LockdownAt: seriesStartDate.AddDate(0, 0, 5)}
+	d.AddDays(20)
+	for i := 0; i < d.Count(); i++ {
+		d.SetValue(i, DataDeaths, i*10)
+		d.SetValue(i, DataConfirmed, i*100)
+	}
+	return d
+}
+
+func TestAlignedValues(t *testing.T) {
+	d := testAlignData()
+
+	tests := []struct {
+		alignment Alignment
+		first     int
+		count     int
+	}{
+		{Alignment{Align: AlignDeaths, Threshold: 100, Metric: DataDeaths}, 100, 10},
+		{Alignment{Align: AlignConfirmed, Threshold: 1500, Metric: DataConfirmed}, 1500, 5},
+		{Alignment{Align: AlignPerCapita, Threshold: 150, Metric: DataDeaths}, 150, 5},
+		{Alignment{Align: AlignLockdown, Metric: DataDeaths}, 50, 15},
+		{Alignment{Align: AlignDate, Date: seriesStartDate.AddDate(0, 0, 2), Metric: DataConfirmed}, 200, 18},
+		{Alignment{Align: AlignDeaths, Threshold: 100, Metric: DataDeaths, Daily: true}, 10, 10},
+	}
+
+	for _, test := range tests {
+		values := d.AlignedValues(test.alignment)
+		if len(values) != test.count {
+			t.Errorf("align: %s wrong count want:%d got:%d", test.alignment.Description(), test.count, len(values))
+			continue
+		}
+		if values[0] != test.first {
+			t.Errorf("align: %s wrong first value want:%d got:%d", test.alignment.Description(), test.first, values[0])
+		}
+		// The last day should always be included
+		if !test.alignment.Daily && values[len(values)-1] != d.LastDay().Value(test.alignment.Metric) {
+			t.Errorf("align: %s last day missing", test.alignment.Description())
+		}
+	}
+
+	// Series which never reach the threshold have no values
+	if d.AlignedValues(Alignment{Align: AlignDeaths, Threshold: 1000}) != nil {
+		t.Errorf("align: expected no values above threshold")
+	}
+}
+
+func TestAlignedLabels(t *testing.T) {
+	a := testAlignData()
+	b := testAlignData()
+	b.LockdownAt = seriesStartDate.AddDate(0, 0, 10)
+	c := &Data{Country: "Nolockdown"}
+	c.AddDays(20)
+	slice := Slice{a, b, c}
+
+	alignment := Alignment{Align: AlignLockdown, Metric: DataDeaths}
+	if len(slice.Aligned(alignment)) != 2 {
+		t.Fatalf("align: wrong aligned count want:%d got:%d", 2, len(slice.Aligned(alignment)))
+	}
+
+	labels := slice.AlignedLabels(alignment)
+	if len(labels) != 15 || labels[0] != "Day 1" {
+		t.Errorf("align: wrong labels got:%v", labels)
+	}
+
+	alignment = Alignment{Align: AlignDate, Date: seriesStartDate.AddDate(0, 0, 18), Metric: DataDeaths}
+	labels = slice.AlignedLabels(alignment)
+	if len(labels) != 2 || labels[0] != "Feb 9" {
+		t.Errorf("align: wrong date labels got:%v", labels)
+	}
+}
@@ -0,0 +1,274 @@
+package series
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// archiveHeader is the header row of the archive index
+const archiveHeader = "fetched_at,source,sha256,size,url,etag,last_modified"
+
+// ArchiveEntry records one payload fetched from a source
+type ArchiveEntry struct {
+	FetchedAt time.Time
+	Source    string
+	Sum       string // hex sha256 of the payload, which is also the name of the file storing it
+	Size      int
+
+	// Metadata from the fetch (may be blank for sources which don't use http)
+	URL          string
+	ETag         string
+	LastModified string
+}
+
+// Archive stores every payload fetched from sources, so that updates can be replayed without network access
+// payloads are stored by the sha256 of their content in objects, so unchanged payloads are stored once,
+// and index.csv records every fetch in the order made
+type Archive struct {
+	Path string
+
+	mutex sync.Mutex
+}
+
+// NewArchive returns an archive stored in the directory at p
+func NewArchive(p string) *Archive {
+	return &Archive{Path: p}
+}
+
+// indexPath returns the path of the archive index
+func (a *Archive) indexPath() string {
+	return filepath.Join(a.Path, "index.csv")
+}
+
+// objectPath returns the path of the payload with the hex sha256 sum given
+func (a *Archive) objectPath(sum string) string {
+	return filepath.Join(a.Path, "objects", sum[:2], sum)
+}
+
+// Add stores data fetched from a source, and records the fetch with entry in the index
+// the sum and size of entry are set from data
+func (a *Archive) Add(entry ArchiveEntry, data []byte) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	sum := sha256.Sum256(data)
+	entry.Sum = hex.EncodeToString(sum[:])
+	entry.Size = len(data)
+
+	p := a.objectPath(entry.Sum)
+	_, err := os.Stat(p)
+	if os.IsNotExist(err) {
+		err = os.MkdirAll(filepath.Dir(p), 0755)
+		if err != nil {
+			return fmt.Errorf("series: failed to create archive dir:%s", err)
+		}
+		err = writeFileAtomic(p, data)
+	}
+	if err != nil {
+		return fmt.Errorf("series: failed to archive payload:%s", err)
+	}
+
+	// Metadata may contain commas (e.g. Last-Modified), so rows are written as csv
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{
+		entry.FetchedAt.UTC().Format(time.RFC3339),
+		entry.Source,
+		entry.Sum,
+		strconv.Itoa(entry.Size),
+		entry.URL,
+		entry.ETag,
+		entry.LastModified,
+	})
+	w.Flush()
+
+	err = appendFile(a.indexPath(), archiveHeader+"\n", buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("series: failed to append to archive index:%s", err)
+	}
+	return nil
+}
+
+// Entries returns every entry in the archive index, ordered by the time fetched
+func (a *Archive) Entries() ([]ArchiveEntry, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	data, err := os.ReadFile(a.indexPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = 7
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("series: failed to read archive index:%s", err)
+	}
+
+	var entries []ArchiveEntry
+	for i, row := range rows {
+		if i == 0 {
+			continue
+		}
+		fetched, err := time.Parse(time.RFC3339, row[0])
+		if err != nil {
+			return nil, fmt.Errorf("series: invalid row in archive index:%v error:%s", row, err)
+		}
+		size, err := strconv.Atoi(row[3])
+		if err != nil || len(row[2]) != sha256.Size*2 {
+			return nil, fmt.Errorf("series: invalid row in archive index:%v", row)
+		}
+		entries = append(entries, ArchiveEntry{
+			FetchedAt:    fetched,
+			Source:       row[1],
+			Sum:          row[2],
+			Size:         size,
+			URL:          row[4],
+			ETag:         row[5],
+			LastModified: row[6],
+		})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].FetchedAt.Before(entries[j].FetchedAt)
+	})
+	return entries, nil
+}
+
+// Read returns the payload for entry, verifying it against the sum recorded
+func (a *Archive) Read(entry ArchiveEntry) ([]byte, error) {
+	data, err := os.ReadFile(a.objectPath(entry.Sum))
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != entry.Sum {
+		return nil, fmt.Errorf("series: checksum mismatch for archived payload:%s", entry.Sum)
+	}
+	return data, nil
+}
+
+// SetArchive sets the archive used by the default store, see Store.SetArchive
+func SetArchive(a *Archive) {
+	defaultStore.SetArchive(a)
+}
+
+// SetArchive sets an archive to store every payload fetched by UpdateFromSource
+func (s *Store) SetArchive(a *Archive) {
+	s.updateMutex.Lock()
+	defer s.updateMutex.Unlock()
+	s.archive = a
+}
+
+// archivePayload stores data fetched from source in the store archive (if any)
+// failures are logged only, as the archive is not required for updates
+func (s *Store) archivePayload(source Source, fetchedAt time.Time, data []byte) {
+	s.updateMutex.Lock()
+	a := s.archive
+	s.updateMutex.Unlock()
+	if a == nil {
+		return
+	}
+
+	entry := ArchiveEntry{FetchedAt: fetchedAt, Source: source.Name()}
+	v := fetches.validatorsFor(source.Name())
+	entry.URL, entry.ETag, entry.LastModified = v.url, v.etag, v.lastModified
+
+	err := a.Add(entry, data)
+	if err != nil {
+		log.Printf("series: failed to archive payload from source:%s error:%s", source.Name(), err)
+	}
+}
+
+// Replay rebuilds the dataset from the areas in the store backend and payloads in archive fetched before until
+// payloads are applied in the order fetched with the source of the same name, as they were when fetched,
+// starting from the series data in base if given, or no data if not
+// sources not given and payloads which fail to parse are skipped, and logged
+// values which fail validation are not applied, and not quarantined again
+func (s *Store) Replay(a *Archive, sources []Source, base string, until time.Time) error {
+	entries, err := a.Entries()
+	if err != nil {
+		return err
+	}
+
+	bySource := make(map[string]Source)
+	for _, source := range sources {
+		bySource[source.Name()] = source
+	}
+
+	backend := s.storage()
+
+	s.updateMutex.Lock()
+	defer s.updateMutex.Unlock()
+
+	working, err := backend.LoadAreas()
+	if err != nil {
+		return err
+	}
+
+	if base != "" {
+		_, err = working.loadFile(base)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Sources are resolved as they were when fetched, without recording decisions again
+	var priorities *Priorities
+	if s.priorities != nil {
+		priorities = s.priorities.replayCopy()
+	}
+
+	var replayed int
+	for _, entry := range entries {
+		if !until.IsZero() && !entry.FetchedAt.Before(until) {
+			break
+		}
+		source, ok := bySource[entry.Source]
+		if !ok {
+			log.Printf("series: replay skipping payload for unknown source:%s", entry.Source)
+			continue
+		}
+		data, err := a.Read(entry)
+		if err != nil {
+			log.Printf("series: replay failed to read payload:%s error:%s", entry.Sum, err)
+			continue
+		}
+		observations, err := source.Parse(data)
+		if err != nil {
+			log.Printf("series: replay failed to parse payload:%s from source:%s error:%s", entry.Sum, entry.Source, err)
+			continue
+		}
+
+		// Observations for the latest day are for the day fetched, so add days up to then first
+		working.addDaysTo(entry.FetchedAt)
+		observations = priorities.resolve(working.Index(), entry.Source, observations, entry.FetchedAt)
+		working.applyObservations(observations, s.validator.checker(entry.Source, entry.FetchedAt, nil))
+		replayed++
+	}
+
+	log.Printf("series: replayed %d of %d archived payloads", replayed, len(entries))
+
+	err = working.calculateGlobalSeriesData()
+	if err != nil {
+		return err
+	}
+	working.applyCorrections(s.corrections)
+
+	sort.Stable(working)
+	s.publish(working)
+	return nil
+}
@@ -0,0 +1,103 @@
+package series
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// replaySource parses payloads of country,deaths rows into observations for the latest day
+type replaySource struct{}
+
+func (replaySource) Name() string            { return "replay" }
+func (replaySource) Schedule() time.Duration { return time.Hour }
+func (replaySource) Priority() int           { return 1 }
+func (replaySource) Fetch() ([]byte, error)  { return nil, ErrNotModified }
+func (replaySource) Parse(data []byte) ([]Observation, error) {
+	var observations []Observation
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		cols := strings.Split(line, ",")
+		deaths, err := strconv.Atoi(cols[1])
+		if err != nil {
+			return nil, err
+		}
+		observations = append(observations, Observation{Country: cols[0], DataKind: DataDeaths, Value: deaths})
+	}
+	return observations, nil
+}
+
+func TestArchive(t *testing.T) {
+	a := NewArchive(t.TempDir())
+	day1 := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+	day2 := day1.AddDate(0, 0, 1)
+
+	payloads := []struct {
+		at   time.Time
+		data string
+	}{
+		{day2, "Albania,20\nAlgeria,7"},
+		{day1, "Albania,10\n"},
+		{day1.Add(time.Hour), "Albania,10\n"},
+		{day2.Add(time.Hour), "Albania,broken"},
+	}
+	for _, p := range payloads {
+		err := a.Add(ArchiveEntry{Source: "replay", FetchedAt: p.at, LastModified: "Fri, 01 May 2020 12:00:00 GMT"}, []byte(p.data))
+		if err != nil {
+			t.Fatalf("archive: failed to add:%s", err)
+		}
+	}
+
+	// Entries are ordered by time fetched, and identical payloads stored once
+	entries, err := a.Entries()
+	if err != nil || len(entries) != 4 {
+		t.Fatalf("archive: wrong entries got:%v %v", entries, err)
+	}
+	if !entries[0].FetchedAt.Equal(day1) || entries[0].Sum != entries[1].Sum || entries[0].LastModified != "Fri, 01 May 2020 12:00:00 GMT" {
+		t.Errorf("archive: wrong entry got:%v", entries[0])
+	}
+	data, err := a.Read(entries[2])
+	if err != nil || string(data) != payloads[0].data {
+		t.Errorf("archive: wrong payload got:%q %v", data, err)
+	}
+
+	// Replay applies payloads for the latest day on the day fetched, skipping those which fail to parse
+	dir := testBinaryDir(t)
+	store := NewStore()
+	store.SetBackend(NewCSVBackend(dir))
+	err = store.Replay(a, []Source{replaySource{}}, "", time.Time{})
+	if err != nil {
+		t.Fatalf("archive: failed to replay:%s", err)
+	}
+	albania, err := store.FetchSeries("Albania", "")
+	if err != nil {
+		t.Fatalf("archive: series not found:%s", err)
+	}
+	if albania.Count() != albania.DayIndex(time.Date(2020, 5, 2, 0, 0, 0, 0, time.UTC))+1 {
+		t.Errorf("archive: wrong days got:%d", albania.Count())
+	}
+	if albania.PenultimateDay().Deaths != 10 || albania.LastDay().Deaths != 20 {
+		t.Errorf("archive: wrong replayed values got:%v %v", albania.PenultimateDay(), albania.LastDay())
+	}
+
+	// Replay stops at until
+	err = store.Replay(a, []Source{replaySource{}}, "", day2)
+	if err != nil {
+		t.Fatalf("archive: failed to replay:%s", err)
+	}
+	albania, _ = store.FetchSeries("Albania", "")
+	if albania.LastDay().Deaths != 10 || !albania.LastDay().Date.Equal(time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("archive: wrong values with until got:%v", albania.LastDay())
+	}
+
+	// Corrupt payloads are not read
+	err = os.WriteFile(a.objectPath(entries[0].Sum), []byte("Albania,99\n"), 0644)
+	if err != nil {
+		t.Fatalf("archive: failed to corrupt payload:%s", err)
+	}
+	_, err = a.Read(entries[0])
+	if err == nil {
+		t.Errorf("archive: expected error for corrupt payload")
+	}
+}
@@ -0,0 +1,148 @@
+package series
+
+import (
+	"fmt"
+	"time"
+)
+
+// Storage backends available with NewBackend
+const (
+	BackendCSV    = "csv"    // series.csv rewritten on each save (the default)
+	BackendLog    = "log"    // series.log with changes appended on each save
+	BackendMemory = "memory" // in memory only, nothing is written to disk
+)
+
+// Backend stores areas and series data for a Store
+type Backend interface {
+	// LoadAreas returns a new series for each area with interventions but no days
+	LoadAreas() (Slice, error)
+
+	// LoadSeries loads all stored days into the series in slice
+	LoadSeries(slice Slice) error
+
+	// SaveSeries stores all days for the series in slice
+	SaveSeries(slice Slice) error
+
+	// AppendDay stores the last day for the series in slice
+	AppendDay(slice Slice) error
+
+	// Revisions returns the values stored over time for an area, oldest first
+	Revisions(areaID int) ([]Revision, error)
+}
+
+// Revision records the values stored for an area on one day
+type Revision struct {
+	AreaID       int
+	Day          int // day number, 1 is seriesStartDate
+	Deaths       int
+	Confirmed    int
+	Recovered    int
+	Tested       int
+	Hospitalised int
+
+	// StoredAt is the time these values were stored (if known)
+	StoredAt time.Time
+}
+
+// Date returns the date of the day this revision is for
+func (r Revision) Date() time.Time {
+	return seriesStartDate.AddDate(0, 0, r.Day-1)
+}
+
+// sameValues returns true if the values for r and o are the same
+func (r Revision) sameValues(o Revision) bool {
+	return r.Deaths == o.Deaths && r.Confirmed == o.Confirmed && r.Recovered == o.Recovered && r.Tested == o.Tested && r.Hospitalised == o.Hospitalised
+}
+
+// NewBackend returns a backend of the kind given storing data in dataPath
+// kind is one of the Backend constants, if blank the csv backend is used
+func NewBackend(kind, dataPath string) (Backend, error) {
+	switch kind {
+	case BackendCSV, "":
+		return NewCSVBackend(dataPath), nil
+	case BackendLog:
+		return NewLogBackend(dataPath), nil
+	case BackendMemory:
+		// Start with a copy of the data on disk, but never write it back
+		areas, err := NewCSVBackend(dataPath).LoadAreas()
+		if err != nil {
+			return nil, err
+		}
+		err = NewCSVBackend(dataPath).LoadSeries(areas)
+		if err != nil {
+			return nil, err
+		}
+		b := NewMemoryBackend(areas)
+		return b, b.SaveSeries(areas)
+	}
+	return nil, fmt.Errorf("series: invalid storage backend:%s", kind)
+}
+
+// revisionKey identifies the revisions for one area and day
+type revisionKey struct {
+	AreaID int
+	Day    int
+}
+
+// changedRevisions returns revisions for days in the series in slice (starting at index from)
+// which differ from the last values stored, updating last with the new values
+// days with all zero data are only included if they previously had data
+// where series share an id only the first is included, as only the first is found on load
+func changedRevisions(slice Slice, from int, last map[revisionKey]Revision, now time.Time) (revisions []Revision) {
+	index := slice.Index()
+	for _, s := range slice {
+		if index.byID[s.ID] != s {
+			continue
+		}
+		for i := from; i < s.Count(); i++ {
+			d := s.Day(i)
+			r := Revision{
+				AreaID:       s.ID,
+				Day:          i + 1,
+				Deaths:       d.Deaths,
+				Confirmed:    d.Confirmed,
+				Recovered:    d.Recovered,
+				Tested:       d.Tested,
+				Hospitalised: d.Hospitalised,
+				StoredAt:     now,
+			}
+			key := revisionKey{r.AreaID, r.Day}
+			previous, ok := last[key]
+			if (ok && previous.sameValues(r)) || (!ok && d.IsZero()) {
+				continue
+			}
+			last[key] = r
+			revisions = append(revisions, r)
+		}
+	}
+	return revisions
+}
+
+// applyRevisions sets data on the series in slice from revisions in the order stored
+// so that later revisions replace earlier ones - days are added to cover every revision
+func (slice Slice) applyRevisions(revisions []Revision) {
+	days := int(time.Now().UTC().Sub(seriesStartDate).Hours() / 24)
+	if len(revisions) > 0 {
+		days = 0
+		for _, r := range revisions {
+			if r.Day > days {
+				days = r.Day
+			}
+		}
+	}
+
+	for _, s := range slice {
+		if s.Count() < days {
+			s.AddDays(days - s.Count())
+		}
+	}
+
+	index := slice.Index()
+	for _, r := range revisions {
+		s, err := index.FindSeries(r.AreaID)
+		if err != nil {
+			continue
+		}
+		s.SetDayData(r.Day, r.Deaths, r.Confirmed, r.Recovered, r.Tested, r.Hospitalised)
+	}
+}
@@ -0,0 +1,312 @@
+package series
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// CSVBackend stores series data in series.csv in the data directory
+// on save only rows for areas and days which changed since the last save are rewritten, see SaveSeries
+// a binary snapshot of the same data is kept in series.bin and loaded in preference when valid
+// areas are read from areas.csv and interventions.csv in the same directory
+type CSVBackend struct {
+	Path string
+
+	// savedSum is the sha256 of series.csv when last loaded or saved by this backend
+	savedSum [sha256.Size]byte
+
+	// last stores the values in series.csv for each area and day when last loaded or saved,
+	// nil if not known, so that saves only patch rows which changed - saves are serialised by the store
+	last map[revisionKey]Revision
+}
+
+// NewCSVBackend returns a csv backend for data files in dataPath
+func NewCSVBackend(dataPath string) *CSVBackend {
+	return &CSVBackend{Path: filepath.Clean(dataPath)}
+}
+
+// seriesPath returns the path of the series file
+func (b *CSVBackend) seriesPath() string {
+	return filepath.Join(b.Path, "series.csv")
+}
+
+// binaryPath returns the path of the binary snapshot of the series file
+func (b *CSVBackend) binaryPath() string {
+	return filepath.Join(b.Path, "series.bin")
+}
+
+// LoadAreas loads areas from areas.csv and any interventions from interventions.csv
+func (b *CSVBackend) LoadAreas() (Slice, error) {
+	areaPath := filepath.Join(b.Path, "areas.csv")
+	slice, err := Slice{}.loadAreas(areaPath)
+	if err != nil {
+		return nil, fmt.Errorf("data: error loading areas:%s data:%s", areaPath, err)
+	}
+
+	// Load any interventions recorded in addition to lockdown dates - this file is optional
+	interventionsPath := filepath.Join(b.Path, "interventions.csv")
+	err = slice.loadInterventions(interventionsPath)
+	if err != nil {
+		return nil, fmt.Errorf("data: error loading interventions:%s data:%s", interventionsPath, err)
+	}
+
+	return slice, nil
+}
+
+// LoadSeries loads series.bin into the series in slice if it matches series.csv, else loads series.csv
+// after loading series.csv the snapshot is rewritten so that the next load is faster
+func (b *CSVBackend) LoadSeries(slice Slice) error {
+	b.last = nil
+
+	err := slice.loadBinary(b.binaryPath(), b.seriesPath())
+	if err == nil {
+		log.Printf("series: loaded binary snapshot:%s", b.binaryPath())
+		b.savedSum, _ = fileSum(b.seriesPath())
+		b.setSaved(slice)
+		return nil
+	}
+	log.Printf("series: binary snapshot not used:%s", err)
+
+	data, err := slice.loadFile(b.seriesPath())
+	if err != nil {
+		return err
+	}
+
+	// Only write a snapshot if the data loaded is that in series.csv, not a backup
+	sum, err := fileSum(b.seriesPath())
+	if err == nil && sum == sha256.Sum256(data) {
+		b.writeBinary(slice, data)
+		b.savedSum = sum
+		b.setSaved(slice)
+	}
+
+	return nil
+}
+
+// setSaved records the values in slice as those in series.csv
+func (b *CSVBackend) setSaved(slice Slice) {
+	b.last = make(map[revisionKey]Revision)
+	changedRevisions(slice, 0, b.last, time.Time{})
+}
+
+// SaveSeries saves all series in slice to series.csv and series.bin
+// if series.csv is unchanged since this backend last loaded or saved it,
+// only rows for areas and days with values changed since then are written, other rows are kept as they are
+// slice is not modified, so it may be a published snapshot
+func (b *CSVBackend) SaveSeries(slice Slice) error {
+	if len(slice) == 0 {
+		return fmt.Errorf("series: save on empty data set")
+	}
+
+	data, err := b.seriesCSV(slice)
+	if err != nil {
+		b.last = nil
+		return err
+	}
+
+	err = saveFile(b.seriesPath(), data)
+	if err != nil {
+		// We don't know what was written, so write all rows on the next save
+		b.last = nil
+		return fmt.Errorf("series: failed to write series file:%s", err)
+	}
+
+	b.writeBinary(slice, data)
+	b.savedSum = sha256.Sum256(data)
+	return nil
+}
+
+// seriesCSV returns the csv data to save for slice, patching rows in the current file
+// for values which have changed if possible, otherwise all rows are formatted
+// the values saved are recorded in last
+func (b *CSVBackend) seriesCSV(slice Slice) ([]byte, error) {
+	// The file may have been edited or replaced since we saved it, or be in the format used
+	// before hospitalised was added, if so write it all
+	current, err := readFileVerified(b.seriesPath())
+	if b.last == nil || err != nil || sha256.Sum256(current) != b.savedSum || !bytes.HasPrefix(current, []byte(seriesCSVHeader)) {
+		data, err := slice.seriesCSV()
+		if err == nil {
+			b.setSaved(slice)
+		}
+		return data, err
+	}
+
+	revisions := changedRevisions(slice, 0, b.last, time.Time{})
+	if len(revisions) == 0 {
+		return current, nil
+	}
+
+	log.Printf("series: saving %d changed rows", len(revisions))
+	return patchSeriesRows(current, revisions), nil
+}
+
+// patchSeriesRows returns csv data with the rows for revisions replaced, added or removed (if zero)
+// rows are ordered by day then area id, so rows before the first day changed are copied as they are
+func patchSeriesRows(data []byte, revisions []Revision) []byte {
+	sort.Slice(revisions, func(i, j int) bool {
+		if revisions[i].Day != revisions[j].Day {
+			return revisions[i].Day < revisions[j].Day
+		}
+		return revisions[i].AreaID < revisions[j].AreaID
+	})
+
+	start := dayOffset(data, revisions[0].Day)
+	var buf bytes.Buffer
+	buf.Grow(len(data) + len(revisions)*32)
+	buf.Write(data[:start])
+
+	// Merge the remaining rows with the revisions, both in order
+	writeRevision := func(r Revision) {
+		if r.Deaths+r.Confirmed+r.Recovered+r.Tested+r.Hospitalised != 0 {
+			fmt.Fprintf(&buf, "%d,%d,%d,%d,%d,%d,%d\n", r.Day, r.AreaID, r.Deaths, r.Confirmed, r.Recovered, r.Tested, r.Hospitalised)
+		}
+	}
+	var i int
+	rows := data[start:]
+	for len(rows) > 0 {
+		end := bytes.IndexByte(rows, '\n') + 1
+		if end == 0 {
+			end = len(rows)
+		}
+		row := rows[:end]
+		rows = rows[end:]
+
+		day, area := rowKey(row)
+		for i < len(revisions) && (revisions[i].Day < day || (revisions[i].Day == day && revisions[i].AreaID < area)) {
+			writeRevision(revisions[i])
+			i++
+		}
+		if i < len(revisions) && revisions[i].Day == day && revisions[i].AreaID == area {
+			writeRevision(revisions[i])
+			i++
+			continue
+		}
+		buf.Write(row)
+	}
+	for ; i < len(revisions); i++ {
+		writeRevision(revisions[i])
+	}
+
+	return buf.Bytes()
+}
+
+// rowKey returns the day number and area id at the start of a row in our csv format, or 0 if invalid
+func rowKey(row []byte) (int, int) {
+	fields := bytes.SplitN(row, []byte(","), 3)
+	if len(fields) < 3 {
+		return 0, 0
+	}
+	day, err := strconv.Atoi(string(fields[0]))
+	if err != nil {
+		return 0, 0
+	}
+	area, err := strconv.Atoi(string(fields[1]))
+	if err != nil {
+		return 0, 0
+	}
+	return day, area
+}
+
+// dayOffset returns the offset in csv data of the first row with a day number of day or later
+// rows are ordered by day so the data is scanned backwards from the end
+func dayOffset(data []byte, day int) int {
+	end := len(data)
+	for end > 0 {
+		start := bytes.LastIndexByte(data[:end-1], '\n') + 1
+		if start == 0 {
+			// This is the header row
+			return end
+		}
+		comma := bytes.IndexByte(data[start:end], ',')
+		if comma > 0 {
+			n, err := strconv.Atoi(string(data[start : start+comma]))
+			if err == nil && n < day {
+				return end
+			}
+		}
+		end = start
+	}
+	return 0
+}
+
+// writeBinary writes a binary snapshot of slice which was saved as csvData
+// failures are logged only, as the snapshot is not required
+func (b *CSVBackend) writeBinary(slice Slice, csvData []byte) {
+	err := writeFileAtomic(b.binaryPath(), slice.encodeBinary(sha256.Sum256(csvData)))
+	if err != nil {
+		log.Printf("series: failed to write binary snapshot:%s", err)
+	}
+}
+
+// AppendDay saves the series in slice - as rows are ordered by day the new day is at the end of the file
+// so usually only rows for the new day and the day before are written, see SaveSeries
+func (b *CSVBackend) AppendDay(slice Slice) error {
+	return b.SaveSeries(slice)
+}
+
+// Revisions returns the values for an area which changed between backups of series.csv
+// and the current file, so at most BackupCount+1 revisions are returned for each day
+func (b *CSVBackend) Revisions(areaID int) ([]Revision, error) {
+	var revisions []Revision
+	last := make(map[revisionKey]Revision)
+
+	// Read the oldest backup first and the current file last
+	var paths []string
+	for i := BackupCount; i > 0; i-- {
+		paths = append(paths, backupPath(b.seriesPath(), i))
+	}
+	paths = append(paths, b.seriesPath())
+
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		data, err := readFileVerified(p)
+		if err != nil {
+			return nil, err
+		}
+
+		rows, err := parseSeriesRows(data)
+		if err != nil {
+			return nil, fmt.Errorf("series: failed to read revisions from file:%s error:%s", p, err)
+		}
+
+		for _, values := range rows {
+			if values[1] != areaID {
+				continue
+			}
+			r := Revision{
+				AreaID:       values[1],
+				Day:          values[0],
+				Deaths:       values[2],
+				Confirmed:    values[3],
+				Recovered:    values[4],
+				Tested:       values[5],
+				Hospitalised: values[6],
+				StoredAt:     info.ModTime().UTC(),
+			}
+			key := revisionKey{r.AreaID, r.Day}
+			previous, ok := last[key]
+			if ok && previous.sameValues(r) {
+				continue
+			}
+			last[key] = r
+			revisions = append(revisions, r)
+		}
+	}
+
+	sort.SliceStable(revisions, func(i, j int) bool {
+		return revisions[i].Day < revisions[j].Day
+	})
+
+	return revisions, nil
+}
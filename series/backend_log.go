@@ -0,0 +1,215 @@
+package series
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logHeader is the header row of the series log
+const logHeader = "stored_at,day,area_id,deaths,confirmed,recovered,tested,hospitalised"
+
+// logHeaderTested is the header row of logs written before hospitalised was added
+// rows are appended with the hospitalised column, so rows of either length are read from these logs
+const logHeaderTested = "stored_at,day,area_id,deaths,confirmed,recovered,tested"
+
+// LogBackend stores series data in series.log in the data directory
+// each save appends a row for each area and day which changed, so the file is never rewritten
+// and every revision is kept - on load rows are replayed in order so the latest values win
+// areas are read from csv files as for CSVBackend
+type LogBackend struct {
+	*CSVBackend
+
+	mutex sync.Mutex
+
+	// last stores the last values written for each area and day
+	last map[revisionKey]Revision
+}
+
+// NewLogBackend returns a log backend for data files in dataPath
+func NewLogBackend(dataPath string) *LogBackend {
+	return &LogBackend{CSVBackend: NewCSVBackend(dataPath)}
+}
+
+// logPath returns the path of the series log
+func (b *LogBackend) logPath() string {
+	return filepath.Join(b.Path, "series.log")
+}
+
+// LoadSeries replays series.log into the series in slice
+// if there is no log yet series.csv is loaded instead, and is copied to the log on the next save
+func (b *LogBackend) LoadSeries(slice Slice) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	_, err := os.Stat(b.logPath())
+	if os.IsNotExist(err) {
+		log.Printf("series: no log at path:%s loading csv", b.logPath())
+		b.last = make(map[revisionKey]Revision)
+		return b.CSVBackend.LoadSeries(slice)
+	}
+
+	revisions, err := b.readLog()
+	if err != nil {
+		return err
+	}
+
+	slice.applyRevisions(revisions)
+	return nil
+}
+
+// SaveSeries appends rows for every area and day in slice which changed since the last save
+func (b *LogBackend) SaveSeries(slice Slice) error {
+	return b.save(slice, 0)
+}
+
+// AppendDay appends rows for the last day in slice where it changed since the last save
+func (b *LogBackend) AppendDay(slice Slice) error {
+	if len(slice) == 0 {
+		return fmt.Errorf("series: save on empty data set")
+	}
+	return b.save(slice, slice[0].Count()-1)
+}
+
+// save appends changed revisions for days from index from onwards to the log
+func (b *LogBackend) save(slice Slice, from int) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	// If we haven't loaded the log, read it so that we only append changes
+	if b.last == nil {
+		revisions, err := b.readLog()
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		b.last = make(map[revisionKey]Revision)
+		for _, r := range revisions {
+			b.last[revisionKey{r.AreaID, r.Day}] = r
+		}
+	}
+
+	revisions := changedRevisions(slice, from, b.last, time.Now().UTC())
+	if len(revisions) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	for _, r := range revisions {
+		fmt.Fprintf(&buf, "%s,%d,%d,%d,%d,%d,%d,%d\n", r.StoredAt.Format(time.RFC3339), r.Day, r.AreaID, r.Deaths, r.Confirmed, r.Recovered, r.Tested, r.Hospitalised)
+	}
+
+	err := appendFile(b.logPath(), logHeader+"\n", buf.Bytes())
+	if err != nil {
+		// We don't know what was written, so read the log again on the next save
+		b.last = nil
+		return fmt.Errorf("series: failed to append to log:%s", err)
+	}
+
+	return nil
+}
+
+// Revisions returns all rows in the log for an area, ordered by day
+func (b *LogBackend) Revisions(areaID int) ([]Revision, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	all, err := b.readLog()
+	if err != nil {
+		return nil, err
+	}
+
+	var revisions []Revision
+	for _, r := range all {
+		if r.AreaID == areaID {
+			revisions = append(revisions, r)
+		}
+	}
+
+	sort.SliceStable(revisions, func(i, j int) bool {
+		return revisions[i].Day < revisions[j].Day
+	})
+
+	return revisions, nil
+}
+
+// readLog reads all rows from the log in the order written
+// an incomplete last row (for example after a crash while appending) is ignored
+func (b *LogBackend) readLog() ([]Revision, error) {
+	f, err := os.Open(b.logPath())
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var revisions []Revision
+	reader := bufio.NewReader(f)
+	for i := 0; ; i++ {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if line != "" {
+				log.Printf("series: ignoring incomplete row in log:%s row:%s", b.logPath(), line)
+			}
+			break
+		}
+		line = strings.TrimSpace(line)
+
+		// Validate header row
+		if i == 0 {
+			if line != logHeader && line != logHeaderTested {
+				return nil, fmt.Errorf("series: invalid header row in log:%s row:%s", b.logPath(), line)
+			}
+			continue
+		}
+
+		r, err := parseLogRow(line)
+		if err != nil {
+			return nil, fmt.Errorf("series: invalid row in log:%s row:%s error:%s", b.logPath(), line, err)
+		}
+		revisions = append(revisions, r)
+	}
+
+	return revisions, nil
+}
+
+// parseLogRow parses a row of the log, hospitalised is 0 for rows written without it
+func parseLogRow(line string) (Revision, error) {
+	cols := strings.Split(line, ",")
+	if len(cols) != 7 && len(cols) != 8 {
+		return Revision{}, fmt.Errorf("invalid row len")
+	}
+
+	storedAt, err := time.Parse(time.RFC3339, cols[0])
+	if err != nil {
+		return Revision{}, err
+	}
+
+	var values [7]int
+	for i, col := range cols[1:] {
+		values[i], err = strconv.Atoi(col)
+		if err != nil {
+			return Revision{}, err
+		}
+	}
+	if values[0] < 1 {
+		return Revision{}, fmt.Errorf("invalid day")
+	}
+
+	return Revision{
+		Day:          values[0],
+		AreaID:       values[1],
+		Deaths:       values[2],
+		Confirmed:    values[3],
+		Recovered:    values[4],
+		Tested:       values[5],
+		Hospitalised: values[6],
+		StoredAt:     storedAt,
+	}, nil
+}
@@ -0,0 +1,99 @@
+package series
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryBackend stores series data in memory only, it is used in tests
+// and to run a server without writing to the data directory
+type MemoryBackend struct {
+	mutex sync.Mutex
+
+	// areas stores the areas returned by LoadAreas, without days
+	areas Slice
+
+	// revisions stores every revision saved in the order saved
+	revisions []Revision
+
+	// last stores the last values saved for each area and day
+	last map[revisionKey]Revision
+}
+
+// NewMemoryBackend returns a memory backend with the areas given
+// any days in areas are ignored - use SaveSeries to store series data
+func NewMemoryBackend(areas Slice) *MemoryBackend {
+	b := &MemoryBackend{
+		last: make(map[revisionKey]Revision),
+	}
+	for _, s := range areas {
+		area := s.Copy()
+		area.clearDays()
+		b.areas = append(b.areas, area)
+	}
+	return b
+}
+
+// LoadAreas returns a copy of the areas stored
+func (b *MemoryBackend) LoadAreas() (Slice, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if len(b.areas) == 0 {
+		return nil, fmt.Errorf("series: no areas in memory backend")
+	}
+
+	return b.areas.Copy(), nil
+}
+
+// LoadSeries applies all revisions saved to the series in slice
+func (b *MemoryBackend) LoadSeries(slice Slice) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	slice.applyRevisions(b.revisions)
+	return nil
+}
+
+// SaveSeries stores revisions for every area and day in slice which changed since the last save
+func (b *MemoryBackend) SaveSeries(slice Slice) error {
+	return b.save(slice, 0)
+}
+
+// AppendDay stores revisions for the last day in slice where it changed since the last save
+func (b *MemoryBackend) AppendDay(slice Slice) error {
+	if len(slice) == 0 {
+		return fmt.Errorf("series: save on empty data set")
+	}
+	return b.save(slice, slice[0].Count()-1)
+}
+
+// save stores changed revisions for days from index from onwards
+func (b *MemoryBackend) save(slice Slice, from int) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.revisions = append(b.revisions, changedRevisions(slice, from, b.last, time.Now().UTC())...)
+	return nil
+}
+
+// Revisions returns all revisions saved for an area, ordered by day
+func (b *MemoryBackend) Revisions(areaID int) ([]Revision, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	var revisions []Revision
+	for _, r := range b.revisions {
+		if r.AreaID == areaID {
+			revisions = append(revisions, r)
+		}
+	}
+
+	sort.SliceStable(revisions, func(i, j int) bool {
+		return revisions[i].Day < revisions[j].Day
+	})
+
+	return revisions, nil
+}
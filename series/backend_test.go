@@ -0,0 +1,270 @@
+package series
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testBackendAreas returns two areas without days
+func testBackendAreas() Slice {
+	return Slice{{ID: 1}, {ID: 2, Country: "Testland"}}
+}
+
+// TestBackends saves, revises and reloads data with each backend
+func TestBackends(t *testing.T) {
+	dir := t.TempDir()
+	areas := "country,province,area_id,lat,lng,population,lockdown,colour\n,,1,0,0,0,,\nTestland,,2,0,0,0,,\n"
+	err := os.WriteFile(filepath.Join(dir, "areas.csv"), []byte(areas), 0644)
+	if err != nil {
+		t.Fatalf("backend: failed to write areas:%s", err)
+	}
+
+	backends := map[string]Backend{
+		BackendCSV:    NewCSVBackend(dir),
+		BackendLog:    NewLogBackend(dir),
+		BackendMemory: NewMemoryBackend(testBackendAreas()),
+	}
+
+	for name, b := range backends {
+		slice, err := b.LoadAreas()
+		if err != nil || len(slice) != 2 {
+			t.Fatalf("%s: failed to load areas:%v %s", name, slice, err)
+		}
+
+		for _, s := range slice {
+			s.AddDays(3)
+		}
+		testland := slice[1]
+		testland.SetValue(1, DataDeaths, 1)
+		testland.SetValue(2, DataDeaths, 2)
+		err = b.SaveSeries(slice)
+		if err != nil {
+			t.Fatalf("%s: failed to save:%s", name, err)
+		}
+
+		// Revise a day and append a new one
+		testland.SetValue(1, DataDeaths, 3)
+		err = b.SaveSeries(slice)
+		if err != nil {
+			t.Fatalf("%s: failed to save:%s", name, err)
+		}
+		for _, s := range slice {
+			s.AddDays(1)
+		}
+		testland.SetValue(testland.Count()-1, DataDeaths, 4)
+		err = b.AppendDay(slice)
+		if err != nil {
+			t.Fatalf("%s: failed to append day:%s", name, err)
+		}
+
+		// Load into fresh areas and check we have the latest values
+		loaded, err := b.LoadAreas()
+		if err != nil {
+			t.Fatalf("%s: failed to load areas:%s", name, err)
+		}
+		err = b.LoadSeries(loaded)
+		if err != nil {
+			t.Fatalf("%s: failed to load series:%s", name, err)
+		}
+		s, err := loaded.FindSeries(2)
+		if err != nil || s.Count() != 4 {
+			t.Fatalf("%s: failed to load days:%v", name, s)
+		}
+		for i, want := range []int{0, 3, 2, 4} {
+			if s.Day(i).Deaths != want {
+				t.Errorf("%s: wrong deaths for day:%d want:%d got:%d", name, i+1, want, s.Day(i).Deaths)
+			}
+		}
+
+		// Day 2 should have been revised from 1 to 3
+		revisions, err := b.Revisions(2)
+		if err != nil {
+			t.Fatalf("%s: failed to read revisions:%s", name, err)
+		}
+		var day2 []int
+		for _, r := range revisions {
+			if r.Day == 2 {
+				day2 = append(day2, r.Deaths)
+			}
+		}
+		if len(day2) != 2 || day2[0] != 1 || day2[1] != 3 {
+			t.Errorf("%s: wrong revisions for day 2 got:%v", name, day2)
+		}
+	}
+}
+
+func TestLogBackendIncompleteRow(t *testing.T) {
+	dir := t.TempDir()
+	b := NewLogBackend(dir)
+
+	slice := testBackendAreas()
+	for _, s := range slice {
+		s.AddDays(2)
+	}
+	slice[1].SetValue(slice[1].Count()-1, DataDeaths, 5)
+	err := b.SaveSeries(slice)
+	if err != nil {
+		t.Fatalf("log: failed to save:%s", err)
+	}
+
+	// Add an incomplete row as a crash during append would
+	f, err := os.OpenFile(b.logPath(), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("log: failed to open:%s", err)
+	}
+	f.WriteString("2020-05-01T00:00:00Z,2,2,9")
+	f.Close()
+
+	// The next append should replace the incomplete row
+	slice[1].SetValue(slice[1].Count()-1, DataDeaths, 6)
+	err = NewLogBackend(dir).SaveSeries(slice)
+	if err != nil {
+		t.Fatalf("log: failed to save:%s", err)
+	}
+
+	loaded := testBackendAreas()
+	err = NewLogBackend(dir).LoadSeries(loaded)
+	if err != nil {
+		t.Fatalf("log: failed to load:%s", err)
+	}
+	if loaded[1].LastDay().Deaths != 6 {
+		t.Errorf("log: wrong deaths want:%d got:%d", 6, loaded[1].LastDay().Deaths)
+	}
+}
+
+// TestCSVBackendIncrementalSave checks saving only changed rows gives the same file as a full save
+func TestCSVBackendIncrementalSave(t *testing.T) {
+	b := NewCSVBackend(testBinaryDir(t))
+	slice := testBinaryLoad(t, b)
+
+	// Rows before the changed days are kept as they are in the file, so start from a full save
+	// (the test data has rows for a duplicate area id which a full save drops)
+	data, err := slice.seriesCSV()
+	if err != nil {
+		t.Fatalf("backend: failed to format csv:%s", err)
+	}
+	err = saveFile(b.seriesPath(), data)
+	if err != nil {
+		t.Fatalf("backend: failed to save csv:%s", err)
+	}
+	os.Remove(b.binaryPath())
+	slice = testBinaryLoad(t, b)
+	if len(changedRevisions(slice, 0, b.last, time.Time{})) != 0 {
+		t.Fatalf("backend: values unsaved after load")
+	}
+
+	// Change the first and a recent day, clear a day and add a new one
+	days := slice[0].Count()
+	slice[3].SetValue(0, DataDeaths, 54321)
+	slice[3].SetValue(days-2, DataDeaths, 12345)
+	for _, kind := range []int{DataDeaths, DataConfirmed, DataRecovered, DataTested} {
+		slice[2].SetValue(days-1, kind, 0)
+	}
+	err = slice.AddToday()
+	if err != nil {
+		t.Fatalf("backend: failed to add today:%s", err)
+	}
+	slice[0].SetValue(slice[0].Count()-1, DataConfirmed, 7)
+
+	err = b.SaveSeries(slice)
+	if err != nil {
+		t.Fatalf("backend: failed to save:%s", err)
+	}
+	saved, err := os.ReadFile(b.seriesPath())
+	if err != nil {
+		t.Fatalf("backend: failed to read saved file:%s", err)
+	}
+	want, err := slice.seriesCSV()
+	if err != nil {
+		t.Fatalf("backend: failed to format csv:%s", err)
+	}
+	if string(saved) != string(want) {
+		t.Fatalf("backend: incremental save differs from full save")
+	}
+	if len(changedRevisions(slice, 0, b.last, time.Time{})) != 0 {
+		t.Errorf("backend: values unsaved after save")
+	}
+
+	// If the file is edited by hand all rows should be written on the next save
+	err = os.WriteFile(b.seriesPath(), append(saved, []byte("1,1,1,1,0,0\n")...), 0644)
+	if err != nil {
+		t.Fatalf("backend: failed to edit csv:%s", err)
+	}
+	os.Remove(checksumPath(b.seriesPath()))
+	slice[1].SetValue(slice[1].Count()-1, DataDeaths, 3)
+	err = b.SaveSeries(slice)
+	if err != nil {
+		t.Fatalf("backend: failed to save:%s", err)
+	}
+	saved, err = os.ReadFile(b.seriesPath())
+	if err != nil {
+		t.Fatalf("backend: failed to read saved file:%s", err)
+	}
+	want, _ = slice.seriesCSV()
+	if string(saved) != string(want) {
+		t.Errorf("backend: edited file not rewritten")
+	}
+}
+
+func TestDayOffset(t *testing.T) {
+	data := []byte("day,area_id\n1,1\n1,2\n2,1\n4,1\n")
+	tests := map[int]int{1: 12, 2: 20, 3: 24, 4: 24, 5: 28}
+	for day, want := range tests {
+		got := dayOffset(data, day)
+		if got != want {
+			t.Errorf("day offset: wrong offset for day:%d want:%d got:%d", day, want, got)
+		}
+	}
+}
+
+func TestPatchSeriesRows(t *testing.T) {
+	data := []byte(seriesCSVHeader + "1,1,1,0,0,0,0\n1,3,1,0,0,0,0\n2,1,2,0,0,0,0\n2,2,1,0,0,0,0\n")
+	revisions := []Revision{
+		{Day: 3, AreaID: 1, Deaths: 3},                  // appended
+		{Day: 1, AreaID: 2, Deaths: 5},                  // inserted
+		{Day: 2, AreaID: 2},                             // removed
+		{Day: 1, AreaID: 3, Confirmed: 4},               // replaced
+		{Day: 2, AreaID: 1, Deaths: 2, Hospitalised: 1}, // replaced
+	}
+	want := seriesCSVHeader + "1,1,1,0,0,0,0\n1,2,5,0,0,0,0\n1,3,0,4,0,0,0\n2,1,2,0,0,0,1\n3,1,3,0,0,0,0\n"
+	got := string(patchSeriesRows(data, revisions))
+	if got != want {
+		t.Errorf("patch: wrong rows want:%q got:%q", want, got)
+	}
+}
+
+// TestCSVBackendTestedFormat loads a series file saved before hospitalised was added, and saves it in full
+func TestCSVBackendTestedFormat(t *testing.T) {
+	dir := t.TempDir()
+	b := NewCSVBackend(dir)
+	err := os.WriteFile(b.seriesPath(), []byte("day,area_id,deaths,confirmed,recovered,tested\n1,2,1,0,0,3\n2,2,2,0,0,4\n"), 0644)
+	if err != nil {
+		t.Fatalf("csv: failed to write series:%s", err)
+	}
+
+	slice := testBackendAreas()
+	err = b.LoadSeries(slice)
+	if err != nil {
+		t.Fatalf("csv: failed to load series:%s", err)
+	}
+	s := slice[1]
+	if s.Count() != 2 || s.Day(1).Tested != 4 || s.Day(1).Hospitalised != 0 {
+		t.Fatalf("csv: wrong values loaded:%v", s.Days())
+	}
+
+	s.SetValue(1, DataHospitalised, 5)
+	err = b.SaveSeries(slice)
+	if err != nil {
+		t.Fatalf("csv: failed to save:%s", err)
+	}
+	data, err := os.ReadFile(b.seriesPath())
+	if err != nil {
+		t.Fatalf("csv: failed to read series:%s", err)
+	}
+	want := seriesCSVHeader + "1,2,1,0,0,3,0\n2,2,2,0,0,4,5\n"
+	if string(data) != want {
+		t.Errorf("csv: wrong rows want:%q got:%q", want, data)
+	}
+}
@@ -0,0 +1,243 @@
+package series
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"sort"
+)
+
+// The binary snapshot format stores the same data as series.csv in a compact form which is fast to load
+// it is written alongside series.csv on each save, but series.csv is always the source of truth,
+// so the snapshot records a checksum of the csv it was made from and is ignored if they differ
+//
+// Format (integers are varints as written by encoding/binary):
+//
+//	magic "CVSB", version byte
+//	sha256 of series.csv (32 bytes)
+//	days, series count
+//	for each series with data: area_id, then for each metric (deaths, confirmed, recovered, tested, hospitalised)
+//	a flag byte (0 if the metric is zero on every day) followed by the change from the previous day for each day
+//	crc32 of all preceding bytes (4 bytes)
+const (
+	binaryMagic   = "CVSB"
+	binaryVersion = 2
+)
+
+// binaryMetrics are the metrics stored for each series, in order
+var binaryMetrics = []int{DataDeaths, DataConfirmed, DataRecovered, DataTested, DataHospitalised}
+
+// encodeBinary returns the series in this slice in the binary snapshot format
+// csvSum is the sha256 of the series.csv data the snapshot is made from
+func (slice Slice) encodeBinary(csvSum [sha256.Size]byte) []byte {
+	days := 0
+	if len(slice) > 0 {
+		days = slice[0].Count()
+	}
+
+	// Only series with data are stored, in id order
+	// as with FindSeries only the first series with each id is used
+	var stored Slice
+	seen := make(map[int]bool)
+	for _, s := range slice {
+		if !seen[s.ID] && s.Count() == days && !s.allZero() {
+			stored = append(stored, s)
+		}
+		seen[s.ID] = true
+	}
+	sort.Slice(stored, func(i, j int) bool {
+		return stored[i].ID < stored[j].ID
+	})
+
+	var b bytes.Buffer
+	buf := make([]byte, binary.MaxVarintLen64)
+	putUvarint := func(v int) {
+		b.Write(buf[:binary.PutUvarint(buf, uint64(v))])
+	}
+	putVarint := func(v int) {
+		b.Write(buf[:binary.PutVarint(buf, int64(v))])
+	}
+
+	b.WriteString(binaryMagic)
+	b.WriteByte(binaryVersion)
+	b.Write(csvSum[:])
+	putUvarint(days)
+	putUvarint(len(stored))
+
+	for _, s := range stored {
+		putUvarint(s.ID)
+		for _, metric := range binaryMetrics {
+			values := s.Values(metric)
+			zero := true
+			for _, v := range values {
+				if v != 0 {
+					zero = false
+					break
+				}
+			}
+			if zero {
+				b.WriteByte(0)
+				continue
+			}
+
+			b.WriteByte(1)
+			previous := 0
+			for _, v := range values {
+				putVarint(v - previous)
+				previous = v
+			}
+		}
+	}
+
+	crc := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc, crc32.ChecksumIEEE(b.Bytes()))
+	b.Write(crc)
+
+	return b.Bytes()
+}
+
+// allZero returns true if this series has no data on any day
+func (d *Data) allZero() bool {
+	for _, values := range d.values {
+		for _, v := range values {
+			if v != 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// binarySeries stores the values decoded from a binary snapshot for one series
+// values are indexed by metric position in binaryMetrics, then day (nil if all zero)
+type binarySeries struct {
+	ID     int
+	Values [metricCount][]int
+}
+
+// decodeBinary decodes a binary snapshot, checking it was made from csv data with checksum csvSum
+func decodeBinary(data []byte, csvSum [sha256.Size]byte) (days int, decoded []binarySeries, err error) {
+	header := len(binaryMagic) + 1 + sha256.Size
+	if len(data) < header+4 {
+		return 0, nil, fmt.Errorf("series: binary snapshot too short")
+	}
+
+	body, crc := data[:len(data)-4], data[len(data)-4:]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(crc) {
+		return 0, nil, fmt.Errorf("series: binary snapshot checksum mismatch")
+	}
+	if string(body[:len(binaryMagic)]) != binaryMagic || body[len(binaryMagic)] != binaryVersion {
+		return 0, nil, fmt.Errorf("series: invalid binary snapshot header")
+	}
+	if !bytes.Equal(body[len(binaryMagic)+1:header], csvSum[:]) {
+		return 0, nil, fmt.Errorf("series: binary snapshot does not match csv")
+	}
+
+	r := bytes.NewReader(body[header:])
+	readUvarint := func() int {
+		v, e := binary.ReadUvarint(r)
+		if e != nil && err == nil {
+			err = e
+		}
+		return int(v)
+	}
+
+	days = readUvarint()
+	count := readUvarint()
+	if err != nil || count > r.Len() {
+		return 0, nil, fmt.Errorf("series: invalid binary snapshot counts:%v", err)
+	}
+
+	decoded = make([]binarySeries, count)
+	for i := range decoded {
+		decoded[i].ID = readUvarint()
+		for m := range binaryMetrics {
+			flag, e := r.ReadByte()
+			if e != nil {
+				return 0, nil, fmt.Errorf("series: invalid binary snapshot:%s", e)
+			}
+			if flag == 0 {
+				continue
+			}
+
+			values := make([]int, days)
+			previous := 0
+			for d := range values {
+				delta, e := binary.ReadVarint(r)
+				if e != nil {
+					return 0, nil, fmt.Errorf("series: invalid binary snapshot:%s", e)
+				}
+				values[d] = previous + int(delta)
+				previous = values[d]
+			}
+			decoded[i].Values[m] = values
+		}
+	}
+
+	if err != nil || r.Len() > 0 {
+		return 0, nil, fmt.Errorf("series: invalid binary snapshot length:%v", err)
+	}
+
+	return days, decoded, nil
+}
+
+// loadBinary loads the binary snapshot at p into the series in this slice
+// the snapshot is only used if it was made from the current csv data at csvPath
+// the slice is only modified if the snapshot is valid
+func (slice Slice) loadBinary(p, csvPath string) error {
+	csvSum, err := fileSum(csvPath)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return err
+	}
+
+	days, decoded, err := decodeBinary(data, csvSum)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range slice {
+		s.AddDays(days - s.Count())
+	}
+
+	index := slice.Index()
+	for _, bs := range decoded {
+		s, err := index.FindSeries(bs.ID)
+		if err != nil {
+			log.Printf("series: series not found for id:%d in binary snapshot", bs.ID)
+			continue
+		}
+		for m, values := range bs.Values {
+			copy(s.Values(binaryMetrics[m]), values)
+		}
+	}
+
+	return nil
+}
+
+// fileSum returns the sha256 of the file at p, reading it in chunks
+func fileSum(p string) (sum [sha256.Size]byte, err error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return sum, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, bufio.NewReader(f))
+	if err != nil {
+		return sum, err
+	}
+	copy(sum[:], h.Sum(nil))
+	return sum, nil
+}
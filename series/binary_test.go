@@ -0,0 +1,120 @@
+package series
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testBinaryDir copies the test areas and series into a temp dir for use with a csv backend
+func testBinaryDir(t testing.TB) string {
+	dir := t.TempDir()
+	for _, name := range []string{"areas.csv", "series.csv"} {
+		err := copyFile(filepath.Join("testdata", name), filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("binary: failed to copy test data:%s", err)
+		}
+	}
+	return dir
+}
+
+// testBinaryLoad loads areas and series with the backend
+func testBinaryLoad(t testing.TB, b *CSVBackend) Slice {
+	slice, err := b.LoadAreas()
+	if err != nil {
+		t.Fatalf("binary: failed to load areas:%s", err)
+	}
+	err = b.LoadSeries(slice)
+	if err != nil {
+		t.Fatalf("binary: failed to load series:%s", err)
+	}
+	return slice
+}
+
+func TestBinarySnapshot(t *testing.T) {
+	b := NewCSVBackend(testBinaryDir(t))
+
+	// The first load is from csv, and writes the snapshot
+	fromCSV := testBinaryLoad(t, b)
+	_, err := os.Stat(b.binaryPath())
+	if err != nil {
+		t.Fatalf("binary: snapshot not written:%s", err)
+	}
+
+	// The second load should be from the snapshot, with identical data
+	fromBinary, err := b.LoadAreas()
+	if err != nil {
+		t.Fatalf("binary: failed to load areas:%s", err)
+	}
+	err = fromBinary.loadBinary(b.binaryPath(), b.seriesPath())
+	if err != nil {
+		t.Fatalf("binary: snapshot not valid:%s", err)
+	}
+	for i, s := range fromCSV {
+		if s.Count() != fromBinary[i].Count() {
+			t.Fatalf("binary: wrong days for series:%d want:%d got:%d", s.ID, s.Count(), fromBinary[i].Count())
+		}
+		for d := 0; d < s.Count(); d++ {
+			if s.Day(d) != fromBinary[i].Day(d) {
+				t.Fatalf("binary: wrong data for series:%d day:%d want:%v got:%v", s.ID, d+1, s.Day(d), fromBinary[i].Day(d))
+			}
+		}
+	}
+
+	// After series.csv is edited the snapshot should be ignored
+	data, err := os.ReadFile(b.seriesPath())
+	if err != nil {
+		t.Fatalf("binary: failed to read csv:%s", err)
+	}
+	err = os.WriteFile(b.seriesPath(), append(data, []byte("1,1,1,1,0,0\n")...), 0644)
+	if err != nil {
+		t.Fatalf("binary: failed to edit csv:%s", err)
+	}
+	os.Remove(checksumPath(b.seriesPath()))
+	err = fromBinary.loadBinary(b.binaryPath(), b.seriesPath())
+	if err == nil {
+		t.Fatalf("binary: stale snapshot loaded")
+	}
+}
+
+func BenchmarkLoadCSV(b *testing.B) {
+	backend := NewCSVBackend(testBinaryDir(b))
+	areas := testBinaryLoad(b, backend)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		slice := areas.Copy()
+		for _, s := range slice {
+			s.clearDays()
+		}
+		b.StartTimer()
+
+		err := slice.load(backend.seriesPath())
+		if err != nil {
+			b.Fatalf("load failed:%s", err)
+		}
+	}
+}
+
+func BenchmarkLoadBinary(b *testing.B) {
+	backend := NewCSVBackend(testBinaryDir(b))
+	areas := testBinaryLoad(b, backend)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		slice := areas.Copy()
+		for _, s := range slice {
+			s.clearDays()
+		}
+		b.StartTimer()
+
+		err := slice.loadBinary(backend.binaryPath(), backend.seriesPath())
+		if err != nil {
+			b.Fatalf("load failed:%s", err)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package series
+
+import (
+	"fmt"
+	"time"
+)
+
+// Series data is stored in columns - one slice of cumulative totals per data kind, indexed by day
+// so that a series needs a handful of allocations rather than one per day,
+// and accessors like Deaths can return the column itself rather than building a new slice
+// Day is kept as a view of the values for one day, see Data.Day
+
+// metricCount is the number of data kinds stored for each series (DataDeaths to DataHospitalised)
+const metricCount = DataHospitalised
+
+// columns stores cumulative totals for each data kind, the column for kind k is at k-1
+// all columns have the same length, which is the number of days in the series
+type columns [metricCount][]int
+
+// column returns the column index for dataKind, or -1 if the data kind is not stored
+func column(dataKind int) int {
+	if dataKind < DataDeaths || dataKind > DataHospitalised {
+		return -1
+	}
+	return dataKind - 1
+}
+
+// Count returns the count of days in this series
+func (d *Data) Count() int {
+	return len(d.values[0])
+}
+
+// Date returns the date of day i in this series, counting from 0
+// days are contiguous from the first date in the series
+func (d *Data) Date(i int) time.Time {
+	return d.start.AddDate(0, 0, i)
+}
+
+// Day returns a view of the data for day i in this series, counting from 0
+// changes to the day returned are not stored in the series, use SetValue or SetDayData instead
+func (d *Data) Day(i int) Day {
+	return Day{
+		Date:         d.Date(i),
+		Deaths:       d.values[0][i],
+		Confirmed:    d.values[1][i],
+		Recovered:    d.values[2][i],
+		Tested:       d.values[3][i],
+		Hospitalised: d.values[4][i],
+	}
+}
+
+// Days returns a view of the data for every day in this series, as Day was stored before series used columns
+// changes to the days returned are not stored in the series
+func (d *Data) Days() []Day {
+	days := make([]Day, d.Count())
+	for i := range days {
+		days[i] = d.Day(i)
+	}
+	return days
+}
+
+// Value returns the value for dataKind on day i in this series, counting from 0
+// 0 is returned for unknown data kinds
+func (d *Data) Value(i, dataKind int) int {
+	c := column(dataKind)
+	if c < 0 {
+		return 0
+	}
+	return d.values[c][i]
+}
+
+// SetValue sets the value for dataKind on day i in this series, counting from 0
+func (d *Data) SetValue(i, dataKind, value int) error {
+	c := column(dataKind)
+	if c < 0 {
+		return fmt.Errorf("invalid data kind:%d", dataKind)
+	}
+	if i < 0 || i >= d.Count() {
+		return fmt.Errorf("series: index out of range for set value:%d len:%d", i, d.Count())
+	}
+	d.values[c][i] = value
+	return nil
+}
+
+// Values returns the cumulative totals for dataKind on every day in this series
+// the slice returned is shared with the series and must not be modified
+func (d *Data) Values(dataKind int) []int {
+	c := column(dataKind)
+	if c < 0 {
+		return make([]int, d.Count())
+	}
+	return d.values[c]
+}
+
+// PreviousDay returns the values for the day before the first day of a Period view
+// a blank day is returned for series which are not truncated
+func (d *Data) PreviousDay() Day {
+	return Day{
+		Date:         d.start.AddDate(0, 0, -1),
+		Deaths:       d.previous[0],
+		Confirmed:    d.previous[1],
+		Recovered:    d.previous[2],
+		Tested:       d.previous[3],
+		Hospitalised: d.previous[4],
+	}
+}
+
+// setDay sets all values on day i in this series from day (save date)
+func (d *Data) setDay(i int, day Day) {
+	d.values[0][i] = day.Deaths
+	d.values[1][i] = day.Confirmed
+	d.values[2][i] = day.Recovered
+	d.values[3][i] = day.Tested
+	d.values[4][i] = day.Hospitalised
+}
+
+// appendDay adds a day with the values of day to the end of this series
+// the date of the day is ignored, as days are contiguous from the start date
+func (d *Data) appendDay(day Day) {
+	d.values[0] = append(d.values[0], day.Deaths)
+	d.values[1] = append(d.values[1], day.Confirmed)
+	d.values[2] = append(d.values[2], day.Recovered)
+	d.values[3] = append(d.values[3], day.Tested)
+	d.values[4] = append(d.values[4], day.Hospitalised)
+}
+
+// clearDays removes all days from this series
+func (d *Data) clearDays() {
+	d.values = columns{}
+	d.previous = [metricCount]int{}
+}
+
+// view returns columns for days from i to the end of the series which share storage with these columns
+// the capacity is limited so that appending to a view can never overwrite values in the original
+func (c columns) view(i int) (v columns) {
+	for k, values := range c {
+		v[k] = values[i:len(values):len(values)]
+	}
+	return v
+}
+
+// copy returns a deep copy of these columns
+func (c columns) copy() (copied columns) {
+	for k, values := range c {
+		copied[k] = append([]int(nil), values...)
+	}
+	return copied
+}
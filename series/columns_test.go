@@ -0,0 +1,63 @@
+package series
+
+import (
+	"testing"
+)
+
+func TestPeriodView(t *testing.T) {
+	d := &Data{Country: "Testland"}
+	d.AddDays(10)
+	for i := 0; i < d.Count(); i++ {
+		d.SetValue(i, DataDeaths, i*i)
+	}
+
+	p := d.Period(3)
+	if p.Count() != 3 || !p.StartsAt().Equal(d.Date(7)) || p.LastDay() != d.LastDay() {
+		t.Fatalf("period: wrong days got:%d %s", p.Count(), p.StartsAt())
+	}
+
+	// Days and the day before the period are available as views
+	days := p.Days()
+	if len(days) != 3 || days[0] != d.Day(7) || p.PreviousDay().Deaths != 36 || !p.PreviousDay().Date.Equal(d.Date(6)) {
+		t.Errorf("period: wrong days got:%v previous:%v", days, p.PreviousDay())
+	}
+
+	// Daily values on the first day use the day before the period
+	daily := p.DeathsDaily()
+	if daily[0] != 49-36 || daily[2] != 81-64 {
+		t.Errorf("period: wrong daily deaths got:%v", daily)
+	}
+
+	// The view shares data with the series
+	if &p.Deaths()[0] != &d.Deaths()[7] {
+		t.Errorf("period: data copied")
+	}
+
+	// Appending to the view must not change the series
+	p.AddToday()
+	d.AddDays(1)
+	if p.LastDay().Deaths != 81 || d.LastDay().Deaths != 0 {
+		t.Errorf("period: append changed series got:%d %d", p.LastDay().Deaths, d.LastDay().Deaths)
+	}
+}
+
+func TestAddDay(t *testing.T) {
+	d := &Data{}
+	err := d.AddDay(seriesStartDate, 1, 2, 3, 4)
+	if err != nil {
+		t.Fatalf("add day: failed:%s", err)
+	}
+	err = d.AddDay(seriesStartDate.AddDate(0, 0, 2), 1, 2, 3, 4)
+	if err == nil {
+		t.Errorf("add day: expected error for missing day")
+	}
+	err = d.AddDay(seriesStartDate.AddDate(0, 0, 1), 5, 6, 7, 8)
+	if err != nil {
+		t.Fatalf("add day: failed:%s", err)
+	}
+
+	want := Day{Date: seriesStartDate.AddDate(0, 0, 1), Deaths: 5, Confirmed: 6, Recovered: 7, Tested: 8}
+	if d.Count() != 2 || d.LastDay() != want {
+		t.Errorf("add day: wrong data want:%v got:%v", want, d.LastDay())
+	}
+}
@@ -0,0 +1,127 @@
+package series
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// correctionsHeader is the header row of the corrections file
+const correctionsHeader = "area_id,date,metric,value,reason,author"
+
+// Correction sets the value of a metric for an area on one day, overriding values from sources
+type Correction struct {
+	AreaID int
+	Date   time.Time
+	Metric int // data kind, e.g. DataDeaths
+	Value  int
+	Reason string
+	Author string
+}
+
+// MetricName returns the name of the metric corrected, e.g. deaths
+func (c Correction) MetricName() string {
+	return journalMetrics[c.Metric]
+}
+
+// LoadCorrections loads corrections from the csv file at p, with the format:
+// area_id, date, metric, value, reason, author
+// the file is optional, if missing there are no corrections
+func LoadCorrections(p string) ([]Correction, error) {
+	data, err := os.ReadFile(p)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	log.Printf("data: loading file at path:%v", p)
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = 6
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("series: failed to read corrections:%s error:%s", p, err)
+	}
+
+	var corrections []Correction
+	for i, row := range rows {
+		if i == 0 {
+			if strings.Join(row, ",") != correctionsHeader {
+				return nil, fmt.Errorf("series: invalid header row in corrections:%s row:%s", p, row)
+			}
+			continue
+		}
+
+		c := Correction{Metric: metricForName(row[2]), Reason: row[4], Author: row[5]}
+		if c.Metric == DataNone {
+			return nil, fmt.Errorf("series: invalid metric in corrections:%s row:%s", p, row)
+		}
+		c.AreaID, err = strconv.Atoi(row[0])
+		if err == nil {
+			c.Date, err = time.Parse("2006-01-02", row[1])
+		}
+		if err == nil {
+			c.Value, err = strconv.Atoi(row[3])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("series: invalid row in corrections:%s row:%s error:%s", p, row, err)
+		}
+		corrections = append(corrections, c)
+	}
+
+	return corrections, nil
+}
+
+// applyCorrections sets the values in corrections in this slice, returning the count of values changed
+// corrections for areas or days not in the slice are skipped
+func (slice Slice) applyCorrections(corrections []Correction) int {
+	if len(corrections) == 0 {
+		return 0
+	}
+
+	var changed int
+	index := slice.Index()
+	for _, c := range corrections {
+		series, err := index.FindSeries(c.AreaID)
+		if err != nil {
+			continue
+		}
+		i := series.DayIndex(c.Date)
+		if i < 0 || series.Value(i, c.Metric) == c.Value {
+			continue
+		}
+		series.SetValue(i, c.Metric, c.Value)
+		changed++
+	}
+	return changed
+}
+
+// SetCorrections sets the corrections used by the default store, see Store.SetCorrections
+func SetCorrections(corrections []Correction) {
+	defaultStore.SetCorrections(corrections)
+}
+
+// SetCorrections sets corrections which are applied after every load and update
+// this should be set before data is loaded
+func (s *Store) SetCorrections(corrections []Correction) {
+	s.updateMutex.Lock()
+	defer s.updateMutex.Unlock()
+	s.corrections = corrections
+}
+
+// Corrections returns the corrections used by the default store, see Store.Corrections
+func Corrections() []Correction {
+	return defaultStore.Corrections()
+}
+
+// Corrections returns the corrections applied by the store, in the order of the corrections file
+func (s *Store) Corrections() []Correction {
+	s.updateMutex.Lock()
+	defer s.updateMutex.Unlock()
+	return s.corrections
+}
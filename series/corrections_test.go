@@ -0,0 +1,54 @@
+package series
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCorrections(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "corrections.csv")
+	data := correctionsHeader + "\n" +
+		"1,2020-01-23,deaths,7,\"Fix deaths, reported late\",tester\n" +
+		"2,2020-01-23,deaths,1,Unknown area,tester\n"
+	err := os.WriteFile(p, []byte(data), 0644)
+	if err != nil {
+		t.Fatalf("corrections: failed to write file:%s", err)
+	}
+	corrections, err := LoadCorrections(p)
+	if err != nil || len(corrections) != 2 {
+		t.Fatalf("corrections: failed to load got:%v %v", corrections, err)
+	}
+	if corrections[0].Reason != "Fix deaths, reported late" || corrections[0].MetricName() != "deaths" || corrections[0].Value != 7 {
+		t.Errorf("corrections: wrong correction got:%v", corrections[0])
+	}
+
+	store := NewStore()
+	store.SetCorrections(corrections)
+	store.publish(Slice{{ID: 1, Country: "Testland"}})
+
+	// Corrections override values set by updates
+	err = store.UpdateFrom("test", func(slice Slice) error {
+		slice[0].AddDays(3)
+		slice[0].SetValue(1, DataDeaths, 3)
+		slice[0].SetValue(2, DataDeaths, 9)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("corrections: failed to update:%s", err)
+	}
+	s := store.Current()[0]
+	if s.Day(1).Deaths != 7 || s.Day(2).Deaths != 9 {
+		t.Errorf("corrections: wrong values got:%v %v", s.Day(1), s.Day(2))
+	}
+
+	// Invalid metrics are rejected
+	err = os.WriteFile(p, []byte(correctionsHeader+"\n1,2020-01-23,cases,7,,\n"), 0644)
+	if err != nil {
+		t.Fatalf("corrections: failed to write file:%s", err)
+	}
+	_, err = LoadCorrections(p)
+	if err == nil {
+		t.Errorf("corrections: expected error for invalid metric")
+	}
+}
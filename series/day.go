@@ -7,34 +7,56 @@ import (
 
 // Day represents data for a day in a series
 // Totals are cumulative deaths etc, not single day counts
+// series store data in columns, so a Day is a copy of the values for one day, see Data.Day
 type Day struct {
 	Date      time.Time
 	Deaths    int
 	Confirmed int
 	Recovered int
 	Tested    int
+
+	// Hospitalised is the cumulative total of patients admitted to hospital
+	Hospitalised int
 }
 
 // IsZero returns true if this day has all zero data (and thus doesn't need to be recorded)
-func (d *Day) IsZero() bool {
-	return d.Deaths+d.Confirmed+d.Recovered+d.Tested == 0
+func (d Day) IsZero() bool {
+	return d.Deaths+d.Confirmed+d.Recovered+d.Tested+d.Hospitalised == 0
 }
 
 // String returns a string representation of this Day
-func (d *Day) String() string {
-	return fmt.Sprintf("%s %d-%d-%d-%d", d.DateMachine(), d.Deaths, d.Confirmed, d.Recovered, d.Tested)
+func (d Day) String() string {
+	return fmt.Sprintf("%s %d-%d-%d-%d-%d", d.DateMachine(), d.Deaths, d.Confirmed, d.Recovered, d.Tested, d.Hospitalised)
 }
 
 // DateMachine returns a string for machines
-func (d *Day) DateMachine() string {
+func (d Day) DateMachine() string {
 	return d.Date.Format("2006-01-02")
 }
 
 // DateDisplay returns a string for humans
-func (d *Day) DateDisplay() string {
+func (d Day) DateDisplay() string {
 	return d.Date.Format("2 Jan, 2006")
 }
 
+// Value returns the value on this day for the given data kind
+// 0 is returned for unknown data kinds
+func (d Day) Value(dataKind int) int {
+	switch dataKind {
+	case DataDeaths:
+		return d.Deaths
+	case DataConfirmed:
+		return d.Confirmed
+	case DataRecovered:
+		return d.Recovered
+	case DataTested:
+		return d.Tested
+	case DataHospitalised:
+		return d.Hospitalised
+	}
+	return 0
+}
+
 // SetData sets data to this day for the given data kind
 // the data replaces existing data
 func (d *Day) SetData(dataKind, value int) error {
@@ -47,6 +69,8 @@ func (d *Day) SetData(dataKind, value int) error {
 		d.Recovered = value
 	case DataTested:
 		d.Tested = value
+	case DataHospitalised:
+		d.Hospitalised = value
 	default:
 		return fmt.Errorf("invalid data kind:%d", dataKind)
 	}
@@ -74,6 +98,8 @@ func (d *Day) MergeData(dataKind, value int) error {
 		d.Recovered += value
 	case DataTested:
 		d.Tested += value
+	case DataHospitalised:
+		d.Hospitalised += value
 	default:
 		return fmt.Errorf("invalid data kind:%d", dataKind)
 	}
@@ -83,7 +109,7 @@ func (d *Day) MergeData(dataKind, value int) error {
 
 // MergeDay adds all the data from given day to the this day
 // the data is combined with existing data with +=
-func (d *Day) MergeDay(day *Day) error {
+func (d *Day) MergeDay(day Day) error {
 	if !d.Date.Equal(day.Date) {
 		return fmt.Errorf("series: mismatch on date:%s inday:%s", d.Date, day.Date)
 	}
@@ -91,6 +117,7 @@ func (d *Day) MergeDay(day *Day) error {
 	d.Confirmed += day.Confirmed
 	d.Recovered += day.Recovered
 	d.Tested += day.Tested
+	d.Hospitalised += day.Hospitalised
 
 	return nil
 }
@@ -0,0 +1,219 @@
+package series
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrNotModified is returned by Source.Fetch if the data has not changed since the last fetch
+var ErrNotModified = errors.New("series: not modified")
+
+// Defaults for fetches from sources
+const (
+	fetchTimeout    = 30 * time.Second
+	fetchRetries    = 3
+	fetchBackoff    = 2 * time.Second
+	fetchMaxBackoff = time.Minute
+	fetchMaxSize    = 64 << 20 // 64MB
+)
+
+// FetchStats records fetches for a source
+type FetchStats struct {
+	Requests    int
+	Retries     int
+	NotModified int
+	Failures    int
+	Bytes       int64
+
+	LastStatus   int
+	LastDuration time.Duration
+	LastFetch    time.Time
+}
+
+// fetchValidators stores the validators from the last response for a url, used for conditional requests
+type fetchValidators struct {
+	url          string
+	etag         string
+	lastModified string
+}
+
+// fetcher fetches urls for sources with timeouts, retries and conditional requests
+// validators and stats are stored per source name
+type fetcher struct {
+	client     *http.Client
+	retries    int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	maxSize    int64
+
+	// sleep is used to wait between retries, replaced in tests
+	sleep func(time.Duration)
+
+	mutex      sync.Mutex
+	validators map[string]fetchValidators
+	stats      map[string]*FetchStats
+}
+
+// fetches is the fetcher used by sources
+var fetches = newFetcher()
+
+// newFetcher returns a fetcher with default settings
+func newFetcher() *fetcher {
+	return &fetcher{
+		client:     &http.Client{Timeout: fetchTimeout},
+		retries:    fetchRetries,
+		backoff:    fetchBackoff,
+		maxBackoff: fetchMaxBackoff,
+		maxSize:    fetchMaxSize,
+		sleep:      time.Sleep,
+		validators: make(map[string]fetchValidators),
+		stats:      make(map[string]*FetchStats),
+	}
+}
+
+// fetch fetches url for the named source, returning ErrNotModified if unchanged since the last fetch
+// failed requests are retried with exponential backoff if the failure may be temporary
+func (f *fetcher) fetch(name, url string) ([]byte, error) {
+	start := time.Now()
+	var data []byte
+	var status int
+	var err error
+	for attempt := 0; attempt <= f.retries; attempt++ {
+		if attempt > 0 {
+			f.record(name, func(s *FetchStats) { s.Retries++ })
+			f.sleep(f.backoffFor(attempt))
+		}
+
+		var retry bool
+		data, status, retry, err = f.fetchOnce(name, url)
+		if err == nil || !retry {
+			break
+		}
+		log.Printf("fetch: %s attempt:%d failed:%s", name, attempt+1, err)
+	}
+
+	f.record(name, func(s *FetchStats) {
+		s.Requests++
+		s.LastStatus = status
+		s.LastDuration = time.Since(start)
+		s.LastFetch = start.UTC()
+		s.Bytes += int64(len(data))
+		if err == ErrNotModified {
+			s.NotModified++
+		} else if err != nil {
+			s.Failures++
+		}
+	})
+
+	return data, err
+}
+
+// fetchOnce makes one request for url, returning the status and whether a failure may be retried
+func (f *fetcher) fetchOnce(name, url string) ([]byte, int, bool, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	f.mutex.Lock()
+	v, ok := f.validators[name]
+	f.mutex.Unlock()
+	if ok && v.url == url {
+		if v.etag != "" {
+			req.Header.Set("If-None-Match", v.etag)
+		}
+		if v.lastModified != "" {
+			req.Header.Set("If-Modified-Since", v.lastModified)
+		}
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		// Network errors and timeouts may be temporary
+		return nil, 0, true, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		return nil, resp.StatusCode, false, ErrNotModified
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return nil, resp.StatusCode, true, fmt.Errorf("unexpected status:%d for url:%s", resp.StatusCode, url)
+	case resp.StatusCode != http.StatusOK:
+		return nil, resp.StatusCode, false, fmt.Errorf("unexpected status:%d for url:%s", resp.StatusCode, url)
+	}
+
+	// Read one byte more than the limit so that we know if it was exceeded
+	data, err := io.ReadAll(io.LimitReader(resp.Body, f.maxSize+1))
+	if err != nil {
+		return nil, resp.StatusCode, true, err
+	}
+	if int64(len(data)) > f.maxSize {
+		return nil, resp.StatusCode, false, fmt.Errorf("response too large for url:%s limit:%d", url, f.maxSize)
+	}
+
+	f.mutex.Lock()
+	f.validators[name] = fetchValidators{
+		url:          url,
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+	}
+	f.mutex.Unlock()
+
+	return data, resp.StatusCode, false, nil
+}
+
+// validatorsFor returns the url and validators from the last successful fetch for the named source
+func (f *fetcher) validatorsFor(name string) fetchValidators {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.validators[name]
+}
+
+// backoffFor returns the time to wait before retry attempt, doubling for each attempt up to maxBackoff
+func (f *fetcher) backoffFor(attempt int) time.Duration {
+	d := f.backoff
+	for i := 1; i < attempt && d < f.maxBackoff; i++ {
+		d *= 2
+	}
+	if d > f.maxBackoff {
+		d = f.maxBackoff
+	}
+	return d
+}
+
+// forget removes the validators for the named source, so that the next fetch is not conditional
+// this should be called if data fetched could not be used
+func (f *fetcher) forget(name string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	delete(f.validators, name)
+}
+
+// record updates the stats for the named source with update
+func (f *fetcher) record(name string, update func(*FetchStats)) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	s, ok := f.stats[name]
+	if !ok {
+		s = &FetchStats{}
+		f.stats[name] = s
+	}
+	update(s)
+}
+
+// statsFor returns the stats for the named source
+func (f *fetcher) statsFor(name string) FetchStats {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	s, ok := f.stats[name]
+	if !ok {
+		return FetchStats{}
+	}
+	return *s
+}
@@ -0,0 +1,124 @@
+package series
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testFetcher returns a fetcher which does not wait between retries, recording the waits
+func testFetcher(waits *[]time.Duration) *fetcher {
+	f := newFetcher()
+	f.sleep = func(d time.Duration) { *waits = append(*waits, d) }
+	return f
+}
+
+func TestFetchConditional(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("data"))
+	}))
+	defer server.Close()
+
+	var waits []time.Duration
+	f := testFetcher(&waits)
+	data, err := f.fetch("test", server.URL)
+	if err != nil || string(data) != "data" {
+		t.Fatalf("fetch: failed got:%q %v", data, err)
+	}
+
+	// The second fetch should be conditional, and the data not modified
+	_, err = f.fetch("test", server.URL)
+	if err != ErrNotModified {
+		t.Fatalf("fetch: expected not modified got:%v", err)
+	}
+
+	// After forget the data should be fetched again
+	f.forget("test")
+	data, err = f.fetch("test", server.URL)
+	if err != nil || string(data) != "data" {
+		t.Fatalf("fetch: failed after forget got:%q %v", data, err)
+	}
+
+	stats := f.statsFor("test")
+	if stats.Requests != 3 || stats.NotModified != 1 || stats.Bytes != 8 || stats.LastStatus != http.StatusOK {
+		t.Errorf("fetch: wrong stats got:%+v", stats)
+	}
+}
+
+func TestFetchRetries(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch {
+		case r.URL.Path == "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case r.URL.Path == "/large":
+			w.Write([]byte(strings.Repeat("x", 11)))
+		case requests < 3:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.Write([]byte("data"))
+		}
+	}))
+	defer server.Close()
+
+	// Server errors are retried with exponential backoff
+	var waits []time.Duration
+	f := testFetcher(&waits)
+	f.backoff = time.Second
+	data, err := f.fetch("test", server.URL)
+	if err != nil || string(data) != "data" {
+		t.Fatalf("fetch: failed got:%q %v", data, err)
+	}
+	if len(waits) != 2 || waits[0] != time.Second || waits[1] != 2*time.Second {
+		t.Errorf("fetch: wrong backoff got:%v", waits)
+	}
+	if f.statsFor("test").Retries != 2 {
+		t.Errorf("fetch: wrong retries got:%d", f.statsFor("test").Retries)
+	}
+
+	// Client errors are not retried
+	requests = 0
+	_, err = f.fetch("missing", server.URL+"/missing")
+	if err == nil || requests != 1 {
+		t.Errorf("fetch: expected one failed request got:%d %v", requests, err)
+	}
+
+	// Responses over the size limit fail
+	f.maxSize = 10
+	_, err = f.fetch("large", server.URL+"/large")
+	if err == nil {
+		t.Errorf("fetch: expected error for large response")
+	}
+	if f.statsFor("large").Failures != 1 {
+		t.Errorf("fetch: failure not recorded got:%+v", f.statsFor("large"))
+	}
+}
+
+func TestFetchTimeout(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+		}
+	}))
+	defer server.Close()
+	defer close(done)
+
+	var waits []time.Duration
+	f := testFetcher(&waits)
+	f.client.Timeout = 10 * time.Millisecond
+	f.retries = 1
+	_, err := f.fetch("slow", server.URL)
+	if err == nil || len(waits) != 1 {
+		t.Errorf("fetch: expected timeout and retry got:%v %v", waits, err)
+	}
+}
@@ -0,0 +1,299 @@
+package series
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BackupCount is the number of previous versions of a data file kept when saving
+// backups are stored alongside the file as series.csv.1 (newest) to series.csv.5 (oldest)
+var BackupCount = 5
+
+// checksumPath returns the path of the checksum file stored alongside the file at p
+func checksumPath(p string) string {
+	return p + ".sha256"
+}
+
+// backupPath returns the path of backup n for the file at p
+func backupPath(p string, n int) string {
+	return fmt.Sprintf("%s.%d", p, n)
+}
+
+// checksum returns the hex encoded sha256 checksum of data
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// writeFileAtomic writes data to the file at p atomically
+// data is written to a temp file in the same directory, synced and then renamed over p
+// so that a crash at any point leaves either the old or the new file in place
+func writeFileAtomic(p string, data []byte) error {
+	dir := filepath.Dir(p)
+
+	f, err := os.CreateTemp(dir, filepath.Base(p)+".tmp")
+	if err != nil {
+		return fmt.Errorf("series: failed to create temp file:%s", err)
+	}
+	tmp := f.Name()
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("series: failed to write temp file:%s", err)
+	}
+
+	err = os.Rename(tmp, p)
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("series: failed to rename temp file:%s", err)
+	}
+
+	// Sync the directory so that the rename is durable
+	syncDir(dir)
+	return nil
+}
+
+// syncDir syncs a directory, errors are ignored as not all platforms support this
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
+
+// copyFile copies the file at src to dst (dst is replaced atomically)
+func copyFile(src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(dst, data)
+}
+
+// rotateBackups shifts existing backups of the file at p up by one, dropping the oldest
+// and then copies the current file (and its checksum) to backup 1
+// if there is no current file nothing is done
+func rotateBackups(p string) error {
+	if BackupCount < 1 {
+		return nil
+	}
+
+	_, err := os.Stat(p)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	for i := BackupCount - 1; i > 0; i-- {
+		for _, from := range []string{backupPath(p, i), checksumPath(backupPath(p, i))} {
+			to := strings.Replace(from, backupPath(p, i), backupPath(p, i+1), 1)
+			err = os.Rename(from, to)
+			if err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("series: failed to rotate backup:%s", err)
+			}
+		}
+	}
+
+	err = copyFile(p, backupPath(p, 1))
+	if err != nil {
+		return fmt.Errorf("series: failed to backup file:%s", err)
+	}
+
+	// Copy the checksum too if we have one, else remove any stale checksum for this backup
+	err = copyFile(checksumPath(p), checksumPath(backupPath(p, 1)))
+	if os.IsNotExist(err) {
+		os.Remove(checksumPath(backupPath(p, 1)))
+	} else if err != nil {
+		return fmt.Errorf("series: failed to backup checksum:%s", err)
+	}
+
+	return nil
+}
+
+// saveFile saves data to the file at p atomically, keeping backups of previous versions
+// a checksum file is written alongside so that the file can be verified on load
+func saveFile(p string, data []byte) error {
+	err := rotateBackups(p)
+	if err != nil {
+		return err
+	}
+
+	err = writeFileAtomic(p, data)
+	if err != nil {
+		return err
+	}
+
+	return writeChecksum(p, data)
+}
+
+// writeChecksum writes the checksum of data, the contents of the file at p, alongside it
+func writeChecksum(p string, data []byte) error {
+	return writeFileAtomic(checksumPath(p), []byte(checksum(data)+"\n"))
+}
+
+// AcceptFile updates the checksum of the file at p to match its contents, if it has a checksum file
+// this should be called when the file has been replaced on purpose (for example by git)
+// so that it is not treated as corrupt and replaced by a backup on the next load
+func AcceptFile(p string) error {
+	_, err := os.Stat(checksumPath(p))
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return err
+	}
+	return writeChecksum(p, data)
+}
+
+// verifyChecksum verifies data read from the file at p against its checksum file if present
+// files without a checksum file (for example edited by hand) are not verified
+func verifyChecksum(p string, data []byte) error {
+	want, err := os.ReadFile(checksumPath(p))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(string(want)) != checksum(data) {
+		return fmt.Errorf("series: checksum mismatch for file:%s", p)
+	}
+
+	return nil
+}
+
+// readFileVerified reads the file at p, verifying it against its checksum file if present
+func readFileVerified(p string) ([]byte, error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+
+	err = verifyChecksum(p, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// readFileWithFallback reads the file at p, verified against its checksum
+// if the file is missing or corrupt, the newest valid backup is read instead
+// validate is called on the data read, and should return an error for invalid data
+// files replaced on purpose should be accepted with AcceptFile first, see AcceptFile
+func readFileWithFallback(p string, validate func([]byte) error) ([]byte, error) {
+	data, err := readFileVerified(p)
+	if err == nil {
+		err = validate(data)
+	}
+	if err == nil {
+		return data, nil
+	}
+
+	log.Printf("series: WARNING failed to read file:%s error:%s", p, err)
+
+	for i := 1; i <= BackupCount; i++ {
+		b := backupPath(p, i)
+		data, backupErr := readFileVerified(b)
+		if backupErr == nil {
+			backupErr = validate(data)
+		}
+		if backupErr == nil {
+			log.Printf("series: falling back to backup file:%s", b)
+			return data, nil
+		}
+		if !os.IsNotExist(backupErr) {
+			log.Printf("series: failed to read backup:%s error:%s", b, backupErr)
+		}
+	}
+
+	return nil, err
+}
+
+// appendFile appends data to the file at p and syncs it, creating the file with header if required
+// an incomplete last line left by an earlier failed append is removed first
+func appendFile(p, header string, data []byte) error {
+	f, err := os.OpenFile(p, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	size, err := completeSize(f)
+	if err != nil {
+		return err
+	}
+	err = f.Truncate(size)
+	if err != nil {
+		return err
+	}
+	_, err = f.Seek(size, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	if size == 0 {
+		_, err = f.WriteString(header)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = f.Write(data)
+	if err != nil {
+		return err
+	}
+
+	return f.Sync()
+}
+
+// completeSize returns the size of the file up to and including the last newline
+// the file is read backwards in chunks, so only a partial last line (if any) is excluded
+func completeSize(f *os.File) (int64, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	// Lines are short, so usually only the end of the file needs to be read
+	end := info.Size()
+	chunk := make([]byte, 4096)
+	for end > 0 {
+		start := end - int64(len(chunk))
+		if start < 0 {
+			start = 0
+		}
+		tail := chunk[:end-start]
+		_, err = f.ReadAt(tail, start)
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+
+		i := bytes.LastIndexByte(tail, '\n')
+		if i >= 0 {
+			return start + int64(i) + 1, nil
+		}
+		end = start
+	}
+
+	// No newline at all, so the whole file is a partial line
+	return 0, nil
+}
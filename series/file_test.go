@@ -0,0 +1,182 @@
+package series
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testSaveStore returns a store with a small dataset with deaths on the last of 3 days
+// if deaths is 0 the series have no days, ready for loading
+func testSaveStore(deaths int) *Store {
+	slice := Slice{{ID: 1}, {ID: 2, Country: "Testland"}}
+	if deaths > 0 {
+		for _, s := range slice {
+			s.AddDays(3)
+			s.SetValue(s.Count()-1, DataDeaths, deaths)
+		}
+	}
+	store := NewStore()
+	store.publish(slice)
+	return store
+}
+
+func TestSaveAtomic(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "series.csv")
+
+	// Save several versions so that backups are rotated
+	for i := 1; i <= BackupCount+2; i++ {
+		err := testSaveStore(i).Save(p)
+		if err != nil {
+			t.Fatalf("save: failed to save:%s", err)
+		}
+	}
+
+	// We should have the file, its checksum and BackupCount backups
+	for _, f := range []string{p, checksumPath(p), backupPath(p, 1), checksumPath(backupPath(p, BackupCount))} {
+		_, err := os.Stat(f)
+		if err != nil {
+			t.Errorf("save: missing file:%s", f)
+		}
+	}
+	_, err := os.Stat(backupPath(p, BackupCount+1))
+	if !os.IsNotExist(err) {
+		t.Errorf("save: too many backups kept")
+	}
+
+	// Backups are kept of the previous versions
+	backup := testSaveStore(0).Current()
+	err = backup.load(backupPath(p, 1))
+	if err != nil || backup[1].LastDay().Deaths != BackupCount+1 {
+		t.Errorf("save: wrong backup got:%v %v", backup[1].LastDay(), err)
+	}
+
+	// No temp files should remain
+	matches, _ := filepath.Glob(filepath.Join(filepath.Dir(p), "*.tmp*"))
+	if len(matches) > 0 {
+		t.Errorf("save: temp files left behind:%v", matches)
+	}
+
+	// Load the latest version
+	store := testSaveStore(0)
+	err = store.Load(p)
+	if err != nil {
+		t.Fatalf("load: failed to load:%s", err)
+	}
+	if store.Current()[1].LastDay().Deaths != BackupCount+2 {
+		t.Errorf("load: wrong deaths want:%d got:%d", BackupCount+2, store.Current()[1].LastDay().Deaths)
+	}
+}
+
+func TestLoadFallback(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "series.csv")
+	for i := 1; i <= 2; i++ {
+		err := testSaveStore(i).Save(p)
+		if err != nil {
+			t.Fatalf("save: failed to save:%s", err)
+		}
+	}
+
+	// Truncate the main file as a crash mid-write would
+	err := os.WriteFile(p, []byte("day,area_id,deaths,confirmed,recovered,tested\n3,2,"), 0644)
+	if err != nil {
+		t.Fatalf("save: failed to corrupt file:%s", err)
+	}
+
+	store := testSaveStore(0)
+	err = store.Load(p)
+	if err != nil {
+		t.Fatalf("load: failed to fall back to backup:%s", err)
+	}
+
+	// We should have the previous version from the backup
+	if store.Current()[1].LastDay().Deaths != 1 {
+		t.Errorf("load: wrong deaths from backup want:%d got:%d", 1, store.Current()[1].LastDay().Deaths)
+	}
+}
+
+func TestLoadReplaced(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "series.csv")
+	for i := 1; i <= 2; i++ {
+		err := testSaveStore(i).Save(p)
+		if err != nil {
+			t.Fatalf("save: failed to save:%s", err)
+		}
+	}
+
+	// Replace the file with valid data which does not match the checksum
+	data := []byte("day,area_id,deaths,confirmed,recovered,tested\n3,2,7,0,0,0\n")
+	err := os.WriteFile(p, data, 0644)
+	if err != nil {
+		t.Fatalf("save: failed to replace file:%s", err)
+	}
+
+	// The file is treated as corrupt and the backup used
+	store := testSaveStore(0)
+	err = store.Load(p)
+	if err != nil {
+		t.Fatalf("load: failed to fall back to backup:%s", err)
+	}
+	if store.Current()[1].LastDay().Deaths != 1 {
+		t.Errorf("load: wrong deaths from backup want:%d got:%d", 1, store.Current()[1].LastDay().Deaths)
+	}
+
+	// Once accepted, as after a git pull, the replaced file is used
+	err = AcceptFile(p)
+	if err != nil {
+		t.Fatalf("load: failed to accept file:%s", err)
+	}
+	store = testSaveStore(0)
+	err = store.Load(p)
+	if err != nil {
+		t.Fatalf("load: failed to load replaced file:%s", err)
+	}
+	if store.Current()[1].LastDay().Deaths != 7 {
+		t.Errorf("load: wrong deaths from replaced file want:%d got:%d", 7, store.Current()[1].LastDay().Deaths)
+	}
+}
+
+func TestAppendFile(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "journal.csv")
+
+	// Rows longer than the chunk read are kept, and only the partial last row removed
+	long := strings.Repeat("x", 10000) + "\n"
+	err := os.WriteFile(p, []byte("header\n"+long+"partial"), 0644)
+	if err != nil {
+		t.Fatalf("append: failed to write file:%s", err)
+	}
+	err = appendFile(p, "header\n", []byte("row\n"))
+	if err != nil {
+		t.Fatalf("append: failed to append:%s", err)
+	}
+	data, err := os.ReadFile(p)
+	if err != nil || string(data) != "header\n"+long+"row\n" {
+		t.Errorf("append: wrong data after removing partial row len:%d %v", len(data), err)
+	}
+
+	// A long partial row after the last newline is removed
+	err = os.WriteFile(p, []byte("header\n"+long+strings.Repeat("y", 10000)), 0644)
+	if err != nil {
+		t.Fatalf("append: failed to write file:%s", err)
+	}
+	err = appendFile(p, "header\n", []byte("row\n"))
+	if err != nil {
+		t.Fatalf("append: failed to append:%s", err)
+	}
+	data, err = os.ReadFile(p)
+	if err != nil || string(data) != "header\n"+long+"row\n" {
+		t.Errorf("append: wrong data after removing long partial row len:%d %v", len(data), err)
+	}
+
+	// A new file has the header written first
+	p = filepath.Join(t.TempDir(), "new.csv")
+	err = appendFile(p, "header\n", []byte("row\n"))
+	if err != nil {
+		t.Fatalf("append: failed to append:%s", err)
+	}
+	data, err = os.ReadFile(p)
+	if err != nil || string(data) != "header\nrow\n" {
+		t.Errorf("append: wrong data for new file:%q %v", data, err)
+	}
+}
@@ -0,0 +1,251 @@
+package series
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrGitConflict is returned by GitRepo.Pull if changes from the remote conflict with local changes
+var ErrGitConflict = errors.New("series: git conflict")
+
+// gitSummaryAreas is the number of areas named for each metric in a commit message
+const gitSummaryAreas = 10
+
+// GitRepo commits data changes to the git repository the server runs from
+// if the repo has no remote, pulls are skipped and commits are never pushed
+type GitRepo struct {
+	Path   string
+	Remote string
+	Push   bool
+
+	mutex sync.Mutex
+
+	// trees records the trees of paths at HEAD after the last pull or commit, keyed by paths, see Pull
+	trees map[string]string
+}
+
+// NewGitRepo returns a repo for the git working tree at p which pulls from origin
+func NewGitRepo(p string) *GitRepo {
+	return &GitRepo{Path: p, Remote: "origin"}
+}
+
+// git runs a git command in the repo, returning the output, or an error including the output on failure
+func (g *GitRepo) git(args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = g.Path
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+	if err != nil {
+		return out.String(), fmt.Errorf("series: git %s failed:%s output:%s", args[0], err, strings.TrimSpace(out.String()))
+	}
+	return out.String(), nil
+}
+
+// hasRemote returns true if the repo remote is configured
+func (g *GitRepo) hasRemote() bool {
+	out, err := g.git("remote")
+	if err != nil {
+		return false
+	}
+	for _, remote := range strings.Fields(out) {
+		if remote == g.Remote {
+			return true
+		}
+	}
+	return false
+}
+
+// rebasing returns true if a rebase was stopped part way, e.g. by a conflict
+func (g *GitRepo) rebasing() bool {
+	for _, dir := range []string{"rebase-merge", "rebase-apply"} {
+		out, err := g.git("rev-parse", "--git-path", dir)
+		if err != nil {
+			continue
+		}
+		p := strings.TrimSpace(out)
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(g.Path, p)
+		}
+		if _, err := os.Stat(p); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// tree returns an id for the files within paths at HEAD, or a blank string if there are no commits
+func (g *GitRepo) tree(paths []string) string {
+	args := append([]string{"ls-tree", "HEAD", "--"}, paths...)
+	out, err := g.git(args...)
+	if err != nil {
+		return ""
+	}
+	return out
+}
+
+// setTree records the tree of paths at HEAD
+func (g *GitRepo) setTree(paths []string) {
+	if g.trees == nil {
+		g.trees = make(map[string]string)
+	}
+	g.trees[strings.Join(paths, " ")] = g.tree(paths)
+}
+
+// Pull fetches changes from the remote and rebases local commits on them, keeping uncommitted changes
+// it returns true if files within paths were changed by this pull, or any made when pushing since the last pull
+// so that data loaded from them can be reloaded - changes committed locally with Commit are not included
+// if the rebase conflicts it is aborted, leaving the repo as it was, and ErrGitConflict is returned
+func (g *GitRepo) Pull(paths ...string) (bool, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	before, ok := g.trees[strings.Join(paths, " ")]
+	if !ok {
+		before = g.tree(paths)
+	}
+
+	err := g.pull()
+	if err != nil {
+		return false, err
+	}
+
+	g.setTree(paths)
+	return g.trees[strings.Join(paths, " ")] != before, nil
+}
+
+// pull pulls as Pull, the mutex must be held by the caller
+func (g *GitRepo) pull() error {
+	if !g.hasRemote() {
+		return nil
+	}
+
+	_, err := g.git("pull", "--rebase", "--autostash", g.Remote)
+	if err == nil {
+		return nil
+	}
+
+	if g.rebasing() {
+		_, abortErr := g.git("rebase", "--abort")
+		if abortErr != nil {
+			log.Printf("series: failed to abort rebase:%s", abortErr)
+		}
+		log.Printf("series: aborted pull from remote:%s error:%s", g.Remote, err)
+		return ErrGitConflict
+	}
+	return err
+}
+
+// Commit commits changes to files within paths (relative to the repo) with message, returning false if unchanged
+// other changes in the working tree are not committed, if Push is set the commit is pushed to the remote
+func (g *GitRepo) Commit(message string, paths ...string) (bool, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	args := append([]string{"add", "-A", "--"}, paths...)
+	_, err := g.git(args...)
+	if err != nil {
+		return false, err
+	}
+
+	// Exits with status 1 if there are staged changes within paths
+	args = append([]string{"diff", "--cached", "--quiet", "--"}, paths...)
+	_, err = g.git(args...)
+	if err == nil {
+		return false, nil
+	}
+
+	args = append([]string{"commit", "-m", message, "--"}, paths...)
+	_, err = g.git(args...)
+	if err != nil {
+		return false, err
+	}
+
+	// Record our own changes, so that the next pull reports only changes from the remote
+	g.setTree(paths)
+
+	if g.Push && g.hasRemote() {
+		err = g.push()
+		if err != nil {
+			return true, err
+		}
+	}
+
+	return true, nil
+}
+
+// push pushes the current branch, pulling and trying again once if the remote has changed
+// the mutex must be held by the caller
+func (g *GitRepo) push() error {
+	_, err := g.git("push", g.Remote, "HEAD")
+	if err == nil {
+		return nil
+	}
+
+	log.Printf("series: push rejected, pulling and trying again:%s", err)
+	err = g.pull()
+	if err != nil {
+		return err
+	}
+	_, err = g.git("push", g.Remote, "HEAD")
+	return err
+}
+
+// CommitMessage returns a commit message summarising the changes between previous and current datasets
+// the first line gives the count of areas changed, and the body lists areas changed for each metric
+func CommitMessage(previous, current Slice, now time.Time) string {
+	changes := journalChanges(previous, current, "", now)
+
+	areas := make(map[int]bool)
+	byMetric := make(map[int]map[int]bool)
+	for _, c := range changes {
+		areas[c.AreaID] = true
+		if byMetric[c.Metric] == nil {
+			byMetric[c.Metric] = make(map[int]bool)
+		}
+		byMetric[c.Metric][c.AreaID] = true
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Update data for %s: %d areas changed\n", now.UTC().Format("2006-01-02"), len(areas))
+	if len(areas) == 0 {
+		return b.String()
+	}
+	b.WriteString("\n")
+
+	index := current.Index()
+	for _, metric := range []int{DataDeaths, DataConfirmed, DataRecovered, DataTested, DataHospitalised} {
+		ids := byMetric[metric]
+		if len(ids) == 0 {
+			continue
+		}
+
+		var titles []string
+		for id := range ids {
+			series, err := index.FindSeries(id)
+			if err == nil {
+				titles = append(titles, series.Title())
+			}
+		}
+		sort.Strings(titles)
+
+		more := ""
+		if len(titles) > gitSummaryAreas {
+			more = fmt.Sprintf(" and %d more", len(titles)-gitSummaryAreas)
+			titles = titles[:gitSummaryAreas]
+		}
+		fmt.Fprintf(&b, "%s (%d): %s%s\n", journalMetrics[metric], len(ids), strings.Join(titles, ", "), more)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,176 @@
+package series
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testGit runs git in dir, failing the test on error
+func testGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	out, err := (&GitRepo{Path: dir}).git(args...)
+	if err != nil {
+		t.Fatalf("git: %s", err)
+	}
+	return strings.TrimSpace(out)
+}
+
+// testClone clones the repo at remote into a new dir, returning the repo
+func testClone(t *testing.T, remote string) *GitRepo {
+	dir := t.TempDir()
+	testGit(t, dir, "clone", "-q", remote, ".")
+	testGit(t, dir, "config", "user.name", "Test")
+	testGit(t, dir, "config", "user.email", "test@example.com")
+	testGit(t, dir, "config", "pull.rebase", "true")
+	return NewGitRepo(dir)
+}
+
+// testWrite writes data to the file at name in the repo
+func testWrite(t *testing.T, g *GitRepo, name, data string) {
+	t.Helper()
+	p := filepath.Join(g.Path, name)
+	err := os.MkdirAll(filepath.Dir(p), 0755)
+	if err == nil {
+		err = os.WriteFile(p, []byte(data), 0644)
+	}
+	if err != nil {
+		t.Fatalf("git: failed to write file:%s", err)
+	}
+}
+
+func TestGitRepo(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	remote := t.TempDir()
+	testGit(t, remote, "init", "-q", "--bare", "-b", "main")
+
+	server := testClone(t, remote)
+	testWrite(t, server, "data/series.csv", "day,area_id\n1,1\n")
+	testWrite(t, server, "notes.txt", "not data\n")
+
+	// Only changes to data are committed, and nothing is pushed unless requested
+	committed, err := server.Commit("Update data", "data")
+	if err != nil || !committed {
+		t.Fatalf("git: failed to commit got:%v %v", committed, err)
+	}
+	if files := testGit(t, server.Path, "show", "--name-only", "--format=%s", "HEAD"); files != "Update data\n\ndata/series.csv" {
+		t.Errorf("git: wrong commit got:%q", files)
+	}
+	committed, err = server.Commit("Update data", "data")
+	if err != nil || committed {
+		t.Errorf("git: committed without changes got:%v %v", committed, err)
+	}
+
+	server.Push = true
+	testWrite(t, server, "data/series.csv", "day,area_id\n1,1\n2,1\n")
+	_, err = server.Commit("Update data again", "data")
+	if err != nil {
+		t.Fatalf("git: failed to commit and push:%s", err)
+	}
+	other := testClone(t, remote)
+	if testGit(t, other.Path, "log", "-1", "--format=%s") != "Update data again" {
+		t.Errorf("git: commit not pushed")
+	}
+
+	// Changes elsewhere are rebased on, keeping uncommitted changes
+	testWrite(t, other, "data/areas.csv", "area_id\n1\n")
+	testGit(t, other.Path, "add", "data/areas.csv")
+	testGit(t, other.Path, "commit", "-qm", "Add areas file")
+	testGit(t, other.Path, "push", "-q", "origin", "HEAD")
+	testWrite(t, server, "data/journal.csv", "time\n")
+	changed, err := server.Pull("data")
+	if err != nil || !changed {
+		t.Fatalf("git: failed to pull changes got:%v %v", changed, err)
+	}
+	if _, err := os.Stat(filepath.Join(server.Path, "data/areas.csv")); err != nil {
+		t.Errorf("git: changes not pulled:%s", err)
+	}
+	if _, err := os.Stat(filepath.Join(server.Path, "data/journal.csv")); err != nil {
+		t.Errorf("git: uncommitted changes lost:%s", err)
+	}
+
+	// Changes to data from the remote are reported, so that data can be reloaded, but not other changes
+	testWrite(t, other, "README.txt", "not data either\n")
+	testGit(t, other.Path, "add", "README.txt")
+	testGit(t, other.Path, "commit", "-qm", "Add readme")
+	testGit(t, other.Path, "push", "-q", "origin", "HEAD")
+	changed, err = server.Pull("data")
+	if err != nil || changed {
+		t.Errorf("git: wrong pull for changes outside data got:%v %v", changed, err)
+	}
+	testGit(t, other.Path, "pull", "-q")
+	testWrite(t, other, "data/series.csv", "day,area_id\n1,1\n2,1\n3,1\n")
+	testGit(t, other.Path, "commit", "-qam", "Fix series")
+	testGit(t, other.Path, "push", "-q", "origin", "HEAD")
+	changed, err = server.Pull("data")
+	if err != nil || !changed {
+		t.Errorf("git: changes to series not reported got:%v %v", changed, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(server.Path, "data/series.csv")); string(data) != "day,area_id\n1,1\n2,1\n3,1\n" {
+		t.Errorf("git: series not pulled got:%q", data)
+	}
+
+	// Our own commits are not reported, but changes pulled when pushing them are
+	testGit(t, other.Path, "pull", "-q")
+	testWrite(t, other, "data/areas.csv", "area_id\n1\n2\n")
+	testGit(t, other.Path, "commit", "-qam", "Add area")
+	testGit(t, other.Path, "push", "-q", "origin", "HEAD")
+	testWrite(t, server, "data/journal.csv", "time\n1\n")
+	_, err = server.Commit("Update journal", "data")
+	if err != nil {
+		t.Fatalf("git: failed to commit and push:%s", err)
+	}
+	changed, err = server.Pull("data")
+	if err != nil || !changed {
+		t.Errorf("git: changes pulled on push not reported got:%v %v", changed, err)
+	}
+	changed, err = server.Pull("data")
+	if err != nil || changed {
+		t.Errorf("git: changes reported twice got:%v %v", changed, err)
+	}
+
+	// Conflicting changes abort the pull, leaving local commits in place
+	testGit(t, other.Path, "pull", "-q")
+	testWrite(t, other, "data/series.csv", "day,area_id\n1,2\n")
+	testGit(t, other.Path, "commit", "-qam", "Fix area")
+	testGit(t, other.Path, "push", "-q", "origin", "HEAD")
+	server.Push = false
+	testWrite(t, server, "data/series.csv", "day,area_id\n1,3\n")
+	_, err = server.Commit("Conflicting update", "data")
+	if err != nil {
+		t.Fatalf("git: failed to commit:%s", err)
+	}
+	_, err = server.Pull("data")
+	if err != ErrGitConflict {
+		t.Fatalf("git: expected conflict got:%v", err)
+	}
+	if server.rebasing() || testGit(t, server.Path, "log", "-1", "--format=%s") != "Conflicting update" {
+		t.Errorf("git: pull not aborted")
+	}
+}
+
+func TestCommitMessage(t *testing.T) {
+	previous := Slice{{ID: 1, Country: "Testland"}, {ID: 2, Country: "Otherland"}, {ID: 3, Country: "Nochange"}}
+	for _, s := range previous {
+		s.AddDays(2)
+	}
+	current := previous.Copy()
+	current[0].SetValue(1, DataDeaths, 5)
+	current[1].SetValue(1, DataDeaths, 2)
+	current[1].SetValue(0, DataConfirmed, 9)
+
+	now := time.Date(2020, 5, 6, 12, 0, 0, 0, time.UTC)
+	want := "Update data for 2020-05-06: 2 areas changed\n\ndeaths (2): Otherland, Testland\nconfirmed (1): Otherland\n"
+	if got := CommitMessage(previous, current, now); got != want {
+		t.Errorf("git: wrong message want:%q got:%q", want, got)
+	}
+	if got := CommitMessage(previous, previous, now); got != "Update data for 2020-05-06: 0 areas changed\n" {
+		t.Errorf("git: wrong message without changes got:%q", got)
+	}
+}
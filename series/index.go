@@ -0,0 +1,161 @@
+package series
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Index provides fast lookups of series in a slice by id and by slug (country and province keys)
+// provinces with a code are also found by country and code, for example US and AK
+// an index stays valid when the slice is sorted, as it refers to series rather than positions,
+// but must be rebuilt if series are added or their ids or names change
+type Index struct {
+	slice   Slice
+	byID    map[int]*Data
+	bySlug  map[string]*Data
+	version uint64
+}
+
+// Index returns a new index for the series in this slice
+// where several series share an id or slug, the first in the slice is found
+func (slice Slice) Index() *Index {
+	index := &Index{
+		slice:  slice,
+		byID:   make(map[int]*Data, len(slice)),
+		bySlug: make(map[string]*Data, len(slice)),
+	}
+	for _, s := range slice {
+		index.addLookups(s)
+	}
+	return index
+}
+
+// add appends s to the slice indexed, the index must not have been published
+func (index *Index) add(s *Data) {
+	index.slice = append(index.slice, s)
+	index.addLookups(s)
+}
+
+// addLookups adds lookups for s by id, slug and code, unless another series has them already
+func (index *Index) addLookups(s *Data) {
+	if index.byID[s.ID] == nil {
+		index.byID[s.ID] = s
+	}
+	slugs := []string{s.Slug()}
+	if s.Code != "" {
+		slugs = append(slugs, slug(s.Country, s.Code))
+	}
+	for _, k := range slugs {
+		if index.bySlug[k] == nil {
+			index.bySlug[k] = s
+		}
+	}
+}
+
+// Slug returns a key for this series which is unique for each country and province
+func (d *Data) Slug() string {
+	return slug(d.Country, d.Province)
+}
+
+// slug returns the slug for country and province - matching is case insensitive as for Match
+func slug(country, province string) string {
+	return key(country) + "/" + key(province)
+}
+
+// key returns a key for v suitable for urls, see Data.Key
+func key(v string) string {
+	return strings.Replace(strings.ToLower(v), " ", "-", -1)
+}
+
+// keyEqual returns true if key(a) == key(b), without allocating new strings
+func keyEqual(a, b string) bool {
+	for a != "" && b != "" {
+		ra, na := utf8.DecodeRuneInString(a)
+		rb, nb := utf8.DecodeRuneInString(b)
+		if keyRune(ra) != keyRune(rb) {
+			return false
+		}
+		a, b = a[na:], b[nb:]
+	}
+	return a == "" && b == ""
+}
+
+// keyRune returns the rune used in keys for r
+func keyRune(r rune) rune {
+	if r == ' ' {
+		return '-'
+	}
+	return unicode.ToLower(r)
+}
+
+// Slice returns the slice indexed
+func (index *Index) Slice() Slice {
+	return index.slice
+}
+
+// Version returns the version of the dataset snapshot indexed, or 0 if the slice was never published
+func (index *Index) Version() uint64 {
+	return index.version
+}
+
+// FetchSeries returns a series (if found) for this combination of country and province
+func (index *Index) FetchSeries(country string, province string) (*Data, error) {
+	s := index.bySlug[slug(country, province)]
+	if s == nil {
+		return &Data{}, fmt.Errorf("series: not found")
+	}
+	return s, nil
+}
+
+// FindSeries returns a series (if found) for this ID
+func (index *Index) FindSeries(seriesID int) (*Data, error) {
+	s := index.byID[seriesID]
+	if s == nil {
+		return &Data{}, fmt.Errorf("series: not found")
+	}
+	return s, nil
+}
+
+// CompareSeries fetches the series for a list of keys in the form country or country/province
+// for example italy, us/new-york - duplicates are ignored and an error is returned
+// listing any keys which could not be found
+func (index *Index) CompareSeries(keys []string) (Slice, error) {
+	var collection Slice
+	var invalid []string
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+
+		country, province := key, ""
+		parts := strings.SplitN(key, "/", 2)
+		if len(parts) == 2 {
+			country, province = parts[0], parts[1]
+		}
+
+		s, err := index.FetchSeries(country, province)
+		if err != nil {
+			invalid = append(invalid, key)
+			continue
+		}
+
+		// Skip series already added
+		if collection.Contains(s) {
+			continue
+		}
+		collection = append(collection, s)
+	}
+
+	if len(invalid) > 0 {
+		return nil, fmt.Errorf("series: comparison not found:%s", strings.Join(invalid, ","))
+	}
+
+	if len(collection) > MaxComparisons {
+		return nil, fmt.Errorf("series: too many comparisons:%d max:%d", len(collection), MaxComparisons)
+	}
+
+	return collection, nil
+}
@@ -0,0 +1,136 @@
+package series
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestIndex(t *testing.T) {
+	slice := Slice{
+		{ID: 1},
+		{ID: 2, Country: "United Kingdom"},
+		{ID: 3, Country: "United Kingdom", Province: "Northern Ireland"},
+		{ID: 4, Country: "US", Province: "New York", Code: "NY"},
+		{ID: 4, Country: "Duplicate"},
+	}
+	index := slice.Index()
+
+	// Sorting the slice should not invalidate the index
+	sort.Stable(slice)
+
+	tests := []struct {
+		country, province string
+		id                int
+	}{
+		{"", "", 1},
+		{"united-kingdom", "", 2},
+		{"United Kingdom", "northern-ireland", 3},
+		{"us", "New York", 4},
+	}
+	for _, test := range tests {
+		s, err := index.FetchSeries(test.country, test.province)
+		if err != nil || s.ID != test.id {
+			t.Errorf("index: wrong series for:%s,%s want:%d got:%d", test.country, test.province, test.id, s.ID)
+		}
+		if !s.Match(test.country, test.province) {
+			t.Errorf("index: series does not match:%s,%s", test.country, test.province)
+		}
+	}
+
+	// Provinces are also found by code
+	s, err := index.FetchSeries("US", "ny")
+	if err != nil || s.ID != 4 {
+		t.Errorf("index: wrong series for code:NY got:%v", s)
+	}
+	s, err = slice.FetchSeries("US", "ny")
+	if err != nil || s.ID != 4 {
+		t.Errorf("slice: wrong series for code:NY got:%v", s)
+	}
+
+	_, err = index.FetchSeries("atlantis", "")
+	if err == nil {
+		t.Errorf("index: expected error for invalid series")
+	}
+
+	// As with Slice.FindSeries the first series with an id is found
+	s, err = index.FindSeries(4)
+	if err != nil || s.Country != "US" {
+		t.Errorf("index: wrong series for id:4 got:%v", s)
+	}
+	_, err = index.FindSeries(5)
+	if err == nil {
+		t.Errorf("index: expected error for invalid id")
+	}
+
+	// Series added are found, and appended to the slice indexed
+	index.add(&Data{ID: 5, Country: "Atlantis"})
+	s, err = index.FetchSeries("atlantis", "")
+	if err != nil || s.ID != 5 || len(index.Slice()) != 6 {
+		t.Errorf("index: series not added got:%v", s)
+	}
+}
+
+// benchmarkAreas returns the test areas, and keys for a spread of them to look up
+func benchmarkAreas(b *testing.B) (Slice, [][2]string) {
+	slice, err := NewCSVBackend("testdata").LoadAreas()
+	if err != nil {
+		b.Fatalf("failed to load areas:%s", err)
+	}
+	var keys [][2]string
+	for i := 0; i < len(slice); i += 10 {
+		keys = append(keys, [2]string{slice[i].Key(slice[i].Country), slice[i].Key(slice[i].Province)})
+	}
+	return slice, keys
+}
+
+func BenchmarkFetchSeriesLinear(b *testing.B) {
+	slice, keys := benchmarkAreas(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, k := range keys {
+			_, err := slice.FetchSeries(k[0], k[1])
+			if err != nil {
+				b.Fatalf("fetch failed:%s", err)
+			}
+		}
+	}
+}
+
+func BenchmarkFetchSeriesIndex(b *testing.B) {
+	slice, keys := benchmarkAreas(b)
+	index := slice.Index()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, k := range keys {
+			_, err := index.FetchSeries(k[0], k[1])
+			if err != nil {
+				b.Fatalf("fetch failed:%s", err)
+			}
+		}
+	}
+}
+
+func BenchmarkFindSeriesLinear(b *testing.B) {
+	slice, _ := benchmarkAreas(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, s := range slice {
+			slice.FindSeries(s.ID)
+		}
+	}
+}
+
+func BenchmarkFindSeriesIndex(b *testing.B) {
+	slice, _ := benchmarkAreas(b)
+	index := slice.Index()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, s := range slice {
+			index.FindSeries(s.ID)
+		}
+	}
+}
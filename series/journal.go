@@ -0,0 +1,225 @@
+package series
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// journalHeader is the header row of the journal file
+const journalHeader = "time,source,area_id,day,metric,old,new"
+
+// journalMetrics are the data kinds recorded in the journal, with their names in the file
+var journalMetrics = map[int]string{
+	DataDeaths:       "deaths",
+	DataConfirmed:    "confirmed",
+	DataRecovered:    "recovered",
+	DataTested:       "tested",
+	DataHospitalised: "hospitalised",
+}
+
+// metricForName returns the data kind for a metric name used in the journal, or DataNone
+func metricForName(name string) int {
+	for kind, n := range journalMetrics {
+		if n == name {
+			return kind
+		}
+	}
+	return DataNone
+}
+
+// JournalEntry records one change to the value of a metric for an area on one day
+type JournalEntry struct {
+	Time   time.Time
+	Source string
+	AreaID int
+	Day    int // day number, 1 is seriesStartDate
+	Metric int // data kind, e.g. DataDeaths
+	Old    int
+	New    int
+}
+
+// Journal is an append-only file of changes made by updates since the series data was last saved
+// changes are appended before they are published, and replayed on load,
+// so that the series data need only be saved occasionally without losing updates
+type Journal struct {
+	Path string
+
+	mutex sync.Mutex
+}
+
+// NewJournal returns a journal stored in the file at p
+func NewJournal(p string) *Journal {
+	return &Journal{Path: p}
+}
+
+// Append appends entries to the journal, the file is synced before returning
+func (j *Journal) Append(entries []JournalEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	var buf bytes.Buffer
+	for _, e := range entries {
+		// Sources are our own names, but make sure they can't break the csv format
+		source := strings.NewReplacer(",", " ", "\n", " ").Replace(e.Source)
+		fmt.Fprintf(&buf, "%s,%s,%d,%d,%s,%d,%d\n", e.Time.UTC().Format(time.RFC3339), source, e.AreaID, e.Day, journalMetrics[e.Metric], e.Old, e.New)
+	}
+
+	err := appendFile(j.Path, journalHeader+"\n", buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("series: failed to append to journal:%s", err)
+	}
+	return nil
+}
+
+// Read returns all entries in the journal in the order written, or none if there is no journal
+// an incomplete last row (for example after a crash while appending) is ignored
+func (j *Journal) Read() ([]JournalEntry, error) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	f, err := os.Open(j.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []JournalEntry
+	reader := bufio.NewReader(f)
+	for i := 0; ; i++ {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if line != "" {
+				log.Printf("series: ignoring incomplete row in journal:%s row:%s", j.Path, line)
+			}
+			break
+		}
+		line = strings.TrimSpace(line)
+
+		// Validate header row
+		if i == 0 {
+			if line != journalHeader {
+				return nil, fmt.Errorf("series: invalid header row in journal:%s row:%s", j.Path, line)
+			}
+			continue
+		}
+
+		e, err := parseJournalRow(line)
+		if err != nil {
+			return nil, fmt.Errorf("series: invalid row in journal:%s row:%s error:%s", j.Path, line, err)
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+// Clear removes all entries from the journal, this is called after the series data is saved
+func (j *Journal) Clear() error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	err := os.Remove(j.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("series: failed to clear journal:%s", err)
+	}
+	return nil
+}
+
+// parseJournalRow parses a row of the journal
+func parseJournalRow(line string) (JournalEntry, error) {
+	cols := strings.Split(line, ",")
+	if len(cols) != 7 {
+		return JournalEntry{}, fmt.Errorf("invalid row len")
+	}
+
+	t, err := time.Parse(time.RFC3339, cols[0])
+	if err != nil {
+		return JournalEntry{}, err
+	}
+
+	e := JournalEntry{Time: t, Source: cols[1], Metric: metricForName(cols[4])}
+	if e.Metric == DataNone {
+		return JournalEntry{}, fmt.Errorf("invalid metric")
+	}
+
+	values := intValues([]string{cols[2], cols[3], cols[5], cols[6]})
+	e.AreaID, e.Day, e.Old, e.New = values[0], values[1], values[2], values[3]
+	if e.Day < 1 {
+		return JournalEntry{}, fmt.Errorf("invalid day")
+	}
+
+	return e, nil
+}
+
+// journalChanges returns entries for every value which differs between the series in previous and current
+// series are matched by id, and days missing from previous are treated as zero
+func journalChanges(previous, current Slice, source string, now time.Time) (entries []JournalEntry) {
+	index := previous.Index()
+	for _, s := range current {
+		p, err := index.FindSeries(s.ID)
+		if err != nil {
+			p = &Data{}
+		}
+
+		for i := 0; i < s.Count(); i++ {
+			day := s.Day(i)
+			old := Day{}
+			if i < p.Count() {
+				old = p.Day(i)
+			}
+			for _, metric := range []int{DataDeaths, DataConfirmed, DataRecovered, DataTested, DataHospitalised} {
+				if day.Value(metric) == old.Value(metric) {
+					continue
+				}
+				entries = append(entries, JournalEntry{
+					Time:   now,
+					Source: source,
+					AreaID: s.ID,
+					Day:    i + 1,
+					Metric: metric,
+					Old:    old.Value(metric),
+					New:    day.Value(metric),
+				})
+			}
+		}
+	}
+	return entries
+}
+
+// applyJournal sets values from journal entries on the series in this slice in the order written
+// days are added to all series as required to cover every entry
+func (slice Slice) applyJournal(entries []JournalEntry) {
+	days := 0
+	for _, e := range entries {
+		if e.Day > days {
+			days = e.Day
+		}
+	}
+	for _, s := range slice {
+		if s.Count() < days {
+			s.AddDays(days - s.Count())
+		}
+	}
+
+	index := slice.Index()
+	for _, e := range entries {
+		s, err := index.FindSeries(e.AreaID)
+		if err != nil {
+			log.Printf("series: series not found for journal entry:%v", e)
+			continue
+		}
+		s.SetValue(e.Day-1, e.Metric, e.New)
+	}
+}
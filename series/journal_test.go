@@ -0,0 +1,88 @@
+package series
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestJournalReplay(t *testing.T) {
+	dir := t.TempDir()
+	areas := Slice{{ID: 1}, {ID: 2, Country: "Testland"}}
+	for _, s := range areas {
+		s.AddDays(2)
+	}
+	backend := NewMemoryBackend(areas)
+	journal := NewJournal(filepath.Join(dir, "journal.csv"))
+
+	store := NewStore()
+	store.SetBackend(backend)
+	store.SetJournal(journal)
+	err := store.Reload()
+	if err != nil {
+		t.Fatalf("journal: failed to load:%s", err)
+	}
+
+	err = store.UpdateFrom("test", func(slice Slice) error {
+		s, err := slice.FindSeries(2)
+		if err != nil {
+			return err
+		}
+		s.SetValue(1, DataDeaths, 5)
+		s.SetValue(1, DataConfirmed, 10)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("journal: failed to update:%s", err)
+	}
+
+	entries, err := journal.Read()
+	if err != nil {
+		t.Fatalf("journal: failed to read:%s", err)
+	}
+	if len(entries) != 2 || entries[0].Source != "test" || entries[0].Metric != DataDeaths || entries[0].Old != 0 || entries[0].New != 5 || entries[0].Day != 2 {
+		t.Fatalf("journal: wrong entries:%v", entries)
+	}
+
+	// A new store with the same backend and journal should see the update
+	replayed := NewStore()
+	replayed.SetBackend(backend)
+	replayed.SetJournal(journal)
+	err = replayed.Reload()
+	if err != nil {
+		t.Fatalf("journal: failed to reload:%s", err)
+	}
+	s, err := replayed.FindSeries(2)
+	if err != nil || s.Day(1).Deaths != 5 || s.Day(1).Confirmed != 10 {
+		t.Fatalf("journal: update not replayed:%v", s)
+	}
+
+	// The data saved does not include the update replayed
+	s, err = replayed.Saved().FindSeries(2)
+	if err != nil || s.Day(1).Deaths != 0 {
+		t.Fatalf("journal: update included in saved data:%v", s)
+	}
+
+	// After compaction the journal is empty and the update is in the backend
+	err = store.Compact()
+	if err != nil {
+		t.Fatalf("journal: failed to compact:%s", err)
+	}
+	entries, err = journal.Read()
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("journal: not cleared:%v %v", entries, err)
+	}
+	s, err = store.Saved().FindSeries(2)
+	if err != nil || s.Day(1).Deaths != 5 {
+		t.Fatalf("journal: update not in saved data:%v", s)
+	}
+	compacted := NewStore()
+	compacted.SetBackend(backend)
+	err = compacted.Reload()
+	if err != nil {
+		t.Fatalf("journal: failed to reload:%s", err)
+	}
+	s, err = compacted.FindSeries(2)
+	if err != nil || s.Day(1).Deaths != 5 {
+		t.Fatalf("journal: update not compacted:%v", s)
+	}
+}
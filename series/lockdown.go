@@ -0,0 +1,189 @@
+package series
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Intervention records a dated intervention in one area (for example a lockdown or school closures)
+type Intervention struct {
+	Name string
+	Date time.Time
+}
+
+// Effect stores an estimate of the effect of an intervention on growth in one area
+// growth rates are daily exponential growth rates of the cumulative total
+// over the window before the intervention and the window after it (after a lag)
+type Effect struct {
+	Series       *Data
+	Intervention Intervention
+
+	// The data kind used (deaths or confirmed)
+	DataKind int
+
+	// Daily growth rates before and after the intervention
+	GrowthBefore float64
+	GrowthAfter  float64
+
+	// Whether the series had data to measure growth over the window before and the window after
+	MeasuredBefore bool
+	MeasuredAfter  bool
+
+	// Doubling times in days before and after the intervention (0 if not growing)
+	DoublingBefore float64
+	DoublingAfter  float64
+}
+
+// Valid returns true if we had enough data to measure growth both before and after
+// and there was growth before the intervention
+func (e *Effect) Valid() bool {
+	return e.MeasuredBefore && e.MeasuredAfter && e.GrowthBefore > 0
+}
+
+// Change returns the percentage change in daily growth rate after the intervention
+// a negative value is a reduction in growth
+func (e *Effect) Change() float64 {
+	if e.GrowthBefore == 0 {
+		return 0
+	}
+	return (e.GrowthAfter - e.GrowthBefore) / e.GrowthBefore * 100
+}
+
+// GrowthBeforeDisplay returns the growth rate before as a percentage for display
+func (e *Effect) GrowthBeforeDisplay() string {
+	return fmt.Sprintf("%.1f%%", e.GrowthBefore*100)
+}
+
+// GrowthAfterDisplay returns the growth rate after as a percentage for display
+func (e *Effect) GrowthAfterDisplay() string {
+	return fmt.Sprintf("%.1f%%", e.GrowthAfter*100)
+}
+
+// DoublingBeforeDisplay returns the doubling time before for display
+func (e *Effect) DoublingBeforeDisplay() string {
+	return formatDoubling(e.DoublingBefore)
+}
+
+// DoublingAfterDisplay returns the doubling time after for display
+func (e *Effect) DoublingAfterDisplay() string {
+	return formatDoubling(e.DoublingAfter)
+}
+
+// ChangeDisplay returns the change in growth rate for display
+func (e *Effect) ChangeDisplay() string {
+	return fmt.Sprintf("%+.0f%%", e.Change())
+}
+
+// formatDoubling formats a doubling time in days, a zero value is shown as a dash
+func formatDoubling(days float64) string {
+	if days <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f days", days)
+}
+
+// AllInterventions returns the interventions recorded for this area
+// the lockdown date (if any) is always included first
+func (d *Data) AllInterventions() []Intervention {
+	var interventions []Intervention
+	if d.HasLockdownAt() {
+		interventions = append(interventions, Intervention{Name: "Lockdown", Date: d.LockdownAt})
+	}
+	return append(interventions, d.Interventions...)
+}
+
+// AddIntervention records an intervention for this area, keeping interventions in date order
+func (d *Data) AddIntervention(name string, date time.Time) {
+	d.Interventions = append(d.Interventions, Intervention{Name: name, Date: date})
+	sort.SliceStable(d.Interventions, func(i, j int) bool {
+		return d.Interventions[i].Date.Before(d.Interventions[j].Date)
+	})
+}
+
+// DayIndex returns the index of the day with this date in the series, or -1 if not found
+func (d *Data) DayIndex(date time.Time) int {
+	if d.Count() == 0 {
+		return -1
+	}
+	// Days are contiguous so we can calculate the index from the first date
+	i := int(date.Sub(d.start).Hours() / 24)
+	if i < 0 || i >= d.Count() || !d.Date(i).Equal(date) {
+		return -1
+	}
+	return i
+}
+
+// GrowthRate returns the average daily exponential growth rate for dataKind
+// between day index start and day index end (inclusive), and whether it could be measured
+// it cannot be measured if the range runs outside the series, there is no data at the start or the total falls
+func (d *Data) GrowthRate(dataKind, start, end int) (float64, bool) {
+	if start < 0 || end >= d.Count() || end <= start {
+		return 0, false
+	}
+	from := d.Value(start, dataKind)
+	to := d.Value(end, dataKind)
+	if from <= 0 || to < from {
+		return 0, false
+	}
+	return math.Log(float64(to)/float64(from)) / float64(end-start), true
+}
+
+// DoublingTime returns the doubling time in days for a daily growth rate
+// 0 is returned for rates which are not positive
+func DoublingTime(rate float64) float64 {
+	if rate <= 0 {
+		return 0
+	}
+	return math.Ln2 / rate
+}
+
+// InterventionEffect estimates the effect of the intervention on growth in dataKind
+// comparing the window days up to the intervention with the window days starting lag days after it
+// the lag allows for the delay between infection and confirmation or death
+func (d *Data) InterventionEffect(intervention Intervention, dataKind, window, lag int) *Effect {
+	effect := &Effect{
+		Series:       d,
+		Intervention: intervention,
+		DataKind:     dataKind,
+	}
+
+	i := d.DayIndex(intervention.Date)
+	if i < 0 || window < 1 {
+		return effect
+	}
+
+	effect.GrowthBefore, effect.MeasuredBefore = d.GrowthRate(dataKind, i-window, i)
+	effect.GrowthAfter, effect.MeasuredAfter = d.GrowthRate(dataKind, i+lag, i+lag+window)
+	effect.DoublingBefore = DoublingTime(effect.GrowthBefore)
+	effect.DoublingAfter = DoublingTime(effect.GrowthAfter)
+	return effect
+}
+
+// InterventionEffects returns effect estimates for every intervention recorded for this area
+func (d *Data) InterventionEffects(dataKind, window, lag int) (effects []*Effect) {
+	for _, intervention := range d.AllInterventions() {
+		effects = append(effects, d.InterventionEffect(intervention, dataKind, window, lag))
+	}
+	return effects
+}
+
+// LockdownEffects returns effect estimates for all interventions in all areas which have them
+// only effects with enough data before and after are returned, sorted by change in growth rate
+func (slice Slice) LockdownEffects(dataKind, window, lag int) (effects []*Effect) {
+	for _, s := range slice {
+		for _, e := range s.InterventionEffects(dataKind, window, lag) {
+			if e.Valid() {
+				effects = append(effects, e)
+			}
+		}
+	}
+
+	// Sort with the largest reduction in growth first
+	sort.SliceStable(effects, func(i, j int) bool {
+		return effects[i].Change() < effects[j].Change()
+	})
+
+	return effects
+}
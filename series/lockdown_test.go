@@ -0,0 +1,80 @@
+package series
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// TestInterventionEffect tests growth before and after lockdown on a series doubling every 2 days then every 10
+func TestInterventionEffect(t *testing.T) {
+	lockdown := seriesStartDate.AddDate(0, 0, 20)
+	d := &Data{Country: "Testland", LockdownAt: lockdown}
+	d.AddDays(60)
+
+	// Deaths double every 2 days up to lockdown + 10 days, then every 10 days
+	deaths := 10.0
+	for i := 0; i < d.Count(); i++ {
+		d.SetValue(i, DataDeaths, int(deaths))
+		if i < 30 {
+			deaths *= math.Pow(2, 0.5)
+		} else {
+			deaths *= math.Pow(2, 0.1)
+		}
+	}
+
+	effects := d.InterventionEffects(DataDeaths, 7, 14)
+	if len(effects) != 1 {
+		t.Fatalf("lockdown: wrong effect count want:%d got:%d", 1, len(effects))
+	}
+
+	e := effects[0]
+	if !e.Valid() {
+		t.Fatalf("lockdown: effect invalid:%v", e)
+	}
+	if math.Abs(e.DoublingBefore-2) > 0.1 {
+		t.Errorf("lockdown: doubling before want:%d got:%f", 2, e.DoublingBefore)
+	}
+	if math.Abs(e.DoublingAfter-10) > 0.5 {
+		t.Errorf("lockdown: doubling after want:%d got:%f", 10, e.DoublingAfter)
+	}
+	if e.Change() > -75 {
+		t.Errorf("lockdown: change want:%d got:%f", -80, e.Change())
+	}
+}
+
+// TestInterventionEffectOutOfRange tests that interventions without enough data are invalid
+func TestInterventionEffectOutOfRange(t *testing.T) {
+	d := &Data{Country: "Testland"}
+	d.AddDays(20)
+	d.AddIntervention("Schools closed", seriesStartDate.AddDate(0, 0, 2))
+	d.AddIntervention("Too late", time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	for _, e := range d.InterventionEffects(DataDeaths, 7, 14) {
+		if e.Valid() {
+			t.Errorf("lockdown: effect should be invalid:%s %v", e.Intervention.Name, e)
+		}
+	}
+
+	if len(Slice{d}.LockdownEffects(DataDeaths, 7, 14)) != 0 {
+		t.Errorf("lockdown: invalid effects should not be returned")
+	}
+}
+
+// TestInterventionEffectRecent tests that interventions too recent to measure growth after are invalid
+func TestInterventionEffectRecent(t *testing.T) {
+	d := &Data{Country: "Testland"}
+	d.AddDays(40)
+	for i := 0; i < d.Count(); i++ {
+		d.SetValue(i, DataDeaths, 10+i*i)
+	}
+	d.AddIntervention("Lockdown", d.Date(d.Count()-5))
+
+	e := d.InterventionEffect(d.Interventions[0], DataDeaths, 7, 14)
+	if !e.MeasuredBefore || e.MeasuredAfter || e.Valid() {
+		t.Errorf("lockdown: recent effect should be invalid:%v", e)
+	}
+	if len(Slice{d}.LockdownEffects(DataDeaths, 7, 14)) != 0 {
+		t.Errorf("lockdown: recent effects should not be returned")
+	}
+}
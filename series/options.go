@@ -20,16 +20,58 @@ func PeriodOptions() (options []Option) {
 	return options
 }
 
-// CountryOptions uses our stored dataset to fetch country options
+// AlignOptions returns a set of options for aligning comparison charts
+func AlignOptions() (options []Option) {
+
+	options = append(options, Option{Name: "Align on Deaths", Value: "deaths"})
+	options = append(options, Option{Name: "Align on Confirmed", Value: "confirmed"})
+	options = append(options, Option{Name: "Align per Million", Value: "percapita"})
+	options = append(options, Option{Name: "Align on Lockdown", Value: "lockdown"})
+	options = append(options, Option{Name: "Align on Date", Value: "date"})
+
+	return options
+}
+
+// MetricOptions returns a set of options for the metric shown in comparison charts
+func MetricOptions() (options []Option) {
+
+	options = append(options, Option{Name: "Deaths", Value: "deaths"})
+	options = append(options, Option{Name: "Confirmed", Value: "confirmed"})
+
+	return options
+}
+
+// ValuesOptions returns a set of options for the values shown in comparison charts
+func ValuesOptions() (options []Option) {
+
+	options = append(options, Option{Name: "Cumulative", Value: "cumulative"})
+	options = append(options, Option{Name: "Daily", Value: "daily"})
+
+	return options
+}
+
+// StrategyOptions returns a set of options for automatic selection of comparisons
+func StrategyOptions() (options []Option) {
+
+	options = append(options, Option{Name: "Default Comparisons", Value: ""})
+	options = append(options, Option{Name: "Nearest Areas", Value: StrategyNearest})
+	options = append(options, Option{Name: "Similar Population", Value: StrategyPopulation})
+	options = append(options, Option{Name: "Similar Trajectory", Value: StrategyTrajectory})
+
+	return options
+}
+
+// CompareOptions uses the default store to fetch options for comparison selection
+func CompareOptions() (options []Option) {
+	return defaultStore.Current().CompareOptions()
+}
+
+// CountryOptions uses the default store to fetch country options
 func CountryOptions() (options []Option) {
-	mutex.RLock()
-	defer mutex.RUnlock()
-	return dataset.CountryOptions()
+	return defaultStore.Current().CountryOptions()
 }
 
-// ProvinceOptions uses our stored dataset to fetch province options for a country
+// ProvinceOptions uses the default store to fetch province options for a country
 func ProvinceOptions(country string) (options []Option) {
-	mutex.RLock()
-	defer mutex.RUnlock()
-	return dataset.ProvinceOptions(country)
+	return defaultStore.Current().ProvinceOptions(country)
 }
@@ -0,0 +1,350 @@
+package series
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// priorityHeader is the header row of the priorities file
+const priorityHeader = "country,province,metric,sources,max_age_hours"
+
+// decisionHeader is the header row of the decisions file
+const decisionHeader = "time,area_id,metric,source,reason"
+
+// priorityMaxAge is the time after which a source which has not reported a value for an area is stale
+// if not set for a rule in the priorities file
+const priorityMaxAge = 48 * time.Hour
+
+// priorityRule sets the sources used for a metric in matching areas, in order of preference
+// country, province and metric match any value if "*"
+type priorityRule struct {
+	country  string
+	province string
+	metric   string
+	sources  []string
+	maxAge   time.Duration
+}
+
+// match returns true if the rule applies to metric in series
+func (r priorityRule) match(series *Data, metric int) bool {
+	return (r.country == "*" || series.MatchCountry(r.country)) &&
+		(r.province == "*" || series.MatchProvince(r.province)) &&
+		(r.metric == "*" || r.metric == journalMetrics[metric])
+}
+
+// rank returns the position of source in the rule sources, or -1 if not found
+func (r priorityRule) rank(source string) int {
+	for i, s := range r.sources {
+		if s == source {
+			return i
+		}
+	}
+	return -1
+}
+
+// Decision records which source is used for a metric in an area, and why
+type Decision struct {
+	Time   time.Time
+	AreaID int
+	Metric int
+	Source string
+	Reason string
+}
+
+// priorityKey identifies a metric in an area
+type priorityKey struct {
+	areaID int
+	metric int
+}
+
+// sourceKey identifies a metric in an area reported by a source
+type sourceKey struct {
+	source string
+	priorityKey
+}
+
+// Priorities decides which source's values are used for each metric in each area
+// a source is used if no source preferred to it for the area has reported a value within the max age
+// areas without a matching rule use values from every source, and fallback values from a source
+// only fill gaps unless the source is listed for the area
+// changes in the source used are appended to the decisions file, for auditing
+type Priorities struct {
+	// DecisionsPath is the path of the decisions file, decisions are not recorded if blank
+	DecisionsPath string
+
+	rules []priorityRule
+
+	mutex     sync.Mutex
+	seen      map[sourceKey]time.Time
+	decisions map[priorityKey]Decision
+}
+
+// NewPriorities returns priorities with no rules
+func NewPriorities() *Priorities {
+	return &Priorities{
+		seen:      make(map[sourceKey]time.Time),
+		decisions: make(map[priorityKey]Decision),
+	}
+}
+
+// LoadPriorities loads priority rules from the csv file at p, with the format:
+// country, province, metric, sources, max_age_hours
+// sources are source names separated by spaces, in order of preference
+// the file is optional, if missing there are no rules
+func LoadPriorities(p string) (*Priorities, error) {
+	priorities := NewPriorities()
+
+	data, err := os.ReadFile(p)
+	if os.IsNotExist(err) {
+		return priorities, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	log.Printf("data: loading file at path:%v", p)
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = 5
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("series: failed to read priorities:%s error:%s", p, err)
+	}
+
+	for i, row := range rows {
+		if i == 0 {
+			if strings.Join(row, ",") != priorityHeader {
+				return nil, fmt.Errorf("series: invalid header row in priorities:%s row:%s", p, row)
+			}
+			continue
+		}
+
+		rule := priorityRule{
+			country:  row[0],
+			province: row[1],
+			metric:   row[2],
+			sources:  strings.Fields(row[3]),
+			maxAge:   priorityMaxAge,
+		}
+		if len(rule.sources) == 0 {
+			return nil, fmt.Errorf("series: no sources in priorities:%s row:%s", p, row)
+		}
+		if rule.metric != "*" && metricForName(rule.metric) == DataNone {
+			return nil, fmt.Errorf("series: invalid metric in priorities:%s row:%s", p, row)
+		}
+		if row[4] != "" {
+			hours, err := strconv.Atoi(row[4])
+			if err != nil {
+				return nil, fmt.Errorf("series: invalid max age in priorities:%s row:%s", p, row)
+			}
+			rule.maxAge = time.Duration(hours) * time.Hour
+		}
+		priorities.rules = append(priorities.rules, rule)
+	}
+
+	return priorities, nil
+}
+
+// LoadDecisions restores the last decision for each area and metric from the decisions file (if any)
+// the source last used for each is treated as having reported at now, so that after a restart
+// it is used until it has had the max age to report again, rather than falling back at once
+func (p *Priorities) LoadDecisions(now time.Time) error {
+	if p.DecisionsPath == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(p.DecisionsPath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = 5
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return fmt.Errorf("series: failed to read decisions:%s error:%s", p.DecisionsPath, err)
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for i, row := range rows {
+		if i == 0 {
+			continue
+		}
+		d := Decision{Metric: metricForName(row[2]), Source: row[3], Reason: row[4]}
+		d.Time, err = time.Parse(time.RFC3339, row[0])
+		if err == nil {
+			d.AreaID, err = strconv.Atoi(row[1])
+		}
+		if err != nil || d.Metric == DataNone {
+			return fmt.Errorf("series: invalid row in decisions:%s row:%s", p.DecisionsPath, row)
+		}
+		key := priorityKey{d.AreaID, d.Metric}
+		p.decisions[key] = d
+	}
+	for key, d := range p.decisions {
+		p.seen[sourceKey{d.Source, key}] = now
+	}
+
+	return nil
+}
+
+// refresh records source as having reported at now every area and metric it has reported before
+// this is used when a source reports that its data has not changed since it was last fetched
+func (p *Priorities) refresh(source string, now time.Time) {
+	if p == nil {
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for key := range p.seen {
+		if key.source == source {
+			p.seen[key] = now
+		}
+	}
+}
+
+// replayCopy returns priorities with the same rules, but nothing seen and no decisions recorded
+// so that sources are resolved as they were when payloads were fetched
+func (p *Priorities) replayCopy() *Priorities {
+	c := NewPriorities()
+	c.rules = p.rules
+	return c
+}
+
+// rule returns the first rule matching metric in series, or false if none match
+func (p *Priorities) rule(series *Data, metric int) (priorityRule, bool) {
+	for _, r := range p.rules {
+		if r.match(series, metric) {
+			return r, true
+		}
+	}
+	return priorityRule{}, false
+}
+
+// resolve returns the observations from source which should be used, given the sources which have reported
+// values for each area and metric recently, observations for unknown areas are returned unchanged
+// observations used because a rule lists source are never fallback values, as the rule takes precedence
+// source is first recorded as having reported every area and metric in observations at now
+func (p *Priorities) resolve(index *Index, source string, observations []Observation, now time.Time) []Observation {
+	if p == nil || len(p.rules) == 0 {
+		return observations
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	// Find the series for each observation once, and record the source has reported them
+	found := make([]*Data, len(observations))
+	for i, o := range observations {
+		series, err := index.FetchSeries(o.Country, o.Province)
+		if err != nil {
+			continue
+		}
+		found[i] = series
+		p.seen[sourceKey{source, priorityKey{series.ID, o.DataKind}}] = now
+	}
+
+	// Decide whether to use source for each area and metric, observations are often for many days
+	use := make(map[priorityKey]bool)
+	listed := make(map[priorityKey]bool)
+	var decisions []Decision
+	var accepted []Observation
+	for i, o := range observations {
+		series := found[i]
+		if series == nil {
+			accepted = append(accepted, o)
+			continue
+		}
+
+		key := priorityKey{series.ID, o.DataKind}
+		ok, decided := use[key]
+		if !decided {
+			var d Decision
+			ok, d = p.decide(series, o.DataKind, source, now)
+			use[key] = ok
+			listed[key] = ok && d.Source == source
+			if d.Source != "" && (d.Source != p.decisions[key].Source || d.Reason != p.decisions[key].Reason) {
+				p.decisions[key] = d
+				decisions = append(decisions, d)
+			}
+		}
+		if ok {
+			if listed[key] {
+				o.Fallback = false
+			}
+			accepted = append(accepted, o)
+		}
+	}
+
+	p.record(decisions)
+	return accepted
+}
+
+// decide returns whether source should be used for metric in series, and the decision made
+// the most preferred source which has reported within the max age is used, or source if it is listed and none have
+// the decision is blank if there is no rule for the area and metric, or no listed source is used
+func (p *Priorities) decide(series *Data, metric int, source string, now time.Time) (bool, Decision) {
+	rule, ok := p.rule(series, metric)
+	if !ok {
+		return true, Decision{}
+	}
+
+	candidates := rule.sources
+	if rank := rule.rank(source); rank >= 0 {
+		candidates = rule.sources[:rank+1]
+	}
+
+	var stale []string
+	for _, candidate := range candidates {
+		last := p.seen[sourceKey{candidate, priorityKey{series.ID, metric}}]
+		if candidate == source || (!last.IsZero() && now.Sub(last) <= rule.maxAge) {
+			d := Decision{Time: now, AreaID: series.ID, Metric: metric, Source: candidate, Reason: "preferred"}
+			if len(stale) > 0 {
+				d.Reason = fmt.Sprintf("fallback stale:%s", strings.Join(stale, " "))
+			}
+			return candidate == source, d
+		}
+		stale = append(stale, candidate)
+	}
+
+	return false, Decision{}
+}
+
+// record appends decisions to the decisions file, failures are logged only
+func (p *Priorities) record(decisions []Decision) {
+	if len(decisions) == 0 || p.DecisionsPath == "" {
+		return
+	}
+
+	var buf bytes.Buffer
+	for _, d := range decisions {
+		log.Printf("series: using source:%s for area:%d metric:%s reason:%s", d.Source, d.AreaID, journalMetrics[d.Metric], d.Reason)
+		fmt.Fprintf(&buf, "%s,%d,%s,%s,%s\n", d.Time.UTC().Format(time.RFC3339), d.AreaID, journalMetrics[d.Metric], d.Source, d.Reason)
+	}
+
+	err := appendFile(p.DecisionsPath, decisionHeader+"\n", buf.Bytes())
+	if err != nil {
+		log.Printf("series: failed to record source decisions:%s", err)
+	}
+}
+
+// SetPriorities sets the priorities used by the default store, see Store.SetPriorities
+func SetPriorities(p *Priorities) {
+	defaultStore.SetPriorities(p)
+}
+
+// SetPriorities sets priorities used to decide which sources are used by UpdateFromSource and Replay
+func (s *Store) SetPriorities(p *Priorities) {
+	s.updateMutex.Lock()
+	defer s.updateMutex.Unlock()
+	s.priorities = p
+}
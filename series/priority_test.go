@@ -0,0 +1,106 @@
+package series
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPriorities(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "priorities.csv")
+	err := os.WriteFile(p, []byte(priorityHeader+"\nTestland,,*,uk jhu,48\n"), 0644)
+	if err != nil {
+		t.Fatalf("priorities: failed to write file:%s", err)
+	}
+	priorities, err := LoadPriorities(p)
+	if err != nil || len(priorities.rules) != 1 {
+		t.Fatalf("priorities: failed to load got:%v %v", priorities, err)
+	}
+	priorities.DecisionsPath = filepath.Join(dir, "decisions.csv")
+
+	slice := Slice{{ID: 1, Country: "Testland"}, {ID: 2, Country: "Otherland"}}
+	index := slice.Index()
+	observations := []Observation{
+		{Country: "Testland", DataKind: DataDeaths, Value: 1},
+		{Country: "Otherland", DataKind: DataDeaths, Value: 1},
+	}
+
+	start := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		source string
+		at     time.Time
+		want   int
+	}{
+		{"jhu", start, 2},                      // fallback, uk has not reported
+		{"uk", start.Add(time.Hour), 2},        // preferred
+		{"jhu", start.Add(2 * time.Hour), 1},   // uk is used for Testland
+		{"ecdc", start.Add(2 * time.Hour), 1},  // not listed for Testland
+		{"jhu", start.Add(60 * time.Hour), 2},  // fallback, uk is stale
+		{"ecdc", start.Add(60 * time.Hour), 1}, // not listed, jhu is still used
+		{"uk", start.Add(61 * time.Hour), 2},   // preferred again
+	}
+	for i, tc := range tests {
+		accepted := priorities.resolve(index, tc.source, observations, tc.at)
+		if len(accepted) != tc.want {
+			t.Errorf("priorities: %d wrong observations for source:%s want:%d got:%v", i, tc.source, tc.want, accepted)
+		}
+	}
+
+	data, err := os.ReadFile(priorities.DecisionsPath)
+	if err != nil {
+		t.Fatalf("priorities: failed to read decisions:%s", err)
+	}
+	rows := strings.Split(strings.TrimSpace(string(data)), "\n")
+	want := []string{
+		decisionHeader,
+		"2020-05-01T12:00:00Z,1,deaths,jhu,fallback stale:uk",
+		"2020-05-01T13:00:00Z,1,deaths,uk,preferred",
+		"2020-05-04T00:00:00Z,1,deaths,jhu,fallback stale:uk",
+		"2020-05-04T01:00:00Z,1,deaths,uk,preferred",
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("priorities: wrong decisions got:%v", rows)
+	}
+	for i, row := range want {
+		if rows[i] != row {
+			t.Errorf("priorities: wrong decision want:%s got:%s", row, rows[i])
+		}
+	}
+
+	// After a restart the source last used is kept until it has had the max age to report again
+	restarted, err := LoadPriorities(p)
+	if err != nil {
+		t.Fatalf("priorities: failed to reload:%s", err)
+	}
+	restarted.DecisionsPath = priorities.DecisionsPath
+	restart := start.Add(100 * time.Hour)
+	err = restarted.LoadDecisions(restart)
+	if err != nil {
+		t.Fatalf("priorities: failed to load decisions:%s", err)
+	}
+	if len(restarted.resolve(index, "jhu", observations, restart.Add(time.Hour))) != 1 {
+		t.Errorf("priorities: fallback used after restart")
+	}
+
+	// Sources with data not modified are not stale
+	restarted.refresh("uk", restart.Add(40*time.Hour))
+	if len(restarted.resolve(index, "jhu", observations, restart.Add(60*time.Hour))) != 1 {
+		t.Errorf("priorities: fallback used after refresh")
+	}
+	if len(restarted.resolve(index, "jhu", observations, restart.Add(90*time.Hour))) != 2 {
+		t.Errorf("priorities: fallback not used when stale")
+	}
+
+	// Invalid metrics are rejected
+	err = os.WriteFile(p, []byte(priorityHeader+"\nTestland,,cases,uk,\n"), 0644)
+	if err != nil {
+		t.Fatalf("priorities: failed to write file:%s", err)
+	}
+	_, err = LoadPriorities(p)
+	if err == nil {
+		t.Errorf("priorities: expected error for invalid metric")
+	}
+}
@@ -0,0 +1,199 @@
+package series
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Quality stores a data quality report for one area
+type Quality struct {
+	Series *Data
+
+	// MissingDays counts days with no data after data for this area started
+	MissingDays int
+
+	// NegativeDeltas counts days on which a cumulative total decreased
+	NegativeDeltas int
+
+	// StaleDays counts days at the end of the series with no change in confirmed cases
+	StaleDays int
+
+	// Revisions counts days with a sudden jump much larger than the recent daily average
+	Revisions int
+
+	// ProvinceMismatch is the fractional difference between province sums and the country total
+	// it is 0 for areas without provinces
+	ProvinceMismatch float64
+
+	// UpdatedAt is the last time this area was updated from a source (may be zero)
+	UpdatedAt time.Time
+
+	// Score is the overall score from 0 (worst) to 100 (best)
+	Score int
+
+	// Issues is a list of issues found for display
+	Issues []string
+}
+
+// Grade returns a letter grade for this score
+func (q *Quality) Grade() string {
+	switch {
+	case q.Score >= 90:
+		return "A"
+	case q.Score >= 75:
+		return "B"
+	case q.Score >= 60:
+		return "C"
+	case q.Score >= 40:
+		return "D"
+	}
+	return "F"
+}
+
+// BadgeClass returns a css class for the badge shown for this score
+func (q *Quality) BadgeClass() string {
+	return "quality_" + q.Grade()
+}
+
+// ProvinceMismatchDisplay returns the province mismatch as a percentage for display
+func (q *Quality) ProvinceMismatchDisplay() string {
+	return fmt.Sprintf("%.0f%%", q.ProvinceMismatch*100)
+}
+
+// deduct subtracts from the score for an issue, up to max, and records the issue
+func (q *Quality) deduct(count, each, max int, issue string) {
+	if count == 0 {
+		return
+	}
+	d := count * each
+	if d > max {
+		d = max
+	}
+	q.Score -= d
+	q.Issues = append(q.Issues, issue)
+}
+
+// Quality returns a data quality report for the series given at time now
+// the slice is used to compare province sums with country totals
+func (slice Slice) Quality(s *Data, now time.Time) *Quality {
+	q := &Quality{
+		Series:    s,
+		UpdatedAt: s.UpdatedAt,
+		Score:     100,
+	}
+
+	// Ignore the last day as it is updated throughout the day
+	days := s.Count()
+	if days > 1 {
+		days--
+	}
+
+	started := false
+	for i := 0; i < days; i++ {
+		day := s.Day(i)
+		if !started {
+			started = !day.IsZero()
+			continue
+		}
+
+		// Days with no data after the series started are missing
+		if day.IsZero() {
+			q.MissingDays++
+			continue
+		}
+
+		previous := s.Day(i - 1)
+		if previous.IsZero() {
+			continue
+		}
+
+		// Cumulative totals should never decrease
+		if day.Deaths < previous.Deaths || day.Confirmed < previous.Confirmed {
+			q.NegativeDeltas++
+		}
+
+		// Sudden revisions show as a jump far above the average of the previous week
+		if i >= 8 {
+			delta := day.Confirmed - previous.Confirmed
+			average := (previous.Confirmed - s.Value(i-8, DataConfirmed)) / 7
+			if delta > 100 && delta > average*10 {
+				q.Revisions++
+			}
+		}
+	}
+
+	// Count days at the end of the series without change for areas with cases
+	confirmed := s.Confirmed()
+	for i := days - 1; i > 0 && confirmed[i] > 0; i-- {
+		if confirmed[i] != confirmed[i-1] {
+			break
+		}
+		q.StaleDays++
+	}
+
+	q.ProvinceMismatch = slice.provinceMismatch(s)
+
+	q.deduct(q.MissingDays, 2, 20, fmt.Sprintf("%d missing days", q.MissingDays))
+	q.deduct(q.NegativeDeltas, 5, 25, fmt.Sprintf("%d days with falling totals", q.NegativeDeltas))
+	// Allow a couple of days without change for small areas
+	if q.StaleDays > 2 {
+		q.deduct(q.StaleDays, 3, 15, fmt.Sprintf("no change for %d days", q.StaleDays))
+	}
+	q.deduct(q.Revisions, 3, 15, fmt.Sprintf("%d sudden revisions", q.Revisions))
+	if q.ProvinceMismatch > 0.05 {
+		q.deduct(1, 15, 15, fmt.Sprintf("provinces differ from total by %.0f%%", q.ProvinceMismatch*100))
+	}
+
+	// Check source freshness - update times are not stored, so are unknown until updated after a restart
+	// and stale data is found by days without change instead
+	if !q.UpdatedAt.IsZero() && now.Sub(q.UpdatedAt) > 48*time.Hour {
+		q.deduct(1, 10, 10, fmt.Sprintf("not updated since %s", q.UpdatedAt.Format("2006-01-02")))
+	}
+
+	return q
+}
+
+// provinceMismatch returns the fractional difference between the sum of confirmed cases in provinces
+// and the country total, or 0 if the country has no provinces or no cases
+func (slice Slice) provinceMismatch(country *Data) float64 {
+	if !country.IsCountry() || country.LastDay().Confirmed == 0 {
+		return 0
+	}
+
+	var sum, count int
+	for _, s := range slice {
+		if s.IsProvince() && s.Country == country.Country {
+			sum += s.LastDay().Confirmed
+			count++
+		}
+	}
+
+	// Countries without provinces, or with only a few outlying territories, are not compared
+	if count == 0 || sum == 0 || sum*10 < country.LastDay().Confirmed {
+		return 0
+	}
+
+	total := country.LastDay().Confirmed
+	diff := float64(sum - total)
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff / float64(total)
+}
+
+// QualityReports returns quality reports for every area, worst first
+func (slice Slice) QualityReports(now time.Time) (reports []*Quality) {
+	for _, s := range slice {
+		if s.IsGlobal() {
+			continue
+		}
+		reports = append(reports, slice.Quality(s, now))
+	}
+
+	sort.SliceStable(reports, func(i, j int) bool {
+		return reports[i].Score < reports[j].Score
+	})
+
+	return reports
+}
@@ -0,0 +1,61 @@
+package series
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQuality(t *testing.T) {
+	now := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	good := &Data{ID: 2, Country: "Goodland", UpdatedAt: now.Add(-time.Hour)}
+	good.AddDays(30)
+	for i := 0; i < good.Count(); i++ {
+		good.SetValue(i, DataConfirmed, (i+1)*10)
+		good.SetValue(i, DataDeaths, i)
+	}
+
+	bad := &Data{ID: 3, Country: "Badland", UpdatedAt: now.AddDate(0, 0, -3)}
+	bad.AddDays(30)
+	for i := 0; i < bad.Count(); i++ {
+		bad.SetValue(i, DataConfirmed, (i+1)*10)
+	}
+	bad.SetValue(10, DataConfirmed, 0)     // missing day
+	bad.SetValue(15, DataConfirmed, 100)   // falling total
+	bad.SetValue(20, DataConfirmed, 10000) // revision
+	for i := 21; i < bad.Count(); i++ {
+		bad.SetValue(i, DataConfirmed, 10000) // stale
+	}
+
+	slice := Slice{{ID: 1}, good, bad}
+
+	q := slice.Quality(good, now)
+	if q.Score != 100 || q.Grade() != "A" {
+		t.Errorf("quality: good series wrong score:%d issues:%v", q.Score, q.Issues)
+	}
+
+	// An update time not recorded (for example after a restart) is not a quality issue, an old one is
+	good.UpdatedAt = time.Time{}
+	q = slice.Quality(good, now)
+	if q.Score != 100 {
+		t.Errorf("quality: good series without update time wrong score:%d issues:%v", q.Score, q.Issues)
+	}
+	good.UpdatedAt = now.AddDate(0, 0, -3)
+	q = slice.Quality(good, now)
+	if q.Score != 90 {
+		t.Errorf("quality: good series not updated wrong score:%d issues:%v", q.Score, q.Issues)
+	}
+
+	q = slice.Quality(bad, now)
+	if q.MissingDays != 1 || q.NegativeDeltas != 1 || q.Revisions != 1 || q.StaleDays != 8 {
+		t.Errorf("quality: bad series wrong report:%+v", q)
+	}
+	if q.Score >= 75 {
+		t.Errorf("quality: bad series score too high:%d issues:%v", q.Score, q.Issues)
+	}
+
+	reports := slice.QualityReports(now)
+	if len(reports) != 2 || reports[0].Series != bad {
+		t.Errorf("quality: wrong reports order:%v", reports)
+	}
+}
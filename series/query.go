@@ -1,28 +1,182 @@
 package series
 
-// FetchSeries uses our stored dataset to fetch a series
+import (
+	"time"
+)
+
+// MaxComparisons is the maximum number of series which may be compared at once
+const MaxComparisons = 20
+
+// FetchSeries uses the default store to fetch a series
 func FetchSeries(country string, province string) (*Data, error) {
-	mutex.RLock()
-	defer mutex.RUnlock()
-	return dataset.FetchSeries(country, province)
+	return defaultStore.FetchSeries(country, province)
 }
 
-// FindSeries uses our stored dataset to fetch a series by series id
+// FindSeries uses the default store to fetch a series by series id
 func FindSeries(seriesID int) (*Data, error) {
-	mutex.RLock()
-	defer mutex.RUnlock()
-	return dataset.FindSeries(seriesID)
+	return defaultStore.FindSeries(seriesID)
 }
 
-// SelectedEuropeanSeries selects a set of comparative series of interest from Europe
+// CompareSeries uses the default store to fetch series for a list of keys, see Slice.CompareSeries
+func CompareSeries(keys []string) (Slice, error) {
+	return defaultStore.CompareSeries(keys)
+}
+
+// SimilarSeries uses the default store to select n comparators for country and province using strategy
+// see Slice.SimilarSeries for strategies available
+func SimilarSeries(country, province, strategy string, n int) ([]*Comparator, error) {
+	return defaultStore.SimilarSeries(country, province, strategy, n)
+}
+
+// QualityReport uses the default store to return a data quality report for country and province
+func QualityReport(country, province string) (*Quality, error) {
+	return defaultStore.QualityReport(country, province)
+}
+
+// WorstQuality uses the default store to return the n areas with the worst data quality
+func WorstQuality(n int) []*Quality {
+	return defaultStore.WorstQuality(n)
+}
+
+// SelectedEuropeanSeries uses the default store to select comparative series from Europe
 func SelectedEuropeanSeries(country string, n int) Slice {
-	mutex.RLock()
-	defer mutex.RUnlock()
+	return defaultStore.SelectedEuropeanSeries(country, n)
+}
+
+// SelectedSeries uses the default store to select a set of comparative series of interest
+func SelectedSeries(country string, n int) Slice {
+	return defaultStore.SelectedSeries(country, n)
+}
 
+// TopSeriesGlobal uses the default store to select the top n series by deaths for global page
+func TopSeriesGlobal(country string, n int) Slice {
+	return defaultStore.TopSeriesGlobal(country, n)
+}
+
+// TopSeries uses the default store to select the top n series by deaths
+func TopSeries(country string, n int) Slice {
+	return defaultStore.TopSeries(country, n)
+}
+
+// LockdownEffects uses the default store to return estimates of the effect of lockdowns
+// and other interventions on growth in dataKind for all areas, see Slice.LockdownEffects
+func LockdownEffects(dataKind, window, lag int) []*Effect {
+	return defaultStore.LockdownEffects(dataKind, window, lag)
+}
+
+// DataSet - REMOVE AFTER SETUP FIXME - use Current instead
+func DataSet() Slice {
+	return Current()
+}
+
+// FetchSeries fetches a series from the current dataset
+func (s *Store) FetchSeries(country string, province string) (*Data, error) {
+	return s.Index().FetchSeries(country, province)
+}
+
+// FindSeries fetches a series from the current dataset by series id
+func (s *Store) FindSeries(seriesID int) (*Data, error) {
+	return s.Index().FindSeries(seriesID)
+}
+
+// CompareSeries fetches series from the current dataset for a list of keys, see Slice.CompareSeries
+func (s *Store) CompareSeries(keys []string) (Slice, error) {
+	return s.Index().CompareSeries(keys)
+}
+
+// SimilarSeries selects n comparators from the current dataset for country and province using strategy
+func (s *Store) SimilarSeries(country, province, strategy string, n int) ([]*Comparator, error) {
+	index := s.Index()
+	series, err := index.FetchSeries(country, province)
+	if err != nil {
+		return nil, err
+	}
+	return index.Slice().SimilarSeries(series, strategy, n)
+}
+
+// QualityReport returns a data quality report from the current dataset for country and province
+func (s *Store) QualityReport(country, province string) (*Quality, error) {
+	index := s.Index()
+	series, err := index.FetchSeries(country, province)
+	if err != nil {
+		return nil, err
+	}
+	return index.Slice().Quality(series, time.Now().UTC()), nil
+}
+
+// WorstQuality returns the n areas in the current dataset with the worst data quality
+func (s *Store) WorstQuality(n int) []*Quality {
+	return s.Current().WorstQuality(n)
+}
+
+// SelectedEuropeanSeries selects comparative series from Europe in the current dataset
+func (s *Store) SelectedEuropeanSeries(country string, n int) Slice {
+	return s.Current().SelectedEuropeanSeries(country, n)
+}
+
+// SelectedSeries selects a set of comparative series of interest from the current dataset
+func (s *Store) SelectedSeries(country string, n int) Slice {
+	return s.Index().SelectedSeries(country, n)
+}
+
+// TopSeriesGlobal selects the top n series by deaths in the current dataset for global page
+func (s *Store) TopSeriesGlobal(country string, n int) Slice {
+	return s.Current().TopSeriesGlobal(country, n)
+}
+
+// TopSeries selects the top n series by deaths in the current dataset
+func (s *Store) TopSeries(country string, n int) Slice {
+	return s.Current().TopSeries(country, n)
+}
+
+// LockdownEffects returns estimates of the effect of interventions in the current dataset
+func (s *Store) LockdownEffects(dataKind, window, lag int) []*Effect {
+	return s.Current().LockdownEffects(dataKind, window, lag)
+}
+
+// CompareSeries fetches the series for a list of keys in the form country or country/province
+// for example italy, us/new-york - duplicates are ignored and an error is returned
+// listing any keys which could not be found
+func (slice Slice) CompareSeries(keys []string) (Slice, error) {
+	return slice.Index().CompareSeries(keys)
+}
+
+// SimilarSeriesFor selects n comparators for the series for country and province using strategy
+// see Slice.SimilarSeries for strategies available
+func (slice Slice) SimilarSeriesFor(country, province, strategy string, n int) ([]*Comparator, error) {
+	s, err := slice.FetchSeries(country, province)
+	if err != nil {
+		return nil, err
+	}
+
+	return slice.SimilarSeries(s, strategy, n)
+}
+
+// QualityReport returns a data quality report for the series for country and province
+func (slice Slice) QualityReport(country, province string) (*Quality, error) {
+	s, err := slice.FetchSeries(country, province)
+	if err != nil {
+		return nil, err
+	}
+
+	return slice.Quality(s, time.Now().UTC()), nil
+}
+
+// WorstQuality returns the n areas with the worst data quality
+func (slice Slice) WorstQuality(n int) []*Quality {
+	reports := slice.QualityReports(time.Now().UTC())
+	if len(reports) > n {
+		reports = reports[:n]
+	}
+	return reports
+}
+
+// SelectedEuropeanSeries selects a set of comparative series of interest from Europe
+func (slice Slice) SelectedEuropeanSeries(country string, n int) Slice {
 	// Fetch all top series
 	var count int
 	var collection Slice
-	for _, s := range dataset {
+	for _, s := range slice {
 		if count >= n {
 			break
 		}
@@ -52,22 +206,37 @@ func SelectedEuropeanSeries(country string, n int) Slice {
 
 }
 
+// SelectedSeries selects a set of comparative series of interest from the slice indexed
+// this uses the index to find the country, see Slice.SelectedSeries
+func (index *Index) SelectedSeries(country string, n int) Slice {
+	countrySeries, err := index.FetchSeries(country, "")
+	if err != nil {
+		countrySeries = nil
+	}
+	return index.Slice().selectedSeries(countrySeries, n)
+}
+
 // SelectedSeries selects a set of comparative series of interest
-func SelectedSeries(country string, n int) Slice {
-	mutex.RLock()
-	defer mutex.RUnlock()
+func (slice Slice) SelectedSeries(country string, n int) Slice {
+	countrySeries, err := slice.FetchSeries(country, "")
+	if err != nil {
+		countrySeries = nil
+	}
+	return slice.selectedSeries(countrySeries, n)
+}
 
+// selectedSeries selects countrySeries (if not nil) and up to n comparative series of interest
+func (slice Slice) selectedSeries(countrySeries *Data, n int) Slice {
 	var count int
 	var collection Slice
 
 	// Always include this country in the selected series
-	countrySeries, err := FetchSeries(country, "")
-	if err == nil {
+	if countrySeries != nil {
 		collection = append(collection, countrySeries)
 	}
 
 	// Fetch all top series
-	for _, s := range dataset {
+	for _, s := range slice {
 		if count >= n {
 			break
 		}
@@ -113,14 +282,11 @@ func SelectedSeries(country string, n int) Slice {
 }
 
 // TopSeriesGlobal selects the top n series by deaths for global page
-func TopSeriesGlobal(country string, n int) Slice {
-	mutex.RLock()
-	defer mutex.RUnlock()
-
+func (slice Slice) TopSeriesGlobal(country string, n int) Slice {
 	// Fetch all top series
 	var count int
 	var collection Slice
-	for _, s := range dataset {
+	for _, s := range slice {
 		if count >= n {
 			break
 		}
@@ -146,14 +312,11 @@ func TopSeriesGlobal(country string, n int) Slice {
 }
 
 // TopSeries selects the top n series by deaths
-func TopSeries(country string, n int) Slice {
-	mutex.RLock()
-	defer mutex.RUnlock()
-
+func (slice Slice) TopSeries(country string, n int) Slice {
 	// Fetch all top series
 	var count int
 	var collection Slice
-	for _, s := range dataset {
+	for _, s := range slice {
 		if count >= n {
 			break
 		}
@@ -169,8 +332,3 @@ func TopSeries(country string, n int) Slice {
 
 	return collection
 }
-
-// DataSet - REMOVE AFTER SETUP FIXME this is not thread safe - it is only called to construct initial series data from JHU historical data
-func DataSet() Slice {
-	return dataset
-}
@@ -0,0 +1,33 @@
+package series
+
+import (
+	"testing"
+)
+
+func TestCompareSeries(t *testing.T) {
+	store := NewStore()
+	store.publish(Slice{
+		{ID: 1},
+		{ID: 2, Country: "Italy"},
+		{ID: 3, Country: "US"},
+		{ID: 4, Country: "US", Province: "New York"},
+	})
+
+	comparisons, err := store.CompareSeries([]string{"italy", "us/new-york", "Italy", ""})
+	if err != nil {
+		t.Fatalf("compare: failed to fetch series:%s", err)
+	}
+	if len(comparisons) != 2 || comparisons[0].ID != 2 || comparisons[1].ID != 4 {
+		t.Fatalf("compare: wrong series got:%v", comparisons)
+	}
+
+	keys := comparisons.Keys()
+	if keys[0] != "italy" || keys[1] != "us/new-york" {
+		t.Errorf("compare: wrong keys got:%v", keys)
+	}
+
+	_, err = store.CompareSeries([]string{"italy", "atlantis"})
+	if err == nil {
+		t.Errorf("compare: expected error for invalid series")
+	}
+}
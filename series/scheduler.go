@@ -0,0 +1,239 @@
+package series
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Defaults for jobs added to a scheduler
+const (
+	jobBackoff    = time.Minute // delay before the first retry of a failed job
+	jobMaxBackoff = time.Hour   // longest delay between retries, jobs with shorter intervals retry at their interval
+)
+
+// JobStatus records the runs of a scheduled job
+type JobStatus struct {
+	Name     string
+	Interval time.Duration
+	Running  bool
+
+	Runs     int
+	Failures int // consecutive failures, reset by a successful run
+	Skipped  int // runs skipped because the job was still running
+
+	LastRun      time.Time
+	LastDuration time.Duration
+	LastError    string
+	NextRun      time.Time
+}
+
+// job is a function run by a scheduler at intervals
+type job struct {
+	f        func() error
+	interval time.Duration
+	jitter   time.Duration
+
+	// at is the time the job is next due, before jitter is added, which keeps runs aligned to the first
+	at    time.Time
+	timer *time.Timer
+
+	status JobStatus
+}
+
+// Scheduler runs named jobs at intervals, each job runs at most once at a time
+// jobs which fail are retried with exponential backoff, up to their interval,
+// and a random jitter may be added to scheduled runs so that jobs do not all fetch at once
+type Scheduler struct {
+	// Backoff is the delay before retrying a failed job, doubled for each consecutive failure
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	mutex   sync.Mutex
+	jobs    map[string]*job
+	stopped bool
+	running sync.WaitGroup
+}
+
+// NewScheduler returns a scheduler with no jobs
+func NewScheduler() *Scheduler {
+	return &Scheduler{
+		Backoff:    jobBackoff,
+		MaxBackoff: jobMaxBackoff,
+		jobs:       make(map[string]*job),
+	}
+}
+
+// Add schedules f to run as the named job at first and every interval after, with up to jitter added to each run
+// if first is in the past the job first runs at the next time due, if interval is 0 it runs once only
+func (s *Scheduler) Add(name string, f func() error, first time.Time, interval, jitter time.Duration) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.stopped {
+		return fmt.Errorf("series: scheduler stopped")
+	}
+	if s.jobs[name] != nil {
+		return fmt.Errorf("series: job already scheduled:%s", name)
+	}
+
+	j := &job{
+		f:        f,
+		interval: interval,
+		jitter:   jitter,
+		at:       first,
+		status:   JobStatus{Name: name, Interval: interval},
+	}
+	s.jobs[name] = j
+	s.schedule(j, time.Now().UTC())
+	return nil
+}
+
+// schedule sets the timer for the next run of j after now, the mutex must be held by the caller
+func (s *Scheduler) schedule(j *job, now time.Time) {
+	next := j.at
+	if j.status.Failures > 0 {
+		next = now.Add(s.backoffFor(j))
+	} else {
+		// Keep runs aligned to the first, skipping any missed
+		for j.interval > 0 && !next.After(now) {
+			next = next.Add(j.interval)
+		}
+		if !next.After(now) {
+			next = now
+		}
+		j.at = next
+		if j.jitter > 0 {
+			next = next.Add(time.Duration(rand.Int63n(int64(j.jitter))))
+		}
+	}
+
+	j.status.NextRun = next
+	j.timer = time.AfterFunc(next.Sub(now), func() {
+		s.start(j.status.Name)
+	})
+}
+
+// backoffFor returns the delay before retrying j after its consecutive failures
+// doubling for each failure up to MaxBackoff, or the job interval if shorter
+func (s *Scheduler) backoffFor(j *job) time.Duration {
+	max := s.MaxBackoff
+	if j.interval > 0 && j.interval < max {
+		max = j.interval
+	}
+	d := s.Backoff
+	for i := 1; i < j.status.Failures && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// Run starts the named job now, returning false if it is not found or already running
+// the next run is scheduled when it finishes, as for runs on schedule
+func (s *Scheduler) Run(name string) bool {
+	return s.start(name)
+}
+
+// start runs the named job in a new goroutine unless it is already running or the scheduler has stopped
+// the job timer is stopped while it runs, and set again for the next run when it finishes
+func (s *Scheduler) start(name string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	j := s.jobs[name]
+	if j == nil || s.stopped {
+		return false
+	}
+	if j.status.Running {
+		j.status.Skipped++
+		log.Printf("scheduler: skipped job:%s still running", name)
+		return false
+	}
+
+	if j.timer != nil {
+		j.timer.Stop()
+	}
+	j.status.Running = true
+	j.status.NextRun = time.Time{}
+	s.running.Add(1)
+	go s.run(j)
+	return true
+}
+
+// run calls the job function, records the result and schedules the next run
+func (s *Scheduler) run(j *job) {
+	defer s.running.Done()
+
+	start := time.Now().UTC()
+	err := j.f()
+	end := time.Now().UTC()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	j.status.Running = false
+	j.status.Runs++
+	j.status.LastRun = start
+	j.status.LastDuration = end.Sub(start)
+	j.status.LastError = ""
+	if err != nil {
+		j.status.Failures++
+		j.status.LastError = err.Error()
+		log.Printf("scheduler: job:%s failed:%s", j.status.Name, err)
+	} else {
+		j.status.Failures = 0
+	}
+
+	if s.stopped || (j.interval == 0 && err == nil) {
+		return
+	}
+	s.schedule(j, end)
+}
+
+// Stop stops scheduling jobs and waits for running jobs to finish, or ctx to be done
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.mutex.Lock()
+	s.stopped = true
+	for _, j := range s.jobs {
+		if j.timer != nil {
+			j.timer.Stop()
+		}
+		j.status.NextRun = time.Time{}
+	}
+	s.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("series: jobs still running:%s", ctx.Err())
+	}
+}
+
+// Status returns the status of every job, ordered by name
+func (s *Scheduler) Status() []JobStatus {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var status []JobStatus
+	for _, j := range s.jobs {
+		status = append(status, j.status)
+	}
+	sort.Slice(status, func(i, j int) bool {
+		return status[i].Name < status[j].Name
+	})
+	return status
+}
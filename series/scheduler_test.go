@@ -0,0 +1,106 @@
+package series
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitForJob waits until f returns true for the status of the named job, failing the test after a second
+func waitForJob(t *testing.T, s *Scheduler, name string, f func(JobStatus) bool) JobStatus {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		for _, status := range s.Status() {
+			if status.Name == name && f(status) {
+				return status
+			}
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("scheduler: timed out waiting for job:%s got:%v", name, s.Status())
+	return JobStatus{}
+}
+
+func TestSchedulerSingleFlight(t *testing.T) {
+	s := NewScheduler()
+	release := make(chan struct{})
+	first := time.Now().UTC().Add(time.Hour)
+	err := s.Add("slow", func() error { <-release; return nil }, first, time.Hour, 0)
+	if err != nil {
+		t.Fatalf("scheduler: failed to add job:%s", err)
+	}
+	if s.Add("slow", func() error { return nil }, first, time.Hour, 0) == nil {
+		t.Errorf("scheduler: expected error for duplicate job")
+	}
+
+	if !s.Run("slow") || s.Run("slow") || s.Run("missing") {
+		t.Fatalf("scheduler: wrong result for run")
+	}
+	status := s.Status()[0]
+	if !status.Running || status.Skipped != 1 || !status.NextRun.IsZero() {
+		t.Errorf("scheduler: wrong status while running got:%v", status)
+	}
+
+	// The next run stays aligned to the first
+	close(release)
+	status = waitForJob(t, s, "slow", func(j JobStatus) bool { return j.Runs == 1 && !j.Running })
+	if !status.NextRun.Equal(first) || status.LastError != "" {
+		t.Errorf("scheduler: wrong status after run got:%v", status)
+	}
+}
+
+func TestSchedulerBackoff(t *testing.T) {
+	s := NewScheduler()
+	s.Backoff = 5 * time.Millisecond
+	var calls, succeed int32
+	f := func() error {
+		atomic.AddInt32(&calls, 1)
+		if atomic.LoadInt32(&succeed) == 0 {
+			return fmt.Errorf("down")
+		}
+		return nil
+	}
+	first := time.Now().UTC().Add(time.Hour)
+	s.Add("flaky", f, first, time.Hour, time.Minute)
+	s.Run("flaky")
+
+	// Failures are retried sooner than the interval, backing off each time
+	status := waitForJob(t, s, "flaky", func(j JobStatus) bool { return j.Failures >= 3 && !j.Running })
+	if status.LastError != "down" || status.NextRun.Sub(status.LastRun) < 20*time.Millisecond {
+		t.Errorf("scheduler: wrong status after failures got:%v", status)
+	}
+
+	// A success resets failures and returns to the schedule, with jitter
+	atomic.StoreInt32(&succeed, 1)
+	status = waitForJob(t, s, "flaky", func(j JobStatus) bool { return j.Failures == 0 && j.Runs > 0 && !j.Running })
+	if status.NextRun.Before(first) || status.NextRun.After(first.Add(time.Minute)) {
+		t.Errorf("scheduler: wrong next run after success got:%v", status)
+	}
+}
+
+func TestSchedulerStop(t *testing.T) {
+	s := NewScheduler()
+	release := make(chan struct{})
+	s.Add("slow", func() error { <-release; return nil }, time.Now().UTC().Add(time.Hour), time.Hour, 0)
+	s.Run("slow")
+
+	// Stop waits for running jobs until the context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if s.Stop(ctx) == nil {
+		t.Errorf("scheduler: expected error stopping with job running")
+	}
+
+	close(release)
+	err := s.Stop(context.Background())
+	if err != nil {
+		t.Errorf("scheduler: failed to stop:%s", err)
+	}
+	status := s.Status()[0]
+	if s.Run("slow") || status.Runs != 1 || !status.NextRun.IsZero() {
+		t.Errorf("scheduler: job scheduled after stop got:%v", status)
+	}
+}
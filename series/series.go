@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"log"
 	"strconv"
-	"strings"
 	"time"
 )
 
@@ -45,6 +44,12 @@ func NewData(row []string) (*Data, error) {
 
 	color := row[7]
 
+	// The code column is optional
+	var code string
+	if len(row) > 8 {
+		code = row[8]
+	}
+
 	// NB updated at left at zero time
 	s := &Data{
 		ID:         areaID,
@@ -54,8 +59,8 @@ func NewData(row []string) (*Data, error) {
 		Longitude:  longitude,
 		Population: population,
 		Color:      color,
+		Code:       code,
 		LockdownAt: lockdown,
-		Days:       make([]*Day, 0),
 	}
 
 	return s, nil
@@ -82,18 +87,27 @@ type Data struct {
 	// An rgb color/colour for plotting charts
 	Color string
 
+	// A short code used by some sources for the province (if any), for example AK for Alaska
+	Code string
+
 	// UTC Date data last updated
 	UpdatedAt time.Time
 
 	// UTC Date full area lockdown started
 	LockdownAt time.Time
 
-	// Days containing all our data - each day holds cumulative totals
-	Days []*Day
+	// Other interventions recorded for this area (excluding lockdown)
+	Interventions []Intervention
+
+	// start is the date of the first day of data, days are contiguous from this date
+	start time.Time
 
-	// Previous day stores the previous day for this period (if any)
+	// values holds all our data in columns by data kind - each day holds cumulative totals
+	values columns
+
+	// previous stores totals for the day before the first day for a Period (if any)
 	// Used to calculate daily totals when truncated with Period
-	PreviousDay *Day
+	previous [metricCount]int
 }
 
 // Format formats a given number for display and returns a string
@@ -112,11 +126,11 @@ func (d *Data) Format(i int) string {
 // Global returns true if this is the global series
 func (d *Data) String() string {
 	if d.IsGlobal() {
-		return fmt.Sprintf("%s (%d)", "Global", len(d.Days))
+		return fmt.Sprintf("%s (%d)", "Global", d.Count())
 	} else if d.Province == "" {
-		return fmt.Sprintf("%s (%d)", d.Country, len(d.Days))
+		return fmt.Sprintf("%s (%d)", d.Country, d.Count())
 	}
-	return fmt.Sprintf("%s, %s (%d)", d.Province, d.Country, len(d.Days))
+	return fmt.Sprintf("%s, %s (%d)", d.Province, d.Country, d.Count())
 }
 
 // Title returns a display title for this series
@@ -133,12 +147,11 @@ func (d *Data) Title() string {
 // StartsAt retuns a string to display for the first date of the series
 // if no days are available or date is zero date, default start is returned
 func (d *Data) StartsAt() time.Time {
-	day := d.FirstDay()
-	if day.Date.IsZero() {
+	if d.Count() == 0 || d.start.IsZero() {
 		return seriesStartDate
 	}
 
-	return day.Date
+	return d.start
 }
 
 // StartsAtDisplay retuns a string to display for the first date of the series
@@ -192,12 +205,21 @@ func (d *Data) IsProvince() bool {
 // Valid returns true if this series is valid
 // a series without days is considered invalid
 func (d *Data) Valid() bool {
-	return len(d.Days) == 0
+	return d.Count() == 0
 }
 
 // Key converts a value into one suitable for use in urls
 func (d *Data) Key(v string) string {
-	return strings.Replace(strings.ToLower(v), " ", "-", -1)
+	return key(v)
+}
+
+// CompareKey returns a key for this series suitable for use in comparison lists
+// in the form country or country/province, e.g. italy or us/new-york
+func (d *Data) CompareKey() string {
+	if d.IsProvince() {
+		return d.Key(d.Country) + "/" + d.Key(d.Province)
+	}
+	return d.Key(d.Country)
 }
 
 // Match returns true if this series matches country and province
@@ -209,93 +231,87 @@ func (d *Data) Match(country string, province string) bool {
 // MatchCountry return true if this series matches country
 // performs a case insensitive match
 func (d *Data) MatchCountry(country string) bool {
-	return d.Key(d.Country) == d.Key(country)
+	return keyEqual(d.Country, country)
 }
 
 // MatchProvince return true if this series matches province
 // performs a case insensitive match
 func (d *Data) MatchProvince(province string) bool {
-	return d.Key(d.Province) == d.Key(province)
+	return keyEqual(d.Province, province)
 }
 
 // FetchDate returns the datapoint for a given date and dataKind
 func (d *Data) FetchDate(date time.Time, dataKind int) int {
-
-	for _, d := range d.Days {
-		if d.Date.Equal(date) {
-			switch dataKind {
-			case DataDeaths:
-				return d.Deaths
-			case DataConfirmed:
-				return d.Confirmed
-			case DataRecovered:
-				return d.Recovered
-			case DataTested:
-				return d.Tested
-			}
-		}
+	i := d.DayIndex(date)
+	if i < 0 {
+		return 0
 	}
-
-	return 0
+	return d.Value(i, dataKind)
 }
 
 // Period returns a subset of the series data just for the no of days specified
+// the subset shares data with this series, so must not be modified
 func (d *Data) Period(days int) *Data {
 	// If we are not long enough, just return full series
-	if days >= len(d.Days) {
+	if days >= d.Count() {
 		return d
 	}
 
 	// Else return series with truncated days
-	i := len(d.Days) - days
+	i := d.Count() - days
 
 	// Previous is used to calculate daily totals for the first day
 	// on truncated series
-	previous := &Day{}
+	var previous [metricCount]int
 	if i > 0 {
-		previous = d.Days[i-1]
+		for k, values := range d.values {
+			previous[k] = values[i-1]
+		}
 	}
 
 	return &Data{
-		ID:          d.ID,
-		Country:     d.Country,
-		Province:    d.Province,
-		Population:  d.Population,
-		Latitude:    d.Latitude,
-		Longitude:   d.Longitude,
-		Color:       d.Color,
-		UpdatedAt:   d.UpdatedAt,
-		LockdownAt:  d.LockdownAt,
-		Days:        d.Days[i:],
-		PreviousDay: previous,
-	}
-}
-
-// FirstDay returns the last day in the series
+		ID:            d.ID,
+		Country:       d.Country,
+		Province:      d.Province,
+		Population:    d.Population,
+		Latitude:      d.Latitude,
+		Longitude:     d.Longitude,
+		Color:         d.Color,
+		Code:          d.Code,
+		UpdatedAt:     d.UpdatedAt,
+		LockdownAt:    d.LockdownAt,
+		Interventions: d.Interventions,
+		start:         d.Date(i),
+		values:        d.values.view(i),
+		previous:      previous,
+	}
+}
+
+// FirstDay returns the first day in the series
 // a blank day is returned if no days
-func (d *Data) FirstDay() *Day {
-	if len(d.Days) == 0 {
-		return &Day{}
+func (d *Data) FirstDay() Day {
+	if d.Count() == 0 {
+		return Day{}
 	}
-	return d.Days[0]
+	return d.Day(0)
 }
 
 // LastDay returns the last day in the series
 // a blank day is returned if no days
-func (d *Data) LastDay() *Day {
-	if len(d.Days) == 0 {
-		return &Day{}
+func (d *Data) LastDay() Day {
+	if d.Count() == 0 {
+		return Day{}
 	}
-	return d.Days[len(d.Days)-1]
+	return d.Day(d.Count() - 1)
 }
 
 // PenultimateDay returns the second last day in the series
 // a blank day is returned if no days
-func (d *Data) PenultimateDay() *Day {
-	if len(d.Days) < 2 {
-		return &Day{}
+func (d *Data) PenultimateDay() Day {
+	if d.Count() < 2 {
+		return Day{}
 	}
-	return d.Days[len(d.Days)-2]
+	return d.Day(d.Count() - 2)
 }
 
 // TotalDeaths returns the cumulative death due to COVID-19 for this series
@@ -318,6 +334,11 @@ func (d *Data) TotalTested() int {
 	return d.LastDay().Tested - d.FirstDay().Tested
 }
 
+// TotalHospitalised returns the cumulative hospitalised cases of COVID-19 for this series
+func (d *Data) TotalHospitalised() int {
+	return d.LastDay().Hospitalised - d.FirstDay().Hospitalised
+}
+
 // DeathsToday returns deaths for last day in series - day before
 func (d *Data) DeathsToday() int {
 	return d.LastDay().Deaths - d.PenultimateDay().Deaths
@@ -329,61 +350,52 @@ func (d *Data) ConfirmedToday() int {
 }
 
 // Deaths returns cumulative totals of deaths as integer values
-func (d *Data) Deaths() (values []int) {
-	for _, day := range d.Days {
-		values = append(values, day.Deaths)
-	}
-	return values
+// the values are shared with the series and must not be modified
+func (d *Data) Deaths() []int {
+	return d.values[0]
 }
 
 // Confirmed returns cumulative totals of confirmed as integer values
-func (d *Data) Confirmed() (values []int) {
-	for _, day := range d.Days {
-		values = append(values, day.Confirmed)
-	}
-	return values
+// the values are shared with the series and must not be modified
+func (d *Data) Confirmed() []int {
+	return d.values[1]
 }
 
 // Recovered returns cumulative totals of recovered as integer values
-// values are typically 0 if not available
-func (d *Data) Recovered() (values []int) {
-	for _, day := range d.Days {
-		values = append(values, day.Recovered)
-	}
-	return values
+// values are typically 0 if not available, and must not be modified
+func (d *Data) Recovered() []int {
+	return d.values[2]
 }
 
 // Tested returns cumulative totals of Tested as integer values
-// values are typically 0 if not available
-func (d *Data) Tested() (values []int) {
-	for _, day := range d.Days {
-		values = append(values, day.Tested)
-	}
-	return values
+// values are typically 0 if not available, and must not be modified
+func (d *Data) Tested() []int {
+	return d.values[3]
+}
+
+// Hospitalised returns cumulative totals of hospitalised as integer values
+// values are typically 0 if not available, and must not be modified
+func (d *Data) Hospitalised() []int {
+	return d.values[4]
 }
 
 // DeathsDaily returns an array of int values for deaths per day
-func (d *Data) DeathsDaily() (values []int) {
-	var previous int
-	if d.PreviousDay != nil {
-		previous = d.PreviousDay.Deaths
-	}
-	for _, day := range d.Days {
-		values = append(values, day.Deaths-previous)
-		previous = day.Deaths
-	}
-	return values
+func (d *Data) DeathsDaily() []int {
+	return d.daily(0)
 }
 
 // ConfirmedDaily returns an array of int values for confirmed per day
-func (d *Data) ConfirmedDaily() (values []int) {
-	var previous int
-	if d.PreviousDay != nil {
-		previous = d.PreviousDay.Confirmed
-	}
-	for _, day := range d.Days {
-		values = append(values, day.Confirmed-previous)
-		previous = day.Confirmed
+func (d *Data) ConfirmedDaily() []int {
+	return d.daily(1)
+}
+
+// daily returns values per day for the column c, using the previous day for the first day if truncated
+func (d *Data) daily(c int) []int {
+	values := make([]int, d.Count())
+	previous := d.previous[c]
+	for i, v := range d.values[c] {
+		values[i] = v - previous
+		previous = v
 	}
 	return values
 }
@@ -399,26 +411,21 @@ func (d *Data) DaysFrom(values []int) []string {
 	return days
 }
 
-// DeathsFrom returns series after death number n
+// DeathsFrom returns series from the day of death number n (including the last day)
 func (d *Data) DeathsFrom(n int) []int {
-	// Walk through deaths looking for death n, then return series from that day
-	for i, day := range d.Days {
-		if day.Deaths >= n {
-			return d.Deaths()[i : len(d.Days)-1]
-		}
-	}
-	return nil
+	return d.AlignedValues(Alignment{Align: AlignDeaths, Threshold: float64(n), Metric: DataDeaths})
 }
 
 // AverageDeaths returns the average deaths per day over the last 3 days
 func (d *Data) AverageDeaths() int {
 	// If not enough days, return 0
-	if len(d.Days) < 3 {
+	if d.Count() < 3 {
 		return 0
 	}
 
 	// Get deaths over last 3 days
-	sum := d.Days[len(d.Days)-1].Deaths - d.Days[len(d.Days)-3].Deaths
+	deaths := d.Deaths()
+	sum := deaths[len(deaths)-1] - deaths[len(deaths)-3]
 
 	// return simple average
 	return sum / 3
@@ -427,12 +434,13 @@ func (d *Data) AverageDeaths() int {
 // AverageConfirmed returns the average confirmed per day over the last 3 days
 func (d *Data) AverageConfirmed() int {
 	// If not enough days, return 0
-	if len(d.Days) < 3 {
+	if d.Count() < 3 {
 		return 0
 	}
 
 	// Get deaths over last 3 days
-	sum := d.Days[len(d.Days)-1].Confirmed - d.Days[len(d.Days)-3].Confirmed
+	confirmed := d.Confirmed()
+	sum := confirmed[len(confirmed)-1] - confirmed[len(confirmed)-3]
 
 	// return simple average
 	return sum / 3
@@ -441,10 +449,11 @@ func (d *Data) AverageConfirmed() int {
 // DoubleDeathDays returns the number of days it took to more than double deaths
 // this ignores today's incomplete data
 func (d *Data) DoubleDeathDays() (days int) {
+	deaths := d.Deaths()
 	i := d.Count() - 1
-	half := d.Days[i].Deaths / 2
+	half := deaths[i] / 2
 	for i--; i >= 0; i-- {
-		if d.Days[i].Deaths < half {
+		if deaths[i] < half {
 			break
 		}
 		days++
@@ -456,10 +465,11 @@ func (d *Data) DoubleDeathDays() (days int) {
 // DoubleConfirmedDays returns the number of days it took to more than double confirmed
 // this ignores today's incomplete data
 func (d *Data) DoubleConfirmedDays() (days int) {
+	confirmed := d.Confirmed()
 	i := d.Count() - 1
-	half := d.Days[i].Confirmed / 2
+	half := confirmed[i] / 2
 	for i--; i >= 0; i-- {
-		if d.Days[i].Confirmed < half {
+		if confirmed[i] < half {
 			break
 		}
 		days++
@@ -475,9 +485,10 @@ func (d *Data) LastHours() int {
 
 // Dates returns a set of date labels as an array of strings
 // for every datapoint in this series for use in chart labels
-func (d *Data) Dates() (dates []string) {
-	for _, day := range d.Days {
-		dates = append(dates, day.Date.Format("Jan 2"))
+func (d *Data) Dates() []string {
+	dates := make([]string, 0, d.Count())
+	for i := 0; i < d.Count(); i++ {
+		dates = append(dates, d.Date(i).Format("Jan 2"))
 		/*
 			// Lockdown date gets lockdown label no longer
 			if d.LockdownAt.Equal(day.Date) {
@@ -492,10 +503,11 @@ func (d *Data) Dates() (dates []string) {
 
 // Colors returns a set of hex colours as an array of strings
 // for every datapoint in this series
-func (d *Data) Colors(color string) (colors []string) {
-	for _, day := range d.Days {
+func (d *Data) Colors(color string) []string {
+	colors := make([]string, 0, d.Count())
+	for i := 0; i < d.Count(); i++ {
 		// Lockdown date gets red colour
-		if d.LockdownAt.Equal(day.Date) {
+		if d.LockdownAt.Equal(d.Date(i)) {
 			colors = append(colors, "#ff0000")
 		} else {
 			colors = append(colors, color)
@@ -509,21 +521,15 @@ func (d *Data) HasLockdownAt() bool {
 	return !d.LockdownAt.IsZero()
 }
 
-// Count returns the count of days in this series
-func (d *Data) Count() int {
-	return len(d.Days)
-}
-
 // SetDayData sets the data for a given day,
 // the day should be added first with AddDays if required
-func (d *Data) SetDayData(dayNo, deaths, confirmed, recovered, tested int) error {
+func (d *Data) SetDayData(dayNo, deaths, confirmed, recovered, tested, hospitalised int) error {
 	index := dayNo - 1
-	if index > len(d.Days)-1 {
-		return fmt.Errorf("series: index out of range for set day:%d len:%d", index, len(d.Days))
+	if index > d.Count()-1 {
+		return fmt.Errorf("series: index out of range for set day:%d len:%d", index, d.Count())
 	}
 
-	day := d.Days[index]
-	day.SetAllData(deaths, confirmed, recovered, tested)
+	d.setDay(index, Day{Deaths: deaths, Confirmed: confirmed, Recovered: recovered, Tested: tested, Hospitalised: hospitalised})
 	return nil
 }
 
@@ -534,23 +540,23 @@ func (d *Data) SetData(startDate time.Time, dataKind int, values []int) error {
 	//log.Printf("data: set data of kind:%d data:%v", dataKind, values)
 
 	// If we don't have enough days, add some
-	if len(d.Days) < len(values) {
-		//log.Printf("addDays:%d %d", len(d.Days), len(values))
-		d.AddDays(len(values) - len(d.Days))
+	if d.Count() < len(values) {
+		//log.Printf("addDays:%d %d", d.Count(), len(values))
+		d.AddDays(len(values) - d.Count())
 	}
 
-	// Now set the values for this datakind on each day we have
-	for i, day := range d.Days {
+	// Check date on first day matches
+	if d.Count() > 0 && !d.start.Equal(startDate) {
+		return fmt.Errorf("series: mismatch on start date for data:%v %v", startDate, d.start)
+	}
 
-		// Check date on first day matches
-		if i == 0 && !day.Date.Equal(startDate) {
-			return fmt.Errorf("series: mismatch on start date for data:%v %v", startDate, day.Date)
-		}
+	// Now set the values for this datakind on each day we have
+	for i := 0; i < d.Count(); i++ {
 		//log.Printf("day:%d", values[i])
 		// Fill in the value on each day from values
-		err := day.SetData(dataKind, values[i])
+		err := d.SetValue(i, dataKind, values[i])
 		if err != nil {
-			return fmt.Errorf("series: failed to add day:%v error:%s", day, err)
+			return fmt.Errorf("series: failed to add day:%v error:%s", d.Day(i), err)
 		}
 	}
 
@@ -566,23 +572,23 @@ func (d *Data) MergeData(startDate time.Time, dataKind int, values []int) error
 	}
 
 	// If we don't have enough days, add some
-	if len(d.Days) < len(values) {
-		//log.Printf("addDays:%d %d", len(d.Days), len(values))
-		d.AddDays(len(values) - len(d.Days))
+	if d.Count() < len(values) {
+		//log.Printf("addDays:%d %d", d.Count(), len(values))
+		d.AddDays(len(values) - d.Count())
 	}
 
-	// Now set the values for this datakind on each day we have
-	for i, day := range d.Days {
+	// Check date on first day matches
+	if d.Count() > 0 && !d.start.Equal(startDate) {
+		return fmt.Errorf("series: mismatch on start date for data:%v %v", startDate, d.start)
+	}
 
-		// Check date on first day matches
-		if i == 0 && !day.Date.Equal(startDate) {
-			return fmt.Errorf("series: mismatch on start date for data:%v %v", startDate, day.Date)
-		}
+	// Now add the values for this datakind on each day we have
+	for i := 0; i < d.Count(); i++ {
 		//log.Printf("day:%d", values[i])
-		// Fill in the value on each day from values
-		err := day.MergeData(dataKind, values[i])
+		// Add the value on each day from values
+		err := d.SetValue(i, dataKind, d.Value(i, dataKind)+values[i])
 		if err != nil {
-			return fmt.Errorf("series: failed to add day:%v error:%s", day, err)
+			return fmt.Errorf("series: failed to add day:%v error:%s", d.Day(i), err)
 		}
 	}
 
@@ -599,24 +605,26 @@ func (d *Data) MergeSeries(series *Data) error {
 	}
 
 	// Add days if required
-	if len(d.Days) < len(series.Days) {
-		//log.Printf("addDays:%d", len(series.Days)-len(d.Days))
-		d.AddDays(len(series.Days) - len(d.Days))
+	if d.Count() < series.Count() {
+		//log.Printf("addDays:%d", series.Count()-d.Count())
+		d.AddDays(series.Count() - d.Count())
 	}
 
-	//log.Printf("days:%d sdays:%d", len(d.Days), len(series.Days))
+	//log.Printf("days:%d sdays:%d", d.Count(), series.Count())
 
 	// Now add this dataset on top of ours using MergeDay
-	for i, day := range d.Days {
+	for i := 0; i < d.Count(); i++ {
 
 		// Fill in the value on each day from values
 		// if dates don't match an error will be returned
 		// check we have this day first in series - we silenty ignore too many days
-		if i < len(series.Days) {
-			err := day.MergeDay(series.Days[i])
+		if i < series.Count() {
+			day := d.Day(i)
+			err := day.MergeDay(series.Day(i))
 			if err != nil {
 				return fmt.Errorf("series: failed to add day:%v error:%s", day, err)
 			}
+			d.setDay(i, day)
 		} else {
 			//	log.Printf("days overflow on series:%s", series)
 		}
@@ -628,39 +636,26 @@ func (d *Data) MergeSeries(series *Data) error {
 
 // AddDays adds the given number of days to the end of our series
 func (d *Data) AddDays(count int) {
-	// Get the last day (if any), and start a day after, otherwise start afresh
-	date := seriesStartDate
-	if len(d.Days) > 0 {
-		date = d.LastDay().Date.AddDate(0, 0, 1)
+	// If we have no days start afresh, otherwise days are added after the last day
+	if d.Count() == 0 {
+		d.start = seriesStartDate
 	}
 
 	for i := 0; i < count; i++ {
-		day := &Day{
-			Date: date,
-		}
-		d.Days = append(d.Days, day)
-		date = date.AddDate(0, 0, 1)
+		d.appendDay(Day{})
 	}
 }
 
 // AddToday adds a day, but sets the data to that of the last day
 // bounds checks are not performed
 func (d *Data) AddToday() {
-	if len(d.Days) == 0 {
+	if d.Count() == 0 {
 		return
 	}
 
-	// Get data for the last day, change the date, but use other data unchanged
+	// Use data for the last day unchanged on the new day
 	// this will be updated throughout the day as more data comes in
-	lastDay := d.LastDay()
-	day := &Day{
-		Date:      lastDay.Date.AddDate(0, 0, 1),
-		Deaths:    lastDay.Deaths,
-		Confirmed: lastDay.Confirmed,
-		Recovered: lastDay.Recovered,
-		Tested:    lastDay.Tested,
-	}
-	d.Days = append(d.Days, day)
+	d.appendDay(d.LastDay())
 }
 
 // UpdateToday updates today's values only if lower than the values given
@@ -682,12 +677,14 @@ func (d *Data) UpdateToday(updated time.Time, deaths, confirmed, recovered, test
 	if today.Tested < tested {
 		today.Tested = tested
 	}
+
+	d.setDay(d.Count()-1, today)
 }
 
 // ResetDays clears all days stored for this time series
 func (d *Data) ResetDays() {
-	count := len(d.Days)
-	d.Days = []*Day{}
+	count := d.Count()
+	d.clearDays()
 	d.AddDays(count)
 }
 
@@ -701,25 +698,24 @@ func (d *Data) AddDay(date time.Time, deaths, confirmed, recovered, tested int)
 		return fmt.Errorf("series: invalid zero date in AddDay")
 	}
 
-	// Check date is more than the last date in series
-	if len(d.Days) > 0 {
-		if !d.LastDay().Date.Before(date) {
+	// Check date is the day after the last date in series, as days are contiguous
+	if d.Count() > 0 {
+		if !d.Date(d.Count()).Equal(date) {
 			return fmt.Errorf("series: invalid date added")
 		}
+	} else {
+		d.start = date
 	}
 
 	// What about updating an existing day, do we ever do that?
 	// Different function for that.
 
-	day := &Day{
-		Date:      date,
+	d.appendDay(Day{
 		Deaths:    deaths,
 		Confirmed: confirmed,
 		Recovered: recovered,
 		Tested:    tested,
-	}
-
-	d.Days = append(d.Days, day)
+	})
 	return nil
 }
 
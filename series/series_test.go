@@ -40,12 +40,12 @@ func TestLoadAreas(t *testing.T) {
 	}
 
 	count := 8
-	if len(dataset) != count {
-		t.Fatalf("areas: count wrong want:%d got:%d", count, len(dataset))
+	if len(Current()) != count {
+		t.Fatalf("areas: count wrong want:%d got:%d", count, len(Current()))
 	}
 
 	// Fetch global, should not fail
-	global, err := dataset.FetchSeries("", "")
+	global, err := Current().FetchSeries("", "")
 	if err != nil {
 		t.Fatalf("areas: global not in dataset: s:%v", global)
 	}
@@ -55,9 +55,9 @@ func TestLoadAreas(t *testing.T) {
 	}
 
 	// Fetch US, should not fail
-	us, err := dataset.FetchSeries("US", "")
+	us, err := Current().FetchSeries("US", "")
 	if err != nil {
-		t.Fatalf("areas: failed to load us:%s %v", err, dataset)
+		t.Fatalf("areas: failed to load us:%s %v", err, Current())
 	}
 
 	if us.Country != "US" || us.Province != "" {
@@ -74,9 +74,9 @@ func TestLoadAreas(t *testing.T) {
 
 	// Fetch UK province
 	// United Kingdom,England,54,-2.0,55977178,#201234
-	england, err := dataset.FetchSeries("United Kingdom", "England")
+	england, err := Current().FetchSeries("United Kingdom", "England")
 	if err != nil {
-		t.Fatalf("areas: failed to load england,uk:%s %v", err, dataset)
+		t.Fatalf("areas: failed to load england,uk:%s %v", err, Current())
 	}
 
 	if england.Longitude != -2.0 {
@@ -87,9 +87,9 @@ func TestLoadAreas(t *testing.T) {
 		t.Fatalf("areas: failed to load England color got:%s", england.Color)
 	}
 
-	venezuela, err := dataset.FetchSeries("Venezuela", "")
+	venezuela, err := Current().FetchSeries("Venezuela", "")
 	if err != nil {
-		t.Fatalf("areas: failed to load venezuela:%s %v", err, dataset)
+		t.Fatalf("areas: failed to load venezuela:%s %v", err, Current())
 	}
 
 	if venezuela.Population != 32219521 {
@@ -111,7 +111,7 @@ func TestLoadSeries(t *testing.T) {
 	}
 
 	// Fetch UK, should not fail
-	uk, err := dataset.FetchSeries("United Kingdom", "")
+	uk, err := Current().FetchSeries("United Kingdom", "")
 	if err != nil {
 		t.Fatalf("series: uk not in dataset: s:%v", uk)
 	}
@@ -124,7 +124,7 @@ func TestLoadSeries(t *testing.T) {
 		t.Fatalf("series: uk deaths incorrect on date:%v want:%d got:%d", date, want, deaths)
 	}
 
-	t.Logf("dataset:%v", dataset)
+	t.Logf("dataset:%v", Current())
 
 	date = time.Date(2020, 3, 26, 0, 0, 0, 0, time.UTC)
 	deaths = uk.FetchDate(date, DataDeaths)
@@ -141,7 +141,7 @@ func TestLoadSeries(t *testing.T) {
 	}
 
 	// Test US
-	us, err := dataset.FetchSeries("US", "")
+	us, err := Current().FetchSeries("US", "")
 	if err != nil {
 		t.Fatalf("series: us not in dataset: s:%v", uk)
 	}
@@ -154,7 +154,7 @@ func TestLoadSeries(t *testing.T) {
 	}
 
 	// Test Wyoming, fake test data inserted
-	wyoming, err := dataset.FetchSeries("US", "Wyoming")
+	wyoming, err := Current().FetchSeries("US", "Wyoming")
 	if err != nil {
 		t.Fatalf("series: us not in dataset: s:%v", uk)
 	}
@@ -0,0 +1,140 @@
+package series
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Strategies for selecting comparison series automatically
+const (
+	StrategyNearest    = "nearest"    // nearest areas by latitude and longitude
+	StrategyPopulation = "population" // areas with the most similar population
+	StrategyTrajectory = "trajectory" // areas with the most similar recent curve of deaths per million
+)
+
+// trajectoryDays is the number of recent days compared when matching trajectories
+const trajectoryDays = 42
+
+// Comparator is a series chosen for comparison, with the reason it was chosen
+type Comparator struct {
+	Series *Data
+	Reason string
+
+	// Distance is the strategy specific distance from the original series (lower is more similar)
+	Distance float64
+}
+
+// ValidStrategy returns true if this is a known selection strategy
+func ValidStrategy(strategy string) bool {
+	return strategy == StrategyNearest || strategy == StrategyPopulation || strategy == StrategyTrajectory
+}
+
+// SimilarSeries selects up to n comparators for the series given using the strategy
+// the series itself is always included first, nil is returned if n is less than 1
+// series may be a Period view, the series in slice with the same id is not selected again
+func (slice Slice) SimilarSeries(series *Data, strategy string, n int) ([]*Comparator, error) {
+	if !ValidStrategy(strategy) {
+		return nil, fmt.Errorf("series: invalid comparison strategy:%s", strategy)
+	}
+	if n < 1 {
+		return nil, nil
+	}
+
+	var candidates []*Comparator
+	for _, s := range slice {
+		// Compare countries with countries, and provinces with provinces
+		if s.ID == series.ID || s.IsGlobal() || s.IsProvince() != series.IsProvince() {
+			continue
+		}
+
+		c := &Comparator{Series: s}
+		switch strategy {
+		case StrategyNearest:
+			c.Distance = series.DistanceTo(s)
+			c.Reason = fmt.Sprintf("nearby (%.0f km)", c.Distance)
+		case StrategyPopulation:
+			if series.Population == 0 || s.Population == 0 {
+				continue
+			}
+			c.Distance = math.Abs(math.Log(float64(s.Population)) - math.Log(float64(series.Population)))
+			c.Reason = fmt.Sprintf("similar population (%s)", s.Format(s.Population))
+		case StrategyTrajectory:
+			distance, ok := series.TrajectoryDistance(s, trajectoryDays)
+			if !ok {
+				continue
+			}
+			c.Distance = distance
+			c.Reason = fmt.Sprintf("similar trajectory (distance %.2f)", c.Distance)
+		}
+		candidates = append(candidates, c)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Distance < candidates[j].Distance
+	})
+
+	if len(candidates) > n-1 {
+		candidates = candidates[:n-1]
+	}
+
+	comparators := []*Comparator{{Series: series, Reason: "selected area"}}
+	return append(comparators, candidates...), nil
+}
+
+// DistanceTo returns the great circle distance in km between this area and another
+func (d *Data) DistanceTo(s *Data) float64 {
+	const earthRadius = 6371.0
+	lat1 := d.Latitude * math.Pi / 180
+	lat2 := s.Latitude * math.Pi / 180
+	dLat := lat2 - lat1
+	dLon := (s.Longitude - d.Longitude) * math.Pi / 180
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return earthRadius * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+// TrajectoryDistance returns the distance between the normalised curves of this area and another
+// over the last days - curves are daily deaths per million (smoothed) on a log scale
+// false is returned if either area has no population or no deaths in this period
+func (d *Data) TrajectoryDistance(s *Data, days int) (float64, bool) {
+	a := d.normalisedCurve(days)
+	b := s.normalisedCurve(days)
+	if a == nil || b == nil || len(a) != len(b) {
+		return 0, false
+	}
+
+	var sum float64
+	for i := range a {
+		sum += (a[i] - b[i]) * (a[i] - b[i])
+	}
+	return math.Sqrt(sum / float64(len(a))), true
+}
+
+// normalisedCurve returns the last days of smoothed daily deaths per million on a log scale
+// nil is returned if there is not enough data
+func (d *Data) normalisedCurve(days int) []float64 {
+	if d.Population == 0 || d.Count() < days || d.TotalDeaths() == 0 {
+		return nil
+	}
+
+	daily := d.SmoothedDaily(DataDeaths, 7)
+	daily = daily[len(daily)-days:]
+
+	curve := make([]float64, len(daily))
+	for i, v := range daily {
+		if v < 0 {
+			v = 0
+		}
+		curve[i] = math.Log1p(float64(v) * 1000000 / float64(d.Population))
+	}
+	return curve
+}
+
+// Comparators returns the series for a list of comparators
+func Comparators(comparators []*Comparator) (slice Slice) {
+	for _, c := range comparators {
+		slice = append(slice, c.Series)
+	}
+	return slice
+}
@@ -0,0 +1,78 @@
+package series
+
+import (
+	"testing"
+)
+
+// testSimilarSlice returns a slice of countries with varying location, population and deaths
+func testSimilarSlice() Slice {
+	slice := Slice{
+		{ID: 1},
+		{ID: 2, Country: "France", Latitude: 46.2, Longitude: 2.2, Population: 67000000},
+		{ID: 3, Country: "Belgium", Latitude: 50.8, Longitude: 4.5, Population: 11500000},
+		{ID: 4, Country: "Japan", Latitude: 36.2, Longitude: 138.3, Population: 126000000},
+		{ID: 5, Country: "Italy", Latitude: 41.9, Longitude: 12.6, Population: 60000000},
+		{ID: 6, Country: "US", Province: "New York", Latitude: 42.2, Longitude: -74.9, Population: 19000000},
+	}
+
+	// Deaths per million rise at the same rate in France and Italy, more slowly elsewhere
+	rates := map[int]int{2: 67, 3: 1, 4: 2, 5: 60, 6: 19}
+	for _, s := range slice {
+		s.AddDays(50)
+		for i := 0; i < s.Count(); i++ {
+			s.SetValue(i, DataDeaths, i*rates[s.ID])
+		}
+	}
+	return slice
+}
+
+func TestSimilarSeries(t *testing.T) {
+	slice := testSimilarSlice()
+	france := slice[1]
+
+	tests := map[string]string{
+		StrategyNearest:    "Belgium",
+		StrategyPopulation: "Italy",
+		StrategyTrajectory: "Italy",
+	}
+
+	for strategy, want := range tests {
+		comparators, err := slice.SimilarSeries(france, strategy, 3)
+		if err != nil {
+			t.Fatalf("similar: failed for strategy:%s error:%s", strategy, err)
+		}
+		if len(comparators) != 3 {
+			t.Fatalf("similar: wrong count for strategy:%s want:%d got:%d", strategy, 3, len(comparators))
+		}
+		if comparators[0].Series != france {
+			t.Errorf("similar: series not first for strategy:%s", strategy)
+		}
+		if comparators[1].Series.Country != want {
+			t.Errorf("similar: wrong nearest for strategy:%s want:%s got:%s", strategy, want, comparators[1].Series.Country)
+		}
+		for _, c := range comparators {
+			if c.Series.IsProvince() || c.Series.IsGlobal() || c.Reason == "" {
+				t.Errorf("similar: invalid comparator for strategy:%s got:%s %s", strategy, c.Series, c.Reason)
+			}
+		}
+	}
+
+	// A period view of the series is not selected again as a comparator
+	comparators, err := slice.SimilarSeries(france.Period(20), StrategyNearest, 3)
+	if err != nil || len(comparators) != 3 {
+		t.Fatalf("similar: failed for period:%v %v", comparators, err)
+	}
+	if comparators[0].Series.Count() != 20 || comparators[1].Series.Country != "Belgium" {
+		t.Errorf("similar: wrong comparators for period got:%s %s", comparators[0].Series, comparators[1].Series)
+	}
+
+	_, err = slice.SimilarSeries(france, "random", 3)
+	if err == nil {
+		t.Errorf("similar: expected error for invalid strategy")
+	}
+
+	comparators, err = slice.SimilarSeries(france, StrategyNearest, 0)
+	if err != nil || comparators != nil {
+		t.Errorf("similar: expected no comparators for n:0 got:%v %v", comparators, err)
+	}
+}
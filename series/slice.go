@@ -34,8 +34,8 @@ func (slice Slice) AddToday() error {
 	// Work out whether we already have today in the first slice data
 	// NB we assume a certain start date for today
 	days := int(time.Now().UTC().Sub(seriesStartDate).Hours()/24) + 1
-	if days <= len(slice[0].Days) {
-		log.Printf("series: addtoday have enough days:%d global days:%d", days, len(slice[0].Days))
+	if days <= slice[0].Count() {
+		log.Printf("series: addtoday have enough days:%d global days:%d", days, slice[0].Count())
 		return nil
 	}
 
@@ -47,6 +47,20 @@ func (slice Slice) AddToday() error {
 	return nil
 }
 
+// addDaysTo adds days to every series in this slice up to and including the day of date
+// as for AddToday new days use the data for the last day, or are zero if a series has no days
+func (slice Slice) addDaysTo(date time.Time) {
+	for _, s := range slice {
+		if s.Count() == 0 {
+			s.AddDays(int(date.Sub(seriesStartDate).Hours()/24) + 1)
+			continue
+		}
+		for s.Date(s.Count() - 1).Before(date.Truncate(24 * time.Hour)) {
+			s.AddToday()
+		}
+	}
+}
+
 // FetchDate fetches the datapoint for a given datum and date
 func (slice Slice) FetchDate(country, province string, datum int, date time.Time) (int, error) {
 	// Find the series, if none found return 0
@@ -61,11 +75,12 @@ func (slice Slice) FetchDate(country, province string, datum int, date time.Time
 	return series.FetchDate(date, datum), nil
 }
 
-// FetchSeries returns a series (if found) for this combination of country and province
+// FetchSeries returns a series (if found) for this combination of country and province (or province code)
+// this scans the slice, so for repeated lookups use Index instead
 func (slice Slice) FetchSeries(country string, province string) (*Data, error) {
 
 	for _, s := range slice {
-		if s.Match(country, province) {
+		if s.Match(country, province) || (s.Code != "" && s.MatchCountry(country) && keyEqual(s.Code, province)) {
 			return s, nil
 		}
 	}
@@ -74,6 +89,7 @@ func (slice Slice) FetchSeries(country string, province string) (*Data, error) {
 }
 
 // FindSeries returns a series (if found) for this ID
+// this scans the slice, so for repeated lookups use Index instead
 func (slice Slice) FindSeries(seriesID int) (*Data, error) {
 
 	for _, s := range slice {
@@ -85,26 +101,27 @@ func (slice Slice) FindSeries(seriesID int) (*Data, error) {
 	return &Data{}, fmt.Errorf("series: not found")
 }
 
-// DaysFrom returns day counts from a series of numbers
-func (slice Slice) DaysFrom(startDeaths int) []string {
-	if len(slice) == 0 {
-		return nil
+// Contains returns true if this series is in the slice
+func (slice Slice) Contains(series *Data) bool {
+	for _, s := range slice {
+		if s == series {
+			return true
+		}
 	}
+	return false
+}
 
-	// Find our longest series and return day labels using that
-	// other series will be shown ending before this one
-	count := 0
-	longest := slice[0]
+// Keys returns keys for the series in the slice in the form country or country/province
+func (slice Slice) Keys() (keys []string) {
 	for _, s := range slice {
-		deaths := s.DeathsFrom(startDeaths)
-		if len(deaths) > count {
-			count = len(deaths)
-			longest = s
-		}
+		keys = append(keys, s.CompareKey())
 	}
+	return keys
+}
 
-	// Return date labels from that series
-	return longest.DaysFrom(longest.DeathsFrom(startDeaths))
+// DaysFrom returns day labels for series aligned on the day of death startDeaths
+func (slice Slice) DaysFrom(startDeaths int) []string {
+	return slice.AlignedLabels(Alignment{Align: AlignDeaths, Threshold: float64(startDeaths), Metric: DataDeaths})
 }
 
 // PrintSeries uses our stored data to fetch a series
@@ -114,7 +131,7 @@ func (slice Slice) PrintSeries(country string, province string) error {
 		log.Printf("error: series err:%s %s", country, err)
 		return err
 	}
-	log.Printf("series:%s,%s %v", s.Country, s.Province, s.Days)
+	log.Printf("series:%s,%s %v", s.Country, s.Province, s.values)
 	return nil
 }
 
@@ -144,6 +161,18 @@ func (slice Slice) CountryOptions() (options []Option) {
 	return options
 }
 
+// CompareOptions returns a set of options for comparison selection
+// all countries and provinces are included, except for the global series
+func (slice Slice) CompareOptions() (options []Option) {
+	for _, s := range slice {
+		if s.IsGlobal() {
+			continue
+		}
+		options = append(options, Option{Name: s.Title(), Value: s.CompareKey()})
+	}
+	return options
+}
+
 // ProvinceOptions returns a set of options for the province dropdown
 // this should probably be based on the current country selection, and filtered from there
 // to avoid inconsistency
@@ -190,13 +219,14 @@ func (slice Slice) mergeTimeSeriesCSV(records [][]string, dataType int) (Slice,
 	// Make an assumption about the starting date (checked below on header row)
 	date := time.Date(2020, 1, 22, 0, 0, 0, 0, time.UTC)
 
+	index := slice.Index()
 	for i, row := range records {
 
 		// Check header to see this is the file we expect, if not skip
 		if i == 0 {
 			// We just check a few cols - we assume the start date of the data won't change
 			if row[0] != "Province/State" || row[1] != "Country/Region" || row[2] != "Lat" || row[4] != "1/22/20" {
-				return slice, fmt.Errorf("load: error loading file - time series csv data format invalid")
+				return index.Slice(), fmt.Errorf("load: error loading file - time series csv data format invalid")
 			}
 
 		} else {
@@ -219,7 +249,7 @@ func (slice Slice) mergeTimeSeriesCSV(records [][]string, dataType int) (Slice,
 
 			// Fetch the series
 			var series *Data
-			series, _ = slice.FetchSeries(country, province)
+			series, _ = index.FetchSeries(country, province)
 
 			// If we don't have one yet, create one
 			if !series.Valid() {
@@ -227,7 +257,7 @@ func (slice Slice) mergeTimeSeriesCSV(records [][]string, dataType int) (Slice,
 					Country:  country,
 					Province: province,
 				}
-				slice = append(slice, series)
+				index.add(series)
 			}
 
 			// Walk through row, reading days data after col 3 (longitude)
@@ -241,7 +271,7 @@ func (slice Slice) mergeTimeSeriesCSV(records [][]string, dataType int) (Slice,
 					v, err = strconv.Atoi(d)
 					if err != nil {
 						log.Printf("load: error loading series:%s row:%d col:%d row:\n%s\nerror:%s", country, i+1, ii+1, row, err)
-						return slice, fmt.Errorf("load: error loading row %d - csv day data invalid:%s", i+1, err)
+						return index.Slice(), fmt.Errorf("load: error loading row %d - csv day data invalid:%s", i+1, err)
 					}
 				} else {
 					// This is typically a clerical error - in this case invalid rows ending in ,
@@ -265,7 +295,7 @@ func (slice Slice) mergeTimeSeriesCSV(records [][]string, dataType int) (Slice,
 		}
 
 	}
-	return slice, nil
+	return index.Slice(), nil
 }
 
 // mergeDailyCountryCSV merges the data in this country daily series CSV with the data we already have in the Slice
@@ -285,6 +315,7 @@ func (slice Slice) mergeDailyCountryCSV(records [][]string, dataType int) (Slice
 		return nil, fmt.Errorf("day index out of bounds")
 	}
 
+	index := slice.Index()
 	for i, row := range records {
 		// Check header to see this is the file we expect, if not skip
 		if i == 0 {
@@ -306,7 +337,7 @@ func (slice Slice) mergeDailyCountryCSV(records [][]string, dataType int) (Slice
 			}
 
 			// Fetch the series
-			series, err := slice.FetchSeries(country, province)
+			series, err := index.FetchSeries(country, province)
 			if err != nil {
 				log.Printf("load: warning reading daily series:%s error:%s", row[0], err)
 				//return nil, fmt.Errorf("load: error reading daily series:%s error:%s", row[0], err)
@@ -346,6 +377,7 @@ func (slice Slice) mergeDailyStateCSV(records [][]string, dataType int) (Slice,
 		return nil, fmt.Errorf("day index out of bounds")
 	}
 
+	index := slice.Index()
 	for i, row := range records {
 		// Check header to see this is the file we expect, if not skip
 		if i == 0 {
@@ -369,7 +401,7 @@ func (slice Slice) mergeDailyStateCSV(records [][]string, dataType int) (Slice,
 			// we therefore ignore them here as the data seems to be out of date anyway
 
 			// Fetch the series
-			series, err := slice.FetchSeries(country, province)
+			series, err := index.FetchSeries(country, province)
 			if err != nil {
 				//	log.Printf("load: warning reading daily series:%s error:%s", row[1], err)
 				continue
@@ -0,0 +1,342 @@
+package series
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Source is a data source used to update series data, for example the JHU daily cases files
+// sources are registered with RegisterSource, and updated with UpdateSources
+type Source interface {
+	// Name returns a short unique name for the source, which is also recorded in the journal
+	Name() string
+
+	// Schedule returns the interval between updates from this source
+	Schedule() time.Duration
+
+	// Priority returns the priority of the source, sources with higher priority are updated first
+	Priority() int
+
+	// Fetch fetches the raw data for an update from the source
+	// ErrNotModified should be returned if the data is unchanged since the last fetch
+	Fetch() ([]byte, error)
+
+	// Parse parses raw data fetched from the source into observations
+	Parse(data []byte) ([]Observation, error)
+}
+
+// Observation is a cumulative total for one kind of data in an area on a day, as reported by a source
+type Observation struct {
+	Country  string
+	Province string
+
+	// Date is the day observed, if zero the observation is for the latest day in the series
+	Date time.Time
+
+	DataKind int
+	Value    int
+
+	// UpdatedAt is the time the source reports the value was updated (may be zero)
+	UpdatedAt time.Time
+
+	// Fallback is true if the value should only be used where the series has no value for the day
+	// unless the source is listed for the area in the priorities, see Priorities
+	Fallback bool
+}
+
+// SourceStatus records the result of the last update from a source
+type SourceStatus struct {
+	Name     string
+	Priority int
+	Schedule time.Duration
+
+	// LastRun is the time of the last update attempted, LastSuccess that of the last update which succeeded
+	LastRun     time.Time
+	LastSuccess time.Time
+	LastError   string
+
+	// Observations is the count of observations in the last update, Unmatched those for unknown areas
+	Observations int
+	Unmatched    int
+
+	// Fetch records fetches from the source
+	Fetch FetchStats
+}
+
+// sourceRegistry stores the registered sources and the status of each
+type sourceRegistry struct {
+	mutex   sync.Mutex
+	sources []Source
+	status  map[string]*SourceStatus
+}
+
+// sources is the registry of all sources used by UpdateSources
+var sources = &sourceRegistry{status: make(map[string]*SourceStatus)}
+
+// DefaultSources returns the sources used by the server, UK government data, the JHU cases files
+// and US state tests from covidtracking.com
+func DefaultSources() []Source {
+	return []Source{
+		ukSource{},
+		covidTrackingSource{},
+		jhuSource{name: "jhu", url: jhuCountryCasesURL, observations: jhuCountryObservations},
+		jhuSource{name: "jhu-states", url: jhuStatesCasesURL, observations: jhuStatesObservations},
+		ecdcSource{},
+	}
+}
+
+// RegisterSource registers a source for updates
+// registering a source with the same name as one already registered replaces it
+func RegisterSource(source Source) {
+	sources.register(source)
+}
+
+// register adds source to the registry, keeping sources ordered by priority, highest first
+func (r *sourceRegistry) register(source Source) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for i, s := range r.sources {
+		if s.Name() == source.Name() {
+			r.sources = append(r.sources[:i], r.sources[i+1:]...)
+			break
+		}
+	}
+	r.sources = append(r.sources, source)
+	sort.SliceStable(r.sources, func(i, j int) bool {
+		return r.sources[i].Priority() > r.sources[j].Priority()
+	})
+
+	r.status[source.Name()] = &SourceStatus{
+		Name:     source.Name(),
+		Priority: source.Priority(),
+		Schedule: source.Schedule(),
+	}
+}
+
+// Sources returns the registered sources, ordered by priority
+func Sources() []Source {
+	sources.mutex.Lock()
+	defer sources.mutex.Unlock()
+	return append([]Source(nil), sources.sources...)
+}
+
+// SourceReport returns the status of every registered source, ordered by priority
+func SourceReport() []SourceStatus {
+	sources.mutex.Lock()
+	defer sources.mutex.Unlock()
+	var report []SourceStatus
+	for _, s := range sources.sources {
+		status := *sources.status[s.Name()]
+		status.Fetch = fetches.statsFor(s.Name())
+		report = append(report, status)
+	}
+	return report
+}
+
+// SourceInterval returns the shortest schedule of the registered sources
+// which is how often UpdateSources should be called
+func SourceInterval() time.Duration {
+	var interval time.Duration
+	for _, s := range Sources() {
+		if interval == 0 || s.Schedule() < interval {
+			interval = s.Schedule()
+		}
+	}
+	return interval
+}
+
+// due returns the sources which have not been updated within their schedule at now
+// a minute of leeway is allowed as updates are not called exactly on schedule
+func (r *sourceRegistry) due(now time.Time) []Source {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var due []Source
+	for _, s := range r.sources {
+		last := r.status[s.Name()].LastRun
+		if last.IsZero() || now.Add(time.Minute).Sub(last) >= s.Schedule() {
+			due = append(due, s)
+		}
+	}
+	return due
+}
+
+// record records the result of an update from source in the registry
+// if the source data was not modified, the counts for the last update are kept
+func (r *sourceRegistry) record(source Source, now time.Time, observations, unmatched int, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	status, ok := r.status[source.Name()]
+	if !ok {
+		return
+	}
+	status.LastRun = now
+	if err != nil && err != ErrNotModified {
+		status.LastError = err.Error()
+		return
+	}
+	status.LastSuccess = now
+	status.LastError = ""
+	if err == ErrNotModified {
+		return
+	}
+	status.Observations = observations
+	status.Unmatched = unmatched
+}
+
+// UpdateSources updates the default store from every registered source due an update at now, see Store.UpdateSources
+func UpdateSources(now time.Time) (int, error) {
+	return defaultStore.UpdateSources(now)
+}
+
+// UpdateSources updates the store from every registered source due an update at now, in order of priority
+// it returns the count of sources updated, failures are recorded in the source report and the last error returned
+// as sources are independent, a failed source does not stop updates from the others
+// sources with data not modified since the last update are not counted as updated
+func (s *Store) UpdateSources(now time.Time) (int, error) {
+	var updated int
+	var lastErr error
+	for _, source := range sources.due(now) {
+		count, unmatched, err := s.UpdateFromSource(source)
+		sources.record(source, now, count, unmatched, err)
+		if err == ErrNotModified {
+			log.Printf("update: %s not modified", source.Name())
+			continue
+		}
+		if err != nil {
+			log.Printf("update: %s FAILED:%s", source.Name(), err)
+			lastErr = err
+			continue
+		}
+		updated++
+	}
+	return updated, lastErr
+}
+
+// UpdateFromSource fetches and parses data from source and applies the observations to the store
+// it returns the count of observations and of those for areas not found
+func (s *Store) UpdateFromSource(source Source) (int, int, error) {
+	fetchedAt := time.Now().UTC()
+	data, err := source.Fetch()
+	if err == ErrNotModified {
+		// The source still reports the values it did, so it has not gone stale for any area
+		s.updateMutex.Lock()
+		priorities := s.priorities
+		s.updateMutex.Unlock()
+		priorities.refresh(source.Name(), fetchedAt)
+		return 0, 0, err
+	} else if err != nil {
+		return 0, 0, fmt.Errorf("series: failed to fetch source:%s error:%s", source.Name(), err)
+	}
+
+	// Archive the payload before parsing, so that payloads which fail to parse can be investigated
+	s.archivePayload(source, fetchedAt, data)
+
+	count, unmatched, err := s.UpdateFromData(source, data)
+	if err != nil {
+		// Fetch all data again next time rather than a conditional request, as this data was not used
+		fetches.forget(source.Name())
+	}
+	return count, unmatched, err
+}
+
+// UpdateFromData parses data previously fetched from source and applies the observations to the store
+// for example to import a file downloaded from the source, see UpdateFromSource
+func (s *Store) UpdateFromData(source Source, data []byte) (int, int, error) {
+	observations, err := source.Parse(data)
+	if err != nil {
+		return 0, 0, fmt.Errorf("series: failed to parse source:%s error:%s", source.Name(), err)
+	}
+
+	unmatched, err := s.applyObservations(source.Name(), observations)
+	return len(observations), unmatched, err
+}
+
+// applyObservations applies observations from the named source to a copy of the dataset and publishes it
+// it returns the count of observations for areas not found
+func (s *Store) applyObservations(name string, observations []Observation) (int, error) {
+	var unmatched int
+	var held []QuarantineEntry
+	err := s.UpdateFrom(name, func(slice Slice) error {
+		now := time.Now().UTC()
+		observations = s.priorities.resolve(slice.Index(), name, observations, now)
+		unmatched = slice.applyObservations(observations, s.validator.checker(name, now, &held))
+		return nil
+	})
+	if unmatched > 0 {
+		log.Printf("series: %d observations from source:%s for unknown areas", unmatched, name)
+	}
+	if err == nil {
+		s.updateMutex.Lock()
+		v := s.validator
+		s.updateMutex.Unlock()
+		err = v.hold(held)
+	}
+	return unmatched, err
+}
+
+// applyObservations sets values in this slice from observations, returning the count for areas not found
+// values on the latest day are only raised, as sources may report partial figures during the day,
+// values on earlier days are replaced as sources revise historical figures
+// if check is not nil, values are only set if check returns true for the series, day and observation
+func (slice Slice) applyObservations(observations []Observation, check func(*Data, int, Observation) bool) int {
+	var unmatched int
+	updated := make(map[*Data]bool)
+	index := slice.Index()
+	for _, o := range observations {
+		series, err := index.FetchSeries(o.Country, o.Province)
+		if err != nil || series.Count() == 0 {
+			unmatched++
+			continue
+		}
+
+		last := series.Count() - 1
+		i := last
+		if !o.Date.IsZero() {
+			i = series.DayIndex(o.Date)
+			if i < 0 {
+				continue
+			}
+		}
+
+		current := series.Value(i, o.DataKind)
+		if o.Fallback && current != 0 {
+			continue
+		}
+
+		if check != nil && o.Value != current && (i != last || current < o.Value) && !check(series, i, o) {
+			continue
+		}
+
+		if i == last {
+			if current < o.Value {
+				series.SetValue(i, o.DataKind, o.Value)
+			}
+			if !o.UpdatedAt.IsZero() {
+				series.UpdatedAt = o.UpdatedAt
+			}
+		} else if current != o.Value {
+			// Values are only set if changed, so that unchanged days are not saved again
+			series.SetValue(i, o.DataKind, o.Value)
+		}
+		updated[series] = true
+	}
+
+	// Cumulative totals on the latest day should never be below those for the day before
+	for series := range updated {
+		if series.Count() < 2 {
+			continue
+		}
+		today, yesterday := series.LastDay(), series.PenultimateDay()
+		for _, kind := range []int{DataDeaths, DataConfirmed, DataRecovered, DataTested, DataHospitalised} {
+			if today.Value(kind) < yesterday.Value(kind) {
+				series.SetValue(series.Count()-1, kind, yesterday.Value(kind))
+			}
+		}
+	}
+
+	return unmatched
+}
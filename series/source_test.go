@@ -0,0 +1,107 @@
+package series
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// testSource is a source which returns observations set by the test
+type testSource struct {
+	name         string
+	priority     int
+	observations []Observation
+	err          error
+}
+
+func (t *testSource) Name() string            { return t.name }
+func (t *testSource) Schedule() time.Duration { return time.Hour }
+func (t *testSource) Priority() int           { return t.priority }
+func (t *testSource) Fetch() ([]byte, error)  { return nil, t.err }
+func (t *testSource) Parse(data []byte) ([]Observation, error) {
+	return t.observations, nil
+}
+
+func TestUpdateSources(t *testing.T) {
+	// Use a registry for this test only
+	defer func(r *sourceRegistry) { sources = r }(sources)
+	sources = &sourceRegistry{status: make(map[string]*SourceStatus)}
+
+	store := NewStore()
+	store.publish(Slice{{ID: 1, Country: "Testland"}})
+	store.Update(func(slice Slice) error {
+		slice[0].AddDays(3)
+		slice[0].SetValue(1, DataDeaths, 5)
+		slice[0].SetValue(2, DataDeaths, 5)
+		return nil
+	})
+	first := store.Current()[0].Date(0)
+
+	good := &testSource{name: "good", priority: 1, observations: []Observation{
+		{Country: "Testland", Date: first, DataKind: DataDeaths, Value: 2},
+		{Country: "testland", DataKind: DataDeaths, Value: 4},
+		{Country: "testland", DataKind: DataConfirmed, Value: 9},
+		{Country: "Atlantis", DataKind: DataDeaths, Value: 1},
+	}}
+	bad := &testSource{name: "bad", priority: 2, err: fmt.Errorf("down")}
+	RegisterSource(good)
+	RegisterSource(bad)
+
+	now := time.Now().UTC()
+	updated, err := store.UpdateSources(now)
+	if updated != 1 || err == nil {
+		t.Fatalf("sources: wrong result want:1 and error got:%d %v", updated, err)
+	}
+
+	// Historical values are replaced, but the latest day is only raised
+	s := store.Current()[0]
+	if s.Day(0).Deaths != 2 || s.LastDay().Deaths != 5 || s.LastDay().Confirmed != 9 {
+		t.Errorf("sources: wrong values got:%v %v", s.Day(0), s.LastDay())
+	}
+
+	report := SourceReport()
+	if len(report) != 2 || report[0].Name != "bad" || report[0].LastError == "" {
+		t.Fatalf("sources: wrong report got:%v", report)
+	}
+	if report[1].Observations != 4 || report[1].Unmatched != 1 || !report[1].LastSuccess.Equal(now) {
+		t.Errorf("sources: wrong status got:%v", report[1])
+	}
+
+	// Sources are not updated again until due
+	updated, _ = store.UpdateSources(now.Add(10 * time.Minute))
+	if updated != 0 {
+		t.Errorf("sources: updated before due got:%d", updated)
+	}
+
+	// Sources with data not modified are not updated, but keep their counts
+	good.err = ErrNotModified
+	later := now.Add(2 * time.Hour)
+	updated, _ = store.UpdateSources(later)
+	report = SourceReport()
+	if updated != 0 || report[1].LastError != "" || report[1].Observations != 4 || !report[1].LastSuccess.Equal(later) {
+		t.Errorf("sources: wrong status for not modified got:%d %v", updated, report[1])
+	}
+}
+
+func TestJHUObservations(t *testing.T) {
+	data := "Country_Region,Last_Update,Lat,Long_,Confirmed,Deaths,Recovered,Active\n" +
+		"Burma,2020-05-01 10:00:00,0,0,151.0,6.0,42.0,103\n" +
+		"United Kingdom,2020-05-01 10:00:00,0,0,1,1,1,0\n"
+	source := jhuSource{name: "jhu", observations: jhuCountryObservations}
+	observations, err := source.Parse([]byte(data))
+	if err != nil {
+		t.Fatalf("jhu: failed to parse:%s", err)
+	}
+	if len(observations) != 6 {
+		t.Fatalf("jhu: wrong observations got:%v", observations)
+	}
+	o := observations[1]
+	if o.Country != "Myanmar" || o.DataKind != DataConfirmed || o.Value != 151 || !o.Date.IsZero() {
+		t.Errorf("jhu: wrong observation got:%v", o)
+	}
+
+	_, err = source.Parse([]byte("Country,Updated\n"))
+	if err == nil {
+		t.Errorf("jhu: expected error for invalid format")
+	}
+}
@@ -1,6 +1,8 @@
 package series
 
 import (
+	"bytes"
+	"encoding/csv"
 	"fmt"
 	"log"
 	"os"
@@ -8,16 +10,9 @@ import (
 	"sort"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 )
 
-// Mutex to protect access to dataset below
-var mutex sync.RWMutex
-
-// Store our dataset as a local global, use mutex to access - no direct access
-var dataset Slice
-
 // FIXME unused except for import - move there
 // Data types for imported series
 const (
@@ -26,6 +21,7 @@ const (
 	DataConfirmed
 	DataRecovered
 	DataTested
+	DataHospitalised
 )
 
 // FIXME Now unused, remove
@@ -34,20 +30,30 @@ const (
 	DataTodayCountry = 21
 )
 
-// AddToday adds a day to our dataset
-// usually called after zero hours
+// AddToday adds a day to the dataset in the default store, see Store.AddToday
 func AddToday() error {
+	return defaultStore.AddToday()
+}
+
+// AddToday adds a day to our dataset and saves it
+// usually called after zero hours
+func (s *Store) AddToday() error {
+
+	backend := s.storage()
+
+	// Updates are blocked until saved, so that the day is saved before any updates to it
+	s.updateMutex.Lock()
+	defer s.updateMutex.Unlock()
 
 	// If we don't have it already, add a set of data for today
-	// Lock during add operation
-	mutex.Lock()
-	err := dataset.AddToday()
+	working := s.Current().Copy()
+	err := working.AddToday()
 	if err != nil {
 		return fmt.Errorf("series: failed to add today on series data:%s", err)
 	}
-	mutex.Unlock()
+	s.publish(working)
 
-	err = Save("data/series.csv")
+	err = backend.AppendDay(working)
 	if err != nil {
 		return fmt.Errorf("series: failed to save series data:%s", err)
 	}
@@ -55,60 +61,158 @@ func AddToday() error {
 	return nil
 }
 
-// LoadData reloads all data from our data files in dataPath
-// Dataset is locked for writing inside functions below
+// LoadData reloads all data in the default store from our data files in dataPath
 func LoadData(dataPath string) error {
+	return defaultStore.LoadData(dataPath)
+}
+
+// LoadData reloads all data from our data files in dataPath
+// if a backend has been set with SetBackend it is used instead of the csv files in dataPath
+func (s *Store) LoadData(dataPath string) error {
+	if s.Backend() == nil {
+		s.SetBackend(NewCSVBackend(dataPath))
+	}
+	return s.Reload()
+}
+
+// Reload reloads all data from the store backend
+// data is loaded into a new slice which is published only if loading succeeds,
+// so readers continue to see the previous dataset meanwhile
+func (s *Store) Reload() error {
 	start := time.Now().UTC()
 	defer func() {
 		log.Printf("series: loaded data in %s", time.Now().UTC().Sub(start))
 	}()
 
-	// Sanitize input
-	dataPath = filepath.Clean(dataPath)
+	backend := s.storage()
 
-	// Lock during load operation
-	mutex.Lock()
-	defer mutex.Unlock()
-
-	// Clear the existing data
-	dataset = Slice{}
+	// Block other updates during load operation
+	s.updateMutex.Lock()
+	defer s.updateMutex.Unlock()
 
 	// First load the areas data - this sets up a series per area
-	areaPath := filepath.Join(dataPath, "areas.csv")
-	err := LoadAreas(areaPath)
+	working, err := backend.LoadAreas()
 	if err != nil {
-		return fmt.Errorf("data: error loading areas:%s data:%s", areaPath, err)
+		return err
 	}
 
-	// Now load our main series file - this contains all historical data
-	seriesPath := filepath.Join(dataPath, "series.csv")
-	err = Load(seriesPath)
+	// Now load our main series data - this contains all historical data
+	err = backend.LoadSeries(working)
 	if err != nil {
 		return err
 	}
+	saved := working.Copy()
+
+	// Replay any updates made since the series data was last saved
+	if s.journal != nil {
+		entries, err := s.journal.Read()
+		if err != nil {
+			return err
+		}
+		log.Printf("series: replaying %d journal entries", len(entries))
+		working.applyJournal(entries)
+	}
+
+	// Apply manual corrections last, so that they override values from sources
+	working.applyCorrections(s.corrections)
 
 	// Add today if we don't have it
-	err = dataset.AddToday()
+	err = working.AddToday()
 	if err != nil {
 		return fmt.Errorf("series: failed to add today on series data:%s", err)
 	}
 
 	// Finally sort the dataset by deaths, then alphabetically by country/province
-	sort.Stable(dataset)
+	sort.Stable(working)
 
 	// For debug, print today's data after load
-	//dataset.PrintToday()
+	//working.PrintToday()
 
+	s.saved = saved
+	s.publish(working)
 	return nil
 }
 
-// LoadAreas loads our areas from the specified areas file
-// dataset must be locked while performing this operation
+// SaveData saves the dataset in the default store with its backend
+func SaveData() error {
+	return defaultStore.SaveData()
+}
+
+// SaveData saves the current dataset with the store backend
+// updates are blocked meanwhile, so that saves are made in order
+func (s *Store) SaveData() error {
+	backend := s.storage()
+	s.updateMutex.Lock()
+	defer s.updateMutex.Unlock()
+	return backend.SaveSeries(s.Current())
+}
+
+// Compact saves the dataset in the default store and clears its journal, see Store.Compact
+func Compact() error {
+	return defaultStore.Compact()
+}
+
+// Compact saves the current dataset with the store backend and then clears the journal
+// updates are blocked meanwhile so that no journal entries are lost
+func (s *Store) Compact() error {
+	s.updateMutex.Lock()
+	defer s.updateMutex.Unlock()
+
+	current := s.Current()
+	err := s.storage().SaveSeries(current)
+	if err != nil {
+		return err
+	}
+	s.saved = current
+
+	if s.journal == nil {
+		return nil
+	}
+	return s.journal.Clear()
+}
+
+// Saved returns the dataset last loaded or saved by the default store, see Store.Saved
+func Saved() Slice {
+	return defaultStore.Saved()
+}
+
+// Saved returns the dataset as last loaded from or saved to the store backend, before any updates since
+// this is nil if nothing has been loaded or saved, and must not be modified
+func (s *Store) Saved() Slice {
+	s.updateMutex.Lock()
+	defer s.updateMutex.Unlock()
+	return s.saved
+}
+
+// Revisions returns the values stored over time for an area in the default store
+func Revisions(areaID int) ([]Revision, error) {
+	return defaultStore.Revisions(areaID)
+}
+
+// Revisions returns the values stored over time for an area by the store backend
+func (s *Store) Revisions(areaID int) ([]Revision, error) {
+	return s.storage().Revisions(areaID)
+}
+
+// LoadAreas loads areas from the specified areas file into the default store
 func LoadAreas(p string) error {
+	return defaultStore.LoadAreas(p)
+}
+
+// LoadAreas loads areas from the specified areas file and adds them to the dataset
+func (s *Store) LoadAreas(p string) error {
+	return s.update("", func(slice Slice) (Slice, error) {
+		return slice.loadAreas(p)
+	})
+}
+
+// loadAreas loads our areas from the specified areas file
+// the slice returned contains a new series for each area appended to this slice
+func (slice Slice) loadAreas(p string) (Slice, error) {
 	// Open the areas CSV
 	rows, err := loadCSV(p)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Walk rows reading area data (countries and provinces)
@@ -117,153 +221,291 @@ func LoadAreas(p string) error {
 		// validate header row
 		if i == 0 {
 			if row[0] != "country" || row[1] != "province" || row[2] != "area_id" || row[7] != "colour" {
-				return fmt.Errorf("areas: invalid header row in file:%s row:%s", p, row)
+				return nil, fmt.Errorf("areas: invalid header row in file:%s row:%s", p, row)
 			}
 			continue
 		}
 
 		s, err := NewData(row)
 		if err != nil {
-			return fmt.Errorf("areas: invalid row in file:%s row:%s error:%s", p, row, err)
+			return nil, fmt.Errorf("areas: invalid row in file:%s row:%s error:%s", p, row, err)
 		}
 
-		dataset = append(dataset, s)
+		slice = append(slice, s)
+	}
+
+	return slice, nil
+}
+
+// LoadInterventions loads interventions from the specified interventions file into the default store
+func LoadInterventions(p string) error {
+	return defaultStore.LoadInterventions(p)
+}
+
+// LoadInterventions loads interventions from the specified interventions file into the dataset
+func (s *Store) LoadInterventions(p string) error {
+	return s.Update(func(slice Slice) error {
+		return slice.loadInterventions(p)
+	})
+}
+
+// loadInterventions loads interventions from the specified interventions file
+// the file is optional, if it does not exist no interventions are loaded
+func (slice Slice) loadInterventions(p string) error {
+	_, err := os.Stat(p)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	rows, err := loadCSV(p)
+	if err != nil {
+		return err
+	}
+
+	// Walk rows reading interventions: area_id, date, name
+	index := slice.Index()
+	for i, row := range rows {
+		// validate header row
+		if i == 0 {
+			if len(row) < 3 || row[0] != "area_id" || row[1] != "date" || row[2] != "name" {
+				return fmt.Errorf("interventions: invalid header row in file:%s row:%s", p, row)
+			}
+			continue
+		}
+
+		areaID, err := strconv.Atoi(row[0])
+		if err != nil {
+			return fmt.Errorf("interventions: invalid area_id at row:%s", row)
+		}
+
+		date, err := time.Parse("2006-01-02", row[1])
+		if err != nil {
+			return fmt.Errorf("interventions: invalid date at row:%s", row)
+		}
+
+		series, err := index.FindSeries(areaID)
+		if err != nil {
+			log.Printf("interventions: series not found for id:%d row:%v", areaID, row)
+			continue
+		}
+
+		series.AddIntervention(row[2], date)
 	}
 
 	return nil
 }
 
-// Save saves the existing series to a file at the path given
-// this is used for automatic updates of data from data sources
+// Save saves the dataset in the default store to a file at the path given
 func Save(p string) error {
+	return defaultStore.Save(p)
+}
 
-	if len(dataset) == 0 {
+// Save saves the current dataset to a file at the path given
+// this is used for automatic updates of data from data sources
+func (s *Store) Save(p string) error {
+	return s.Current().Save(p)
+}
+
+// Save saves the series in this slice to a file at the path given
+// the slice itself is not modified, so this may be called on a published snapshot
+func (slice Slice) Save(p string) error {
+	data, err := slice.seriesCSV()
+	if err != nil {
+		return err
+	}
+
+	// SERIES DATA file is saved at path given atomically, keeping backups of previous versions
+	err = saveFile(p, data)
+	if err != nil {
+		return fmt.Errorf("series: failed to write series file:%s", err)
+	}
+
+	return nil
+}
+
+// seriesCSVHeader is the header row of our series csv format
+const seriesCSVHeader = "day,area_id,deaths,confirmed,recovered,tested,hospitalised\n"
+
+// seriesCSV returns the series in this slice in our csv format
+func (slice Slice) seriesCSV() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString(seriesCSVHeader)
+	err := slice.writeSeriesRows(&b, 0)
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// writeSeriesRows writes rows in our csv format for every day from day index from to b
+// rows are ordered by day, then area id, so rows for earlier days are unaffected
+func (slice Slice) writeSeriesRows(b *bytes.Buffer, from int) error {
+
+	if len(slice) == 0 {
 		return fmt.Errorf("series: save on empty data set")
 	}
 
-	days := len(dataset[0].Days)
+	days := slice[0].Count()
 	if days == 0 {
 		return fmt.Errorf("series: save on empty data set")
 	}
 
-	// Lock during save operation
-	mutex.Lock()
-	defer mutex.Unlock()
-
 	var seriesData [][]int
 
-	// Sort the dataset by id for saving
-	sort.Slice(dataset, func(i, j int) bool {
-		return dataset[i].ID < dataset[j].ID
+	// Sort a copy of the slice by id for saving
+	// where series share an id only the first is saved, as only the first is found on load
+	var sorted Slice
+	index := slice.Index()
+	for _, s := range slice {
+		if index.byID[s.ID] == s {
+			sorted = append(sorted, s)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].ID < sorted[j].ID
 	})
 
 	// We save the series per day rather than every series at once
 	// so that additional days are at the end of the file
 	// For every series, save the data to an array (if non-zero)
 	// it would perhaps be more intuitive to order by area_id instead first
-	for i := 0; i < days; i++ {
+	for i := from; i < days; i++ {
 		dayNumber := i + 1
-		for _, s := range dataset {
+		for _, s := range sorted {
 			// Should never happen but if missing series data it can
-			if i > len(s.Days)-1 {
+			if i > s.Count()-1 {
 				log.Printf("series: days out of range for series:%d", s.ID)
 				continue
 			}
-			d := s.Days[i]
+			d := s.Day(i)
 			if !d.IsZero() {
-				seriesData = append(seriesData, []int{dayNumber, s.ID, d.Deaths, d.Confirmed, d.Recovered, d.Tested})
+				seriesData = append(seriesData, []int{dayNumber, s.ID, d.Deaths, d.Confirmed, d.Recovered, d.Tested, d.Hospitalised})
 			}
 		}
 	}
 
-	// Resort the dataset in our preferred order
-	sort.Sort(dataset)
-
-	// Write the data out to files - our data is simple so we write directly
-	headerRow := fmt.Sprintf("day,area_id,deaths,confirmed,recovered,tested\n")
-	var row string
-
-	// SERIES DATA file is saved at path given, over existing file if required
-	f, err := os.Create(p)
-	if err != nil {
-		fmt.Println(err)
-	}
-
-	// Write header
-	_, err = f.WriteString(headerRow)
-	if err != nil {
-		return fmt.Errorf("failed to write series file:%s", err)
-	}
-	// Write days
+	// Write the data out to the buffer - our data is simple so we write directly
 	for _, d := range seriesData {
-		row = fmt.Sprintf("%d,%d,%d,%d,%d,%d\n", d[0], d[1], d[2], d[3], d[4], d[5])
-		_, err = f.WriteString(row)
-		if err != nil {
-			return fmt.Errorf("failed to write day file:%s", err)
-		}
+		fmt.Fprintf(b, "%d,%d,%d,%d,%d,%d,%d\n", d[0], d[1], d[2], d[3], d[4], d[5], d[6])
 	}
 
 	return nil
 }
 
-// Load loads our global series file
+// Load loads our global series file into the default store
+func Load(p string) error {
+	return defaultStore.Load(p)
+}
+
+// Load loads our global series file into the dataset, see Slice.load
+func (s *Store) Load(p string) error {
+	return s.Update(func(slice Slice) error {
+		return slice.load(p)
+	})
+}
+
+// load loads our global series file into the series in this slice
 // this contains all data in the sparse format (no rows for zero data):
 // day, area_id, deaths, confirmed, recovered, tested
-// dataset must be locked while performing this operation
-func Load(p string) error {
+// the file is verified against its checksum (if any), and if it is corrupt
+// the newest valid backup is loaded instead
+func (slice Slice) load(p string) error {
+	_, err := slice.loadFile(p)
+	return err
+}
 
-	// Open the CSV file - one row per day per area
-	rows, err := loadCSV(p)
+// loadFile loads the series file at p as load, returning the data loaded
+// which is from a backup if the file was missing or corrupt
+func (slice Slice) loadFile(p string) ([]byte, error) {
+	p = filepath.Clean(p)
+	log.Printf("data: loading file at path:%v", p)
+
+	// Read and parse the file (or a backup) before touching the series
+	var rows [][]int
+	data, err := readFileWithFallback(p, func(data []byte) error {
+		var parseErr error
+		rows, parseErr = parseSeriesRows(data)
+		return parseErr
+	})
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("series: failed to load file:%s error:%s", p, err)
 	}
 
 	// Check the day number on the last row in the series - we want this many days to load into
 	// we assume we start from 1 up to this day number
 	// this may or may not include today
-	days, err := strconv.Atoi(rows[len(rows)-1][0])
-	if err != nil {
-		// If dayno read fails, fall back to days up to but not including today
-		days = int(time.Now().UTC().Sub(seriesStartDate).Hours() / 24)
+	days := int(time.Now().UTC().Sub(seriesStartDate).Hours() / 24)
+	if len(rows) > 0 {
+		days = rows[len(rows)-1][0]
 	}
 
 	log.Printf("load: loading series:%s days:%d", p, days)
 
 	// For every series add the right number of days up to but not including today
 	// these days are initially zeroed out before loading from the file
-	for _, series := range dataset {
+	for _, series := range slice {
 		series.AddDays(days)
 	}
 
 	// Range rows loading data for each country from each row
-	for i, row := range rows {
+	index := slice.Index()
+	for i, values := range rows {
+		series, err := index.FindSeries(values[1])
+		if err != nil || series == nil {
+			log.Printf("series: series not found for id:%d index:%d row:%v", values[1], i, values)
+			continue
+		}
+
+		// Set the series data from this row
+		series.SetDayData(values[0], values[2], values[3], values[4], values[5], values[6])
+	}
+
+	return data, nil
+}
+
+// parseSeriesRows parses series csv data into rows of ints, checking the header and row lengths
+// files saved before hospitalised was added have no hospitalised column, this is read as 0
+// the header row is not returned
+func parseSeriesRows(data []byte) ([][]int, error) {
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(records) == 0 {
+		return nil, fmt.Errorf("series: empty series file")
+	}
+
+	var rows [][]int
+	var columns int
+	for i, row := range records {
 		// Validate header row
 		if i == 0 {
 			// We make assumptions about the start date rather than parsing the first date
 			// we could instead parse this date to be more flexible
-			if row[0] != "day" || row[1] != "area_id" || row[5] != "tested" {
-				return fmt.Errorf("series: invalid header row in file:%s row:%s", p, row)
+			if len(row) < 6 || row[0] != "day" || row[1] != "area_id" || row[5] != "tested" ||
+				(len(row) != 6 && (len(row) != 7 || row[6] != "hospitalised")) {
+				return nil, fmt.Errorf("series: invalid header row:%s", row)
 			}
+			columns = len(row)
 			continue
 		}
 
 		values := intValues(row)
-		if len(values) != 6 {
-			return fmt.Errorf("series: invalid row len for row:%s", row)
+		if len(values) != columns {
+			return nil, fmt.Errorf("series: invalid row len for row:%s", row)
 		}
-
-		series, err := dataset.FindSeries(values[1])
-		if err != nil || series == nil {
-			log.Printf("series: series not found for id:%d index:%d row:%v", values[1], i, row)
-			continue
+		if columns == 6 {
+			values = append(values, 0)
+		}
+		if values[0] < 1 {
+			return nil, fmt.Errorf("series: invalid day for row:%s", row)
 		}
 
-		//	log.Printf("series:%s day:%v", series, values)
-		// Set the series data from this row
-		series.SetDayData(values[0], values[2], values[3], values[4], values[5])
+		rows = append(rows, values)
 	}
 
-	return nil
+	return rows, nil
 }
 
 // MergeData on series may not be required either
@@ -282,6 +524,8 @@ func dataTypeForPath(p string) int {
 		return DataRecovered
 	} else if strings.Contains(name, "tested") {
 		return DataTested
+	} else if strings.Contains(name, "hospitalised") {
+		return DataHospitalised
 	}
 
 	return DataNone
@@ -0,0 +1,217 @@
+package series
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Store owns a dataset, which is loaded from data files and updated from data sources
+// several stores may be used side by side, the package level functions use the default store
+type Store struct {
+	// updateMutex serialises updates to the dataset - readers never lock
+	updateMutex sync.Mutex
+
+	// snapshot stores the current dataset and its index (an *Index) which is replaced atomically on each update
+	// once published a Slice and the series and days within it are never modified
+	snapshot atomic.Value
+
+	// backend stores the dataset, see SetBackend
+	backend atomic.Value
+
+	// journal records changes made with UpdateFrom, see SetJournal - guarded by updateMutex
+	journal *Journal
+
+	// archive stores payloads fetched by UpdateFromSource, see SetArchive - guarded by updateMutex
+	archive *Archive
+
+	// priorities decides which sources are used for each area, see SetPriorities - guarded by updateMutex
+	priorities *Priorities
+
+	// validator checks observations before they are applied, see SetValidator - guarded by updateMutex
+	validator *Validator
+
+	// corrections are applied after every load and update, see SetCorrections - guarded by updateMutex
+	corrections []Correction
+
+	// version counts the snapshots published, see Version - guarded by updateMutex
+	version uint64
+
+	// saved is the dataset as last loaded from or saved to the backend, see Saved - guarded by updateMutex
+	saved Slice
+}
+
+// NewStore returns a new empty store
+func NewStore() *Store {
+	s := &Store{}
+	s.snapshot.Store(Slice{}.Index())
+	return s
+}
+
+// defaultStore is the store used by package level functions
+var defaultStore = NewStore()
+
+// DefaultStore returns the store used by package level functions
+func DefaultStore() *Store {
+	return defaultStore
+}
+
+// Current returns the current dataset snapshot for the default store
+func Current() Slice {
+	return defaultStore.Current()
+}
+
+// Update applies f to a copy of the dataset in the default store, see Store.Update
+func Update(f func(Slice) error) error {
+	return defaultStore.Update(f)
+}
+
+// SetBackend sets the backend used by the default store, see Store.SetBackend
+func SetBackend(b Backend) {
+	defaultStore.SetBackend(b)
+}
+
+// SetBackend sets the backend used to load and save the dataset
+// if no backend is set the csv backend is used with files in the data directory
+func (s *Store) SetBackend(b Backend) {
+	s.backend.Store(&b)
+}
+
+// Backend returns the backend set with SetBackend, or nil if none has been set
+func (s *Store) Backend() Backend {
+	b, _ := s.backend.Load().(*Backend)
+	if b == nil {
+		return nil
+	}
+	return *b
+}
+
+// storage returns the store backend, or a csv backend for the data directory if none has been set
+func (s *Store) storage() Backend {
+	b := s.Backend()
+	if b == nil {
+		return NewCSVBackend("data")
+	}
+	return b
+}
+
+// Current returns the current dataset snapshot
+// callers should fetch this once per request and use it throughout,
+// so that all data used in the request is consistent even if an update is published meanwhile
+func (s *Store) Current() Slice {
+	return s.Index().Slice()
+}
+
+// CurrentIndex returns an index of the current dataset snapshot for the default store
+func CurrentIndex() *Index {
+	return defaultStore.Index()
+}
+
+// Index returns an index of the current dataset snapshot, built when the snapshot was published
+// use Index().Slice() to fetch the dataset indexed if both are required in a request
+func (s *Store) Index() *Index {
+	return s.snapshot.Load().(*Index)
+}
+
+// Version returns the version of the current dataset in the default store
+func Version() uint64 {
+	return defaultStore.Version()
+}
+
+// Version returns the version of the current dataset snapshot, which increases each time a snapshot is published
+// so values computed from the dataset may be cached until the version changes
+func (s *Store) Version() uint64 {
+	return s.Index().Version()
+}
+
+// publish makes a new dataset snapshot available to readers, indexing it first
+// the slice must not be modified after this call, and updateMutex should be held
+func (s *Store) publish(slice Slice) {
+	s.version++
+	index := slice.Index()
+	index.version = s.version
+	s.snapshot.Store(index)
+}
+
+// update applies f to a copy of the current dataset and publishes the result if f succeeds
+// corrections are applied to the result before it is published, and if source is set
+// and the store has a journal, every value changed is appended to the journal
+// updates are serialised, and readers continue to see the previous snapshot until publish
+func (s *Store) update(source string, f func(Slice) (Slice, error)) error {
+	s.updateMutex.Lock()
+	defer s.updateMutex.Unlock()
+
+	working, err := f(s.Current().Copy())
+	if err != nil {
+		return err
+	}
+
+	// Manual corrections always override values from sources
+	working.applyCorrections(s.corrections)
+
+	if source != "" && s.journal != nil {
+		err = s.journal.Append(journalChanges(s.Current(), working, source, time.Now().UTC()))
+		if err != nil {
+			return err
+		}
+	}
+
+	s.publish(working)
+	return nil
+}
+
+// Update applies f to a copy of the current dataset and publishes the copy if f returns nil
+// f may modify any series in the slice it is given, but should not retain it
+func (s *Store) Update(f func(Slice) error) error {
+	return s.update("", func(slice Slice) (Slice, error) {
+		return slice, f(slice)
+	})
+}
+
+// UpdateFrom applies f to a copy of the dataset in the default store, see Store.UpdateFrom
+func UpdateFrom(source string, f func(Slice) error) error {
+	return defaultStore.UpdateFrom(source, f)
+}
+
+// UpdateFrom applies f to a copy of the current dataset for updates from source, and publishes the copy if f returns nil
+// if the store has a journal every value changed is appended to it before the copy is published
+func (s *Store) UpdateFrom(source string, f func(Slice) error) error {
+	return s.update(source, func(slice Slice) (Slice, error) {
+		return slice, f(slice)
+	})
+}
+
+// SetJournal sets the journal used by the default store, see Store.SetJournal
+func SetJournal(j *Journal) {
+	defaultStore.SetJournal(j)
+}
+
+// SetJournal sets a journal to record changes made by UpdateFrom, which is replayed on load
+// this should be set before data is loaded
+func (s *Store) SetJournal(j *Journal) {
+	s.updateMutex.Lock()
+	defer s.updateMutex.Unlock()
+	s.journal = j
+}
+
+// Copy returns a deep copy of this slice, including copies of all series and days
+func (slice Slice) Copy() Slice {
+	copied := make(Slice, len(slice))
+	for i, s := range slice {
+		copied[i] = s.Copy()
+	}
+	return copied
+}
+
+// Copy returns a deep copy of this series including all days
+func (d *Data) Copy() *Data {
+	c := *d
+
+	c.values = d.values.copy()
+
+	if d.Interventions != nil {
+		c.Interventions = append([]Intervention(nil), d.Interventions...)
+	}
+
+	return &c
+}
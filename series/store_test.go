@@ -0,0 +1,93 @@
+package series
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestUpdateSnapshot(t *testing.T) {
+	store := NewStore()
+	store.publish(Slice{{ID: 1, Country: "Testland"}})
+	before := store.Current()
+	before[0].AddDays(2)
+
+	// A successful update should publish a copy, leaving the old snapshot untouched
+	err := store.Update(func(slice Slice) error {
+		slice[0].SetValue(slice[0].Count()-1, DataDeaths, 10)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("update: failed:%s", err)
+	}
+	if store.Current()[0].LastDay().Deaths != 10 {
+		t.Errorf("update: not published want:%d got:%d", 10, store.Current()[0].LastDay().Deaths)
+	}
+	if before[0].LastDay().Deaths != 0 {
+		t.Errorf("update: modified previous snapshot got:%d", before[0].LastDay().Deaths)
+	}
+
+	// A failed update should not publish anything
+	published := store.Current()
+	err = store.Update(func(slice Slice) error {
+		slice[0].SetValue(slice[0].Count()-1, DataDeaths, 20)
+		return fmt.Errorf("failed")
+	})
+	if err == nil {
+		t.Fatalf("update: expected error")
+	}
+	if store.Current()[0] != published[0] || store.Current()[0].LastDay().Deaths != 10 {
+		t.Errorf("update: published failed update got:%d", store.Current()[0].LastDay().Deaths)
+	}
+}
+
+func TestStoresSideBySide(t *testing.T) {
+	p, _ := filepath.Abs("testdata/areas.csv")
+
+	a := NewStore()
+	err := a.LoadAreas(p)
+	if err != nil {
+		t.Fatalf("store: failed to load areas:%s", err)
+	}
+
+	b := NewStore()
+	if len(b.Current()) != 0 {
+		t.Fatalf("store: new store not empty got:%d", len(b.Current()))
+	}
+
+	err = b.LoadAreas(p)
+	if err != nil {
+		t.Fatalf("store: failed to load areas:%s", err)
+	}
+
+	// Each store should have its own copy of the series
+	sa, err := a.FetchSeries("United Kingdom", "")
+	if err != nil {
+		t.Fatalf("store: failed to fetch series:%s", err)
+	}
+	sb, err := b.FetchSeries("United Kingdom", "")
+	if err != nil {
+		t.Fatalf("store: failed to fetch series:%s", err)
+	}
+	if sa == sb || len(a.Current()) != len(b.Current()) {
+		t.Errorf("store: stores share data")
+	}
+}
+
+func TestStoreVersion(t *testing.T) {
+	store := NewStore()
+	if store.Version() != 0 {
+		t.Fatalf("version: new store version want:0 got:%d", store.Version())
+	}
+
+	err := store.Update(func(slice Slice) error { return nil })
+	if err != nil || store.Version() != 1 {
+		t.Fatalf("version: update not versioned want:1 got:%d", store.Version())
+	}
+
+	// A failed update publishes nothing so should not change the version
+	store.Update(func(slice Slice) error { return fmt.Errorf("failed") })
+	if store.Version() != 1 {
+		t.Errorf("version: failed update versioned want:1 got:%d", store.Version())
+	}
+}
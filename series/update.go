@@ -2,28 +2,38 @@ package series
 
 import "sort"
 
+// CalculateGlobalSeriesData updates the default store, see Store.CalculateGlobalSeriesData
+func CalculateGlobalSeriesData() error {
+	return defaultStore.CalculateGlobalSeriesData()
+}
+
 // CalculateGlobalSeriesData adds some top level countries which are inexplicably missing from the original dataset
 // presumably they calculate these on the fly
-func CalculateGlobalSeriesData() error {
+func (s *Store) CalculateGlobalSeriesData() error {
+	return s.UpdateFrom("global", func(slice Slice) error {
+		return slice.calculateGlobalSeriesData()
+	})
+}
 
-	// Lock during add operation
-	mutex.Lock()
-	defer mutex.Unlock()
+// calculateGlobalSeriesData recalculates country totals for China, Australia and Canada
+// and the global series from the other series in this slice
+func (slice Slice) calculateGlobalSeriesData() error {
 
 	// Fetch series
-	China, err := dataset.FetchSeries("China", "")
+	index := slice.Index()
+	China, err := index.FetchSeries("China", "")
 	if err != nil {
 		return err
 	}
-	Australia, err := dataset.FetchSeries("Australia", "")
+	Australia, err := index.FetchSeries("Australia", "")
 	if err != nil {
 		return err
 	}
-	Canada, err := dataset.FetchSeries("Canada", "")
+	Canada, err := index.FetchSeries("Canada", "")
 	if err != nil {
 		return err
 	}
-	Global, err := dataset.FetchSeries("", "")
+	Global, err := index.FetchSeries("", "")
 	if err != nil {
 		return err
 	}
@@ -36,7 +46,7 @@ func CalculateGlobalSeriesData() error {
 
 	// Add global country entries for countries with data broken down at province level
 	// these are missing in the datasets from JHU for some reason, though US is now included
-	for _, s := range dataset {
+	for _, s := range slice {
 
 		// Build an overall China series
 		if s.Country == "China" {
@@ -75,8 +85,8 @@ func CalculateGlobalSeriesData() error {
 		}
 	}
 
-	// Sort entire dataset by deaths desc to get the right order
-	sort.Stable(dataset)
+	// Sort entire slice by deaths desc to get the right order
+	sort.Stable(slice)
 
 	return nil
 }
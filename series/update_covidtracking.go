@@ -0,0 +1,166 @@
+package series
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// covidTrackingURL is the url of the covidtracking.com daily figures for every US state, in json format
+// the same data is available in csv format with the same field names
+const covidTrackingURL = "https://api.covidtracking.com/v1/states/daily.json"
+
+// covidTrackingSource updates tested and hospitalised totals for US states from covidtracking.com,
+// including all historical days - the data also includes cases and deaths, but we use JHU for those
+// states are identified by their code, which is found with the code column in areas.csv
+type covidTrackingSource struct{}
+
+// NewCovidTrackingSource returns a source for tests and hospitalisations in US states from covidtracking.com
+func NewCovidTrackingSource() Source {
+	return covidTrackingSource{}
+}
+
+// Name returns the name of the source
+func (covidTrackingSource) Name() string {
+	return "covidtracking"
+}
+
+// Schedule returns the interval between updates, states are updated once a day at varying times
+func (covidTrackingSource) Schedule() time.Duration {
+	return time.Hour
+}
+
+// Priority returns the priority of the source, it is the only source of tests and hospitalisations for US states
+func (covidTrackingSource) Priority() int {
+	return 15
+}
+
+// Fetch fetches the states daily json
+func (c covidTrackingSource) Fetch() ([]byte, error) {
+	return fetches.fetch(c.Name(), covidTrackingURL)
+}
+
+// Parse parses the states daily data in json or csv format into observations of tests and hospitalisations for every day
+// Cols: date,state,positive,negative,...,hospitalizedCumulative,...,totalTestResults,...
+// date is in the format 20200501, values may be missing on days a state did not report
+// observations are for the state code, states not in areas.csv are unmatched when applied
+func (covidTrackingSource) Parse(data []byte) ([]Observation, error) {
+	var records []map[string]string
+	var err error
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		records, err = parseCovidTrackingJSON(data)
+	} else {
+		records, err = parseCovidTrackingCSV(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("series: update from covidtracking %d records", len(records))
+
+	var observations []Observation
+	for _, r := range records {
+		date, err := time.Parse("20060102", r["date"])
+		if err != nil {
+			log.Printf("series: error reading covidtracking date:%s error:%s", r["date"], err)
+			continue
+		}
+
+		// Older data has no totalTestResults, so use the total of positive and negative tests
+		tested := atoiOrZero(r["totalTestResults"])
+		if tested == 0 {
+			tested = atoiOrZero(r["positive"]) + atoiOrZero(r["negative"])
+		}
+		if tested > 0 {
+			observations = append(observations, Observation{
+				Country:  "US",
+				Province: r["state"],
+				Date:     date,
+				DataKind: DataTested,
+				Value:    tested,
+			})
+		}
+
+		// Older data has only hospitalized, which was the cumulative total
+		hospitalised := atoiOrZero(r["hospitalizedCumulative"])
+		if hospitalised == 0 {
+			hospitalised = atoiOrZero(r["hospitalized"])
+		}
+		if hospitalised > 0 {
+			observations = append(observations, Observation{
+				Country:  "US",
+				Province: r["state"],
+				Date:     date,
+				DataKind: DataHospitalised,
+				Value:    hospitalised,
+			})
+		}
+	}
+
+	return observations, nil
+}
+
+// parseCovidTrackingJSON parses covidtracking json into records of field values as strings
+// numbers may be null in the json, these are returned as empty strings
+func parseCovidTrackingJSON(data []byte) ([]map[string]string, error) {
+	var entries []map[string]interface{}
+	err := json.Unmarshal(data, &entries)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []map[string]string
+	for _, entry := range entries {
+		record := make(map[string]string)
+		for name, value := range entry {
+			switch v := value.(type) {
+			case string:
+				record[name] = v
+			case float64:
+				record[name] = strconv.FormatFloat(v, 'f', -1, 64)
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// parseCovidTrackingCSV parses covidtracking csv into records of field values keyed by the header row
+func parseCovidTrackingCSV(data []byte) ([]map[string]string, error) {
+	rows, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("series: empty covidtracking data")
+	}
+
+	header := rows[0]
+	if len(header) < 2 || header[0] != "date" || header[1] != "state" {
+		return nil, fmt.Errorf("error reading covidtracking data - format invalid for row:%s", header)
+	}
+
+	var records []map[string]string
+	for _, row := range rows[1:] {
+		record := make(map[string]string)
+		for i, name := range header {
+			record[name] = row[i]
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// atoiOrZero returns the integer value of s, or 0 if s is empty or invalid
+func atoiOrZero(s string) int {
+	v, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return 0
+	}
+	return v
+}
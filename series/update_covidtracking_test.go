@@ -0,0 +1,45 @@
+package series
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCovidTrackingParse(t *testing.T) {
+	json := `[
+{"date":20200502,"state":"NY","positive":100,"negative":900,"totalTestResults":1000,"hospitalizedCumulative":20,"hospitalized":20,"death":5},
+{"date":20200501,"state":"NY","positive":50,"negative":450,"totalTestResults":null,"hospitalizedCumulative":null,"hospitalized":10,"death":2},
+{"date":20200501,"state":"WY","positive":null,"negative":null,"totalTestResults":null,"hospitalizedCumulative":null,"hospitalized":null,"death":null}
+]`
+	csv := "date,state,positive,negative,totalTestResults,hospitalizedCumulative,hospitalized,death\n" +
+		"20200502,NY,100,900,1000,20,20,5\n" +
+		"20200501,NY,50,450,,,10,2\n" +
+		"20200501,WY,,,,,,\n"
+
+	source := NewCovidTrackingSource()
+	for _, data := range []string{json, csv} {
+		observations, err := source.Parse([]byte(data))
+		if err != nil {
+			t.Fatalf("covidtracking: failed to parse:%s", err)
+		}
+
+		// Days without values are skipped, and old days use positive+negative and hospitalized
+		if len(observations) != 4 {
+			t.Fatalf("covidtracking: wrong observations got:%v", observations)
+		}
+		date := time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC)
+		for i, want := range []Observation{
+			{Country: "US", Province: "NY", Date: date, DataKind: DataTested, Value: 500},
+			{Country: "US", Province: "NY", Date: date, DataKind: DataHospitalised, Value: 10},
+		} {
+			if observations[i+2] != want {
+				t.Errorf("covidtracking: wrong observation want:%v got:%v", want, observations[i+2])
+			}
+		}
+	}
+
+	_, err := source.Parse([]byte("state,date\nNY,20200501\n"))
+	if err == nil {
+		t.Errorf("covidtracking: expected error for invalid format")
+	}
+}
@@ -0,0 +1,217 @@
+package series
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ecdcURL is the url of the ECDC geographic distribution of cases worldwide, in csv format
+// the same data is available in json format by replacing csv with json
+const ecdcURL = "https://opendata.ecdc.europa.eu/covid19/casedistribution/csv"
+
+// ecdcCountries maps ECDC geoId codes to our country names where ECDC names them differently
+// other countries are matched by name, with underscores replaced by spaces
+var ecdcCountries = map[string]string{
+	"BN": "Brunei",
+	"CD": "Congo (Kinshasa)",
+	"CG": "Congo (Brazzaville)",
+	"CI": "Cote d'Ivoire",
+	"CV": "Cabo Verde",
+	"GW": "Guinea-Bissau",
+	"KR": "South Korea",
+	"PS": "West Bank and Gaza",
+	"TL": "Timor-Leste",
+	"TZ": "Tanzania",
+	"UK": "United Kingdom",
+	"US": "US",
+}
+
+// ecdcRecord is one day of new cases and deaths for a country in ECDC data
+type ecdcRecord struct {
+	country string
+	date    time.Time
+	cases   int
+	deaths  int
+}
+
+// ecdcSource updates deaths and confirmed cases for countries from ECDC data, including all historical days
+// ECDC values are only used for days where a series has no value from other sources,
+// unless ECDC is listed for the country in the priorities file
+type ecdcSource struct{}
+
+// NewECDCSource returns a source for ECDC data
+func NewECDCSource() Source {
+	return ecdcSource{}
+}
+
+// Name returns the name of the source
+func (e ecdcSource) Name() string {
+	return "ecdc"
+}
+
+// Schedule returns the interval between updates, ECDC publish once a day at varying times
+func (e ecdcSource) Schedule() time.Duration {
+	return 6 * time.Hour
+}
+
+// Priority returns the priority of the source, ECDC is used after JHU
+func (e ecdcSource) Priority() int {
+	return 5
+}
+
+// Fetch fetches the ECDC csv file
+func (e ecdcSource) Fetch() ([]byte, error) {
+	return fetches.fetch(e.Name(), ecdcURL)
+}
+
+// Parse parses ECDC data in csv or json format into observations of cumulative totals for every day
+func (e ecdcSource) Parse(data []byte) ([]Observation, error) {
+	var records []ecdcRecord
+	var err error
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		records, err = parseECDCJSON(data)
+	} else {
+		records, err = parseECDCCSV(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("series: update from ECDC %d records", len(records))
+
+	return e.observations(records), nil
+}
+
+// observations converts daily ECDC records into cumulative observations,
+// ECDC data starts before our series so days before the start of our series are still counted
+func (e ecdcSource) observations(records []ecdcRecord) []Observation {
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].country != records[j].country {
+			return records[i].country < records[j].country
+		}
+		return records[i].date.Before(records[j].date)
+	})
+
+	var observations []Observation
+	var deaths, cases int
+	for i, r := range records {
+		if i == 0 || r.country != records[i-1].country {
+			deaths, cases = 0, 0
+		}
+		deaths += r.deaths
+		cases += r.cases
+
+		observations = append(observations,
+			Observation{Country: r.country, Date: r.date, DataKind: DataDeaths, Value: deaths, Fallback: true},
+			Observation{Country: r.country, Date: r.date, DataKind: DataConfirmed, Value: cases, Fallback: true},
+		)
+	}
+	return observations
+}
+
+// ecdcCountry returns our country name for an ECDC country name and geoId
+func ecdcCountry(name, geoID string) string {
+	country, ok := ecdcCountries[geoID]
+	if ok {
+		return country
+	}
+	return strings.Replace(name, "_", " ", -1)
+}
+
+// parseECDCCSV parses records from ECDC csv data
+// Cols: dateRep,day,month,year,cases,deaths,countriesAndTerritories,geoId,...
+// columns are found by name in the header row as they have changed over time
+func parseECDCCSV(data []byte) ([]ecdcRecord, error) {
+	rows, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("series: empty ECDC data")
+	}
+
+	// The header may start with a byte order mark
+	cols := make(map[string]int)
+	for i, name := range rows[0] {
+		cols[strings.TrimPrefix(name, "\ufeff")] = i
+	}
+	for _, name := range []string{"dateRep", "cases", "deaths", "countriesAndTerritories", "geoId"} {
+		if _, ok := cols[name]; !ok {
+			return nil, fmt.Errorf("series: error reading ECDC data - missing column:%s", name)
+		}
+	}
+
+	var records []ecdcRecord
+	for _, row := range rows[1:] {
+		r, err := ecdcRecordFor(row[cols["dateRep"]], row[cols["cases"]], row[cols["deaths"]], row[cols["countriesAndTerritories"]], row[cols["geoId"]])
+		if err != nil {
+			log.Printf("series: error reading ECDC row:%s error:%s", row, err)
+			continue
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+// parseECDCJSON parses records from ECDC json data, which has the same fields as the csv in a list of records
+// values may be strings or numbers
+func parseECDCJSON(data []byte) ([]ecdcRecord, error) {
+	var jsonData struct {
+		Records []map[string]interface{} `json:"records"`
+	}
+	err := json.Unmarshal(data, &jsonData)
+	if err != nil {
+		return nil, err
+	}
+
+	field := func(entry map[string]interface{}, name string) string {
+		switch v := entry[name].(type) {
+		case string:
+			return v
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		}
+		return ""
+	}
+
+	var records []ecdcRecord
+	for _, entry := range jsonData.Records {
+		r, err := ecdcRecordFor(field(entry, "dateRep"), field(entry, "cases"), field(entry, "deaths"), field(entry, "countriesAndTerritories"), field(entry, "geoId"))
+		if err != nil {
+			log.Printf("series: error reading ECDC record:%v error:%s", entry, err)
+			continue
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+// ecdcRecordFor returns a record from the string values of ECDC fields
+// daily values may be negative where ECDC have corrected earlier figures
+func ecdcRecordFor(dateRep, cases, deaths, name, geoID string) (ecdcRecord, error) {
+	date, err := time.Parse("02/01/2006", dateRep)
+	if err != nil {
+		return ecdcRecord{}, err
+	}
+	c, err := strconv.Atoi(cases)
+	if err != nil && cases != "" {
+		return ecdcRecord{}, err
+	}
+	d, err := strconv.Atoi(deaths)
+	if err != nil && deaths != "" {
+		return ecdcRecord{}, err
+	}
+	return ecdcRecord{
+		country: ecdcCountry(name, geoID),
+		date:    date,
+		cases:   c,
+		deaths:  d,
+	}, nil
+}
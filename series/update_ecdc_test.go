@@ -0,0 +1,78 @@
+package series
+
+import (
+	"testing"
+	"time"
+)
+
+const testECDCCSV = "\ufeffdateRep,day,month,year,cases,deaths,countriesAndTerritories,geoId,countryterritoryCode,popData2019\n" +
+	"02/05/2020,2,5,2020,3,2,United_Kingdom,UK,GBR,66647112\n" +
+	"01/05/2020,1,5,2020,10,1,United_Kingdom,UK,GBR,66647112\n" +
+	"01/05/2020,1,5,2020,7,0,Antigua_and_Barbuda,AG,ATG,97115\n" +
+	"01/05/2020,1,5,2020,7,0,Cases_on_an_international_conveyance_Japan,JPG11668,,\n"
+
+const testECDCJSON = `{"records":[
+{"dateRep":"02/05/2020","cases":3,"deaths":2,"countriesAndTerritories":"United_Kingdom","geoId":"UK"},
+{"dateRep":"01/05/2020","cases":"10","deaths":"1","countriesAndTerritories":"United_Kingdom","geoId":"UK"}
+]}`
+
+func TestECDCParse(t *testing.T) {
+	source := NewECDCSource()
+	for _, data := range []string{testECDCCSV, testECDCJSON} {
+		observations, err := source.Parse([]byte(data))
+		if err != nil {
+			t.Fatalf("ecdc: failed to parse:%s", err)
+		}
+
+		// Totals are cumulative and records sorted by date, UK is found by geoId
+		var uk []Observation
+		for _, o := range observations {
+			if o.Country == "United Kingdom" {
+				uk = append(uk, o)
+			}
+		}
+		if len(uk) != 4 {
+			t.Fatalf("ecdc: wrong observations got:%v", uk)
+		}
+		want := Observation{Country: "United Kingdom", Date: time.Date(2020, 5, 2, 0, 0, 0, 0, time.UTC), DataKind: DataConfirmed, Value: 13, Fallback: true}
+		if uk[3] != want {
+			t.Errorf("ecdc: wrong observation want:%v got:%v", want, uk[3])
+		}
+	}
+
+	_, err := source.Parse([]byte("date,cases\n01/05/2020,1\n"))
+	if err == nil {
+		t.Errorf("ecdc: expected error for missing columns")
+	}
+}
+
+func TestECDCFallback(t *testing.T) {
+	slice := Slice{{ID: 1, Country: "United Kingdom"}, {ID: 2, Country: "Antigua and Barbuda"}}
+	for _, s := range slice {
+		s.AddDays(int(time.Date(2020, 5, 4, 0, 0, 0, 0, time.UTC).Sub(seriesStartDate).Hours()/24) + 1)
+	}
+	uk, antigua := slice[0], slice[1]
+	may1 := uk.DayIndex(time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC))
+	uk.SetValue(may1, DataConfirmed, 50)
+	antigua.SetValue(may1, DataConfirmed, 50)
+
+	observations, err := NewECDCSource().Parse([]byte(testECDCCSV))
+	if err != nil {
+		t.Fatalf("ecdc: failed to parse:%s", err)
+	}
+	priorities := NewPriorities()
+	priorities.rules = []priorityRule{{country: "United Kingdom", metric: "*", sources: []string{"ecdc", "jhu"}, maxAge: priorityMaxAge}}
+	observations = priorities.resolve(slice.Index(), "ecdc", observations, time.Now().UTC())
+	unmatched := slice.applyObservations(observations, nil)
+	if unmatched != 2 {
+		t.Errorf("ecdc: wrong unmatched want:2 got:%d", unmatched)
+	}
+
+	// ECDC is listed first for the UK so replaces values, but only fills gaps for other countries
+	if uk.Day(may1).Confirmed != 10 || uk.Day(may1+1).Confirmed != 13 {
+		t.Errorf("ecdc: primary values not used got:%v", uk.Day(may1))
+	}
+	if antigua.Day(may1).Confirmed != 50 {
+		t.Errorf("ecdc: fallback values used got:%v", antigua.Day(may1))
+	}
+}
@@ -1,29 +1,95 @@
 package series
 
 import (
+	"bytes"
+	"encoding/csv"
 	"fmt"
 	"log"
 	"strconv"
 	"time"
 )
 
+// JHU publish current totals for countries and for states in separate files
+const (
+	jhuCountryCasesURL = "https://raw.githubusercontent.com/CSSEGISandData/COVID-19/web-data/data/cases_country.csv"
+	jhuStatesCasesURL  = "https://raw.githubusercontent.com/CSSEGISandData/COVID-19/web-data/data/cases_state.csv"
+)
+
+// jhuSource updates the latest day of series from one of the JHU current cases files
+type jhuSource struct {
+	name         string
+	url          string
+	observations func(rows [][]string) ([]Observation, error)
+}
+
+// Name returns the name of the source
+func (j jhuSource) Name() string {
+	return j.name
+}
+
+// Schedule returns the interval between updates
+func (j jhuSource) Schedule() time.Duration {
+	return 15 * time.Minute
+}
+
+// Priority returns the priority of the source, JHU is used for areas without a national source
+func (j jhuSource) Priority() int {
+	return 10
+}
+
+// Fetch fetches the cases csv file
+func (j jhuSource) Fetch() ([]byte, error) {
+	return fetches.fetch(j.name, j.url)
+}
+
+// Parse parses the cases csv file into observations for the latest day
+func (j jhuSource) Parse(data []byte) ([]Observation, error) {
+	rows, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	return j.observations(rows)
+}
+
+// jhuObservations returns observations for the latest day of deaths, confirmed and recovered in an area
+// we don't have tested data from JHU so it is left unchanged
+func jhuObservations(country, province string, updated time.Time, deaths, confirmed, recovered int) []Observation {
+	return []Observation{
+		{Country: country, Province: province, DataKind: DataDeaths, Value: deaths, UpdatedAt: updated},
+		{Country: country, Province: province, DataKind: DataConfirmed, Value: confirmed, UpdatedAt: updated},
+		{Country: country, Province: province, DataKind: DataRecovered, Value: recovered, UpdatedAt: updated},
+	}
+}
+
+// UpdateFromJHUCountryCases updates the default store, see Store.UpdateFromJHUCountryCases
+func UpdateFromJHUCountryCases(rows [][]string) error {
+	return defaultStore.UpdateFromJHUCountryCases(rows)
+}
+
 // UpdateFromJHUCountryCases updates from JHU country cases data files
 // several files are required to get all data, all with different formats
 // Cols: Country_Region,Last_Update,Lat,Long_,Confirmed,Deaths,Recovered,Active
-func UpdateFromJHUCountryCases(rows [][]string) error {
+func (s *Store) UpdateFromJHUCountryCases(rows [][]string) error {
+	observations, err := jhuCountryObservations(rows)
+	if err != nil {
+		return err
+	}
+	_, err = s.applyObservations("jhu", observations)
+	return err
+}
 
-	// Lock during add operation
-	mutex.Lock()
-	defer mutex.Unlock()
+// jhuCountryObservations returns observations for the latest day from JHU country cases rows
+func jhuCountryObservations(rows [][]string) ([]Observation, error) {
 
 	log.Printf("series: update from JHU country cases %d rows", len(rows))
 
 	// For each row in the input data, reject if admin2 completed
+	var observations []Observation
 	for i, row := range rows {
 		// Check format on row 0
 		if i == 0 {
-			if row[0] != "Country_Region" || row[1] != "Last_Update" || row[7] != "Active" {
-				return fmt.Errorf("error reading JHU country cases - format invalid for row:%s", row)
+			if len(row) < 8 || row[0] != "Country_Region" || row[1] != "Last_Update" || row[7] != "Active" {
+				return nil, fmt.Errorf("error reading JHU country cases - format invalid for row:%s", row)
 			}
 			continue
 		}
@@ -31,11 +97,6 @@ func UpdateFromJHUCountryCases(rows [][]string) error {
 		country := row[0]
 		province := ""
 
-		// Skip some countries for which we have data from a country provider
-		if country == "United Kingdom" {
-			continue
-		}
-
 		// Transform countries
 		switch country {
 		case "Burma":
@@ -45,47 +106,52 @@ func UpdateFromJHUCountryCases(rows [][]string) error {
 		case "Korea, South":
 			country = "South Korea"
 		}
-		// Find the series for this row
-		series, err := dataset.FetchSeries(country, province)
-		if err != nil || series == nil {
-			continue
-		}
-
-		// If we reach here we have a valid row and series - NB shuffled cols to match our default
+		// If we reach here we have a valid row - NB shuffled cols to match our default
 		updated, deaths, confirmed, recovered, err := readJHURowData(row[1], row[5], row[4], row[6])
 		if err != nil {
-			log.Printf("update: error updating series:%s error:%s", series, err)
+			log.Printf("update: error updating series:%s error:%s", country, err)
 			continue
 		}
 
-		// We don't hav etested data from JHU so leave it unchanged
-		series.UpdateToday(updated, deaths, confirmed, recovered, 0)
+		observations = append(observations, jhuObservations(country, province, updated, deaths, confirmed, recovered)...)
 
-		log.Printf("update: %s u:%v d:%d c:%d r:%d", series, updated, deaths, confirmed, recovered)
+		log.Printf("update: %s u:%v d:%d c:%d r:%d", country, updated, deaths, confirmed, recovered)
 
 	}
 
-	return nil
+	return observations, nil
+}
+
+// UpdateFromJHUStatesCases updates the default store, see Store.UpdateFromJHUStatesCases
+func UpdateFromJHUStatesCases(rows [][]string) error {
+	return defaultStore.UpdateFromJHUStatesCases(rows)
 }
 
 // UpdateFromJHUStatesCases updates from JHU states cases data files
 // several files are required to get all data, all with different formats
 //  0    1    			2				3			4  5     	6		7		8		9
 // FIPS,Province_State,Country_Region,Last_Update,Lat,Long_,Confirmed,Deaths,Recovered,Active
-func UpdateFromJHUStatesCases(rows [][]string) error {
+func (s *Store) UpdateFromJHUStatesCases(rows [][]string) error {
+	observations, err := jhuStatesObservations(rows)
+	if err != nil {
+		return err
+	}
+	_, err = s.applyObservations("jhu-states", observations)
+	return err
+}
 
-	// Lock during add operation
-	mutex.Lock()
-	defer mutex.Unlock()
+// jhuStatesObservations returns observations for the latest day from JHU states cases rows
+func jhuStatesObservations(rows [][]string) ([]Observation, error) {
 
 	log.Printf("series: update from JHU states cases %d rows", len(rows))
 
 	// For each row in the input data, reject if admin2 completed
+	var observations []Observation
 	for i, row := range rows {
 		// Check format on row 0
 		if i == 0 {
-			if row[0] != "Province_State" || row[1] != "Country_Region" || row[2] != "Last_Update" || row[8] != "Active" {
-				return fmt.Errorf("error reading JHU states cases - format invalid for row:%s", row)
+			if len(row) < 9 || row[0] != "Province_State" || row[1] != "Country_Region" || row[2] != "Last_Update" || row[8] != "Active" {
+				return nil, fmt.Errorf("error reading JHU states cases - format invalid for row:%s", row)
 			}
 			continue
 		}
@@ -107,28 +173,20 @@ func UpdateFromJHUStatesCases(rows [][]string) error {
 			continue
 		}
 
-		// Find the series concerned
-		series, err := dataset.FetchSeries(country, province)
-		if err != nil || series == nil {
-			log.Printf("series: state series not found for:%s,%s", country, province)
-			continue
-		}
-
-		// If we reach here we have a valid row and series - NB shuffled cols to match our default
+		// If we reach here we have a valid row - NB shuffled cols to match our default
 		updated, deaths, confirmed, recovered, err := readJHURowData(row[2], row[6], row[5], row[7])
 		if err != nil {
 			log.Printf("series: error reading state row:%s\n\terror:%s", row, err)
 			continue
 		}
 
-		// We don't have tested data from JHU so leave it unchanged
-		series.UpdateToday(updated, deaths, confirmed, recovered, 0)
+		observations = append(observations, jhuObservations(country, province, updated, deaths, confirmed, recovered)...)
 
-		//	log.Printf("update province: %s u:%v d:%d c:%d r:%d", series, updated, deaths, confirmed, recovered)
+		//	log.Printf("update province: %s,%s u:%v d:%d c:%d r:%d", country, province, updated, deaths, confirmed, recovered)
 
 	}
 
-	return nil
+	return observations, nil
 }
 
 // Note csv col order is different from our standard order
@@ -6,6 +6,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 // UpdateUKData updates older data as a one-off
@@ -30,88 +31,114 @@ func UpdateUKData() error {
 	return nil
 }
 
-// Generate days for each country?
-// Perhaps just fetch series concerned and directly update in memory?
+// ukDeathsURL is the url of the UK government deaths data, linked from gov.uk
+// https://www.gov.uk/guidance/coronavirus-covid-19-information-for-the-public#number-of-cases-and-deaths
+const ukDeathsURL = "https://c19downloads.azureedge.net/downloads/json/coronavirus-deaths_latest.json"
 
-// UpdateUKDeaths is used to update historical deaths for the uk
-// a simpler update function can be used to update daily?
-func UpdateUKDeaths(jsonData map[string]interface{}) error {
+// ukSource updates deaths for the UK and its countries from UK government data
+// this includes historical figures, which are revised by the source
+type ukSource struct{}
 
-	// Lock during add operation
-	mutex.Lock()
-	defer mutex.Unlock()
+// Name returns the name of the source
+func (ukSource) Name() string {
+	return "uk"
+}
 
-	ukDeaths := make(map[string]int)
-	englandDeaths := make(map[string]int)
-	walesDeaths := make(map[string]int)
-	scotlandDeaths := make(map[string]int)
-	niDeaths := make(map[string]int)
+// Schedule returns the interval between updates
+func (ukSource) Schedule() time.Duration {
+	return 15 * time.Minute
+}
 
-	// Read JSON - two lists - one overview and one 'countries' for every country
+// Priority returns the priority of the source, national sources have priority over JHU
+func (ukSource) Priority() int {
+	return 20
+}
 
-	// Read the overview - uk data
-	overview := jsonData["overview"].([]interface{})
-	for _, e := range overview {
-		entry := e.(map[string]interface{})
-		deaths, _ := entry["cumulativeDeaths"].(float64)
-		date, _ := entry["reportingDate"].(string)
-
-		switch entry["areaName"] {
-		case "United Kingdom":
-			ukDeaths[date] = int(deaths)
-		}
-	}
+// Fetch fetches the latest deaths json
+func (ukSource) Fetch() ([]byte, error) {
+	return fetches.fetch(ukSource{}.Name(), ukDeathsURL)
+}
 
-	log.Printf("series: update from UK Gov figures %d datapoints", len(overview))
+// Parse parses the deaths json into observations
+func (ukSource) Parse(data []byte) ([]Observation, error) {
+	jsonData := make(map[string]interface{})
+	err := json.Unmarshal(data, &jsonData)
+	if err != nil {
+		return nil, err
+	}
+	return ukObservations(jsonData)
+}
 
-	// Read the countries - sub-uk data
-	countries := jsonData["countries"].([]interface{})
-	for _, e := range countries {
-		entry := e.(map[string]interface{})
-		deaths, _ := entry["cumulativeDeaths"].(float64)
-		date, _ := entry["reportingDate"].(string)
-
-		switch entry["areaName"] {
-		case "England":
-			englandDeaths[date] = int(deaths)
-		case "Wales":
-			walesDeaths[date] = int(deaths)
-		case "Scotland":
-			scotlandDeaths[date] = int(deaths)
-		case "Northern Ireland":
-			niDeaths[date] = int(deaths)
-		}
+// UpdateUKDeaths updates the default store, see Store.UpdateUKDeaths
+func UpdateUKDeaths(jsonData map[string]interface{}) error {
+	return defaultStore.UpdateUKDeaths(jsonData)
+}
 
+// UpdateUKDeaths is used to update historical deaths for the uk from UK government json
+// as for updates from ukSource, but with json already decoded
+func (s *Store) UpdateUKDeaths(jsonData map[string]interface{}) error {
+	observations, err := ukObservations(jsonData)
+	if err != nil {
+		return err
 	}
-
-	// Make sure last day deaths are up to date too for these series
-	// NB this updates historical figures too
-	updateUKSeries("United Kingdom", "", ukDeaths)
-	updateUKSeries("United Kingdom", "England", englandDeaths)
-	updateUKSeries("United Kingdom", "Wales", walesDeaths)
-	updateUKSeries("United Kingdom", "Scotland", scotlandDeaths)
-	updateUKSeries("United Kingdom", "Northern Ireland", niDeaths)
-	return nil
+	_, err = s.applyObservations(ukSource{}.Name(), observations)
+	return err
 }
 
-func updateUKSeries(country, province string, deaths map[string]int) error {
-	// Fetch the series
-	series, err := dataset.FetchSeries(country, province)
-	if err != nil || series.Count() == 0 {
-		return fmt.Errorf("failed to fetch %s,%s series:%s", err, province, country)
+// ukObservations returns observations of deaths by date from UK government json
+// Read JSON - two lists - one overview for the uk and one 'countries' for every country
+func ukObservations(jsonData map[string]interface{}) ([]Observation, error) {
+	overview, ok := jsonData["overview"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("series: uk json missing overview")
 	}
-	// Walk the uk series and where we have a match on dates set the data
-	for _, day := range series.Days {
-		deaths, ok := deaths[day.DateMachine()]
-		if ok {
-			day.Deaths = deaths
-		}
+	countries, ok := jsonData["countries"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("series: uk json missing countries")
 	}
-	// If we don't have last day deaths set correctly, set them
-	if series.Days[len(series.Days)-1].Deaths < series.Days[len(series.Days)-2].Deaths {
-		series.Days[len(series.Days)-1].Deaths = series.Days[len(series.Days)-2].Deaths
+
+	log.Printf("series: update from UK Gov figures %d datapoints", len(overview))
+
+	var observations []Observation
+	add := func(entries []interface{}, provinces map[string]string) {
+		for _, e := range entries {
+			entry, ok := e.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			name, _ := entry["areaName"].(string)
+			province, ok := provinces[name]
+			if !ok {
+				continue
+			}
+			deaths, _ := entry["cumulativeDeaths"].(float64)
+			reported, _ := entry["reportingDate"].(string)
+			date, err := time.Parse("2006-01-02", reported)
+			if err != nil {
+				continue
+			}
+			observations = append(observations, Observation{
+				Country:  "United Kingdom",
+				Province: province,
+				Date:     date,
+				DataKind: DataDeaths,
+				Value:    int(deaths),
+			})
+		}
 	}
-	return nil
+
+	// Read the overview - uk data
+	add(overview, map[string]string{"United Kingdom": ""})
+
+	// Read the countries - sub-uk data
+	add(countries, map[string]string{
+		"England":          "England",
+		"Wales":            "Wales",
+		"Scotland":         "Scotland",
+		"Northern Ireland": "Northern Ireland",
+	})
+
+	return observations, nil
 }
 
 // UpdateUKTemp updates older data as a one-off
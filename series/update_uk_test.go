@@ -93,9 +93,12 @@ func TestUKJSONAssign(t *testing.T) {
 	// Add days up to today so that we can update them
 	days := int(time.Now().UTC().Sub(seriesStartDate).Hours() / 24)
 	// For every series add the right number of days up to and including today
-	for _, series := range dataset {
-		series.AddDays(days)
-	}
+	Update(func(slice Slice) error {
+		for _, series := range slice {
+			series.AddDays(days)
+		}
+		return nil
+	})
 
 	// Now load json
 	p, _ = filepath.Abs("testdata/uk.json")
@@ -116,7 +119,7 @@ func TestUKJSONAssign(t *testing.T) {
 	}
 
 	// Test fetch of wales and value
-	wales, err := dataset.FetchSeries("United Kingdom", "Wales")
+	wales, err := Current().FetchSeries("United Kingdom", "Wales")
 	if err != nil {
 		t.Fatalf("failed to fetch wales:%s", err)
 	}
@@ -0,0 +1,431 @@
+package series
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// quarantineHeader is the header row of the quarantine file
+const quarantineHeader = "id,time,source,area_id,date,metric,old,new,reason"
+
+// Defaults for validation of observations
+const (
+	validateMaxDecrease = 0.1  // fraction by which a historical value may fall
+	validateMaxSpike    = 10.0 // multiple of the mean daily increase over the previous week
+	validateMinSpike    = 1000 // increases smaller than this are never spikes
+	validateRewriteDays = 14   // days before the latest day which may be revised freely
+	validateMaxRewrite  = 0.25 // fraction by which older days may be revised
+)
+
+// QuarantineEntry records an observation held for review, with the value it would replace
+type QuarantineEntry struct {
+	ID     int
+	Time   time.Time
+	Source string
+	AreaID int
+	Date   time.Time
+	Metric int // data kind, e.g. DataDeaths
+	Old    int
+	New    int
+	Reason string
+}
+
+// MetricName returns the name of the metric for this entry, e.g. deaths
+func (e QuarantineEntry) MetricName() string {
+	return journalMetrics[e.Metric]
+}
+
+// Validator checks observations before they are applied
+// values above the population of an area are rejected, and suspicious changes are held in quarantine for review:
+// large decreases, spikes well above the recent daily increase, and large revisions of older days
+type Validator struct {
+	// Path is the path of the quarantine file, quarantined entries are kept in memory only if blank
+	Path string
+
+	MaxDecrease float64
+	MaxSpike    float64
+	MinSpike    int
+	RewriteDays int
+	MaxRewrite  float64
+
+	mutex   sync.Mutex
+	entries []QuarantineEntry
+	nextID  int
+}
+
+// NewValidator returns a validator with default thresholds and nothing quarantined
+func NewValidator() *Validator {
+	return &Validator{
+		MaxDecrease: validateMaxDecrease,
+		MaxSpike:    validateMaxSpike,
+		MinSpike:    validateMinSpike,
+		RewriteDays: validateRewriteDays,
+		MaxRewrite:  validateMaxRewrite,
+		nextID:      1,
+	}
+}
+
+// LoadValidator returns a validator with default thresholds, and entries quarantined in the file at p (if any)
+func LoadValidator(p string) (*Validator, error) {
+	v := NewValidator()
+	v.Path = p
+
+	data, err := os.ReadFile(p)
+	if os.IsNotExist(err) {
+		return v, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	log.Printf("data: loading file at path:%v", p)
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = 9
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("series: failed to read quarantine:%s error:%s", p, err)
+	}
+
+	for i, row := range rows {
+		if i == 0 {
+			continue
+		}
+		e, err := parseQuarantineRow(row)
+		if err != nil {
+			return nil, fmt.Errorf("series: invalid row in quarantine:%v error:%s", row, err)
+		}
+		v.entries = append(v.entries, e)
+		if e.ID >= v.nextID {
+			v.nextID = e.ID + 1
+		}
+	}
+
+	return v, nil
+}
+
+// parseQuarantineRow parses a row of the quarantine file
+func parseQuarantineRow(row []string) (QuarantineEntry, error) {
+	t, err := time.Parse(time.RFC3339, row[1])
+	if err != nil {
+		return QuarantineEntry{}, err
+	}
+	date, err := time.Parse("2006-01-02", row[4])
+	if err != nil {
+		return QuarantineEntry{}, err
+	}
+
+	e := QuarantineEntry{Time: t, Source: row[2], Date: date, Metric: metricForName(row[5]), Reason: row[8]}
+	if e.Metric == DataNone {
+		return QuarantineEntry{}, fmt.Errorf("invalid metric")
+	}
+
+	values := make([]int, 4)
+	for i, col := range []string{row[0], row[3], row[6], row[7]} {
+		values[i], err = strconv.Atoi(col)
+		if err != nil {
+			return QuarantineEntry{}, err
+		}
+	}
+	e.ID, e.AreaID, e.Old, e.New = values[0], values[1], values[2], values[3]
+	return e, nil
+}
+
+// validate checks observation o for day i of series, returning a reason if it should not be applied,
+// and whether it should be held for review rather than rejected
+func (v *Validator) validate(series *Data, i int, o Observation) (string, bool) {
+	current := series.Value(i, o.DataKind)
+	if o.Value == current {
+		return "", false
+	}
+
+	if series.Population > 0 && o.Value > series.Population {
+		return fmt.Sprintf("value above population:%d", series.Population), false
+	}
+
+	last := series.Count() - 1
+
+	// Values on the latest day are only raised, so decreases need not be checked there
+	if i < last && current > 0 && float64(current-o.Value) > v.MaxDecrease*float64(current) {
+		return fmt.Sprintf("decrease of %d from %d", current-o.Value, current), true
+	}
+
+	if i < last-v.RewriteDays && current > 0 && abs(o.Value-current) > int(v.MaxRewrite*float64(current)) {
+		return fmt.Sprintf("revision of %d to a value %d days old", o.Value-current, last-i), true
+	}
+
+	// Compare the increase over the previous day with the mean daily increase over the week before
+	if i > 0 {
+		increase := o.Value - series.Value(i-1, o.DataKind)
+		from := i - 8
+		if from < 0 {
+			from = 0
+		}
+		mean := 1.0
+		if i-1 > from {
+			mean = float64(series.Value(i-1, o.DataKind)-series.Value(from, o.DataKind)) / float64(i-1-from)
+			if mean < 1 {
+				mean = 1
+			}
+		}
+		if increase > v.MinSpike && float64(increase) > v.MaxSpike*mean {
+			return fmt.Sprintf("increase of %d against mean of %.0f", increase, mean), true
+		}
+	}
+
+	return "", false
+}
+
+// checker returns a function to check observations from source before they are applied
+// observations held for review are appended to held if not nil, and are otherwise dropped
+// the function returned by a nil validator accepts every observation
+func (v *Validator) checker(source string, now time.Time, held *[]QuarantineEntry) func(*Data, int, Observation) bool {
+	if v == nil {
+		return nil
+	}
+	return func(series *Data, i int, o Observation) bool {
+		reason, hold := v.validate(series, i, o)
+		if reason == "" {
+			return true
+		}
+		if hold && held != nil {
+			*held = append(*held, QuarantineEntry{
+				Time:   now,
+				Source: source,
+				AreaID: series.ID,
+				Date:   series.Date(i),
+				Metric: o.DataKind,
+				Old:    series.Value(i, o.DataKind),
+				New:    o.Value,
+				Reason: reason,
+			})
+			return false
+		}
+		log.Printf("series: rejected value from source:%s for area:%d day:%d metric:%s value:%d reason:%s", source, series.ID, i, journalMetrics[o.DataKind], o.Value, reason)
+		return false
+	}
+}
+
+// hold adds entries to the quarantine and saves it
+// entries already held with the same value are not added again, as sources send the same figures repeatedly
+func (v *Validator) hold(entries []QuarantineEntry) error {
+	if v == nil || len(entries) == 0 {
+		return nil
+	}
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	var added int
+	for _, e := range entries {
+		same := func(q QuarantineEntry) bool {
+			return q.AreaID == e.AreaID && q.Date.Equal(e.Date) && q.Metric == e.Metric && q.Source == e.Source
+		}
+		if v.find(func(q QuarantineEntry) bool { return same(q) && q.New == e.New }) {
+			continue
+		}
+		// A new value from the source replaces the one held before
+		v.remove(same)
+		e.ID = v.nextID
+		v.nextID++
+		v.entries = append(v.entries, e)
+		added++
+		log.Printf("series: quarantined value from source:%s for area:%d date:%s metric:%s value:%d reason:%s", e.Source, e.AreaID, e.Date.Format("2006-01-02"), journalMetrics[e.Metric], e.New, e.Reason)
+	}
+	if added == 0 {
+		return nil
+	}
+	return v.save()
+}
+
+// find returns true if any entry matches f
+func (v *Validator) find(f func(QuarantineEntry) bool) bool {
+	for _, e := range v.entries {
+		if f(e) {
+			return true
+		}
+	}
+	return false
+}
+
+// remove removes entries matching f, returning the last removed
+func (v *Validator) remove(f func(QuarantineEntry) bool) (QuarantineEntry, bool) {
+	var removed QuarantineEntry
+	var found bool
+	entries := v.entries[:0]
+	for _, e := range v.entries {
+		if f(e) {
+			removed, found = e, true
+			continue
+		}
+		entries = append(entries, e)
+	}
+	v.entries = entries
+	return removed, found
+}
+
+// get returns the entry with id from the quarantine, leaving it in place
+func (v *Validator) get(id int) (QuarantineEntry, error) {
+	if v == nil {
+		return QuarantineEntry{}, fmt.Errorf("series: no quarantine")
+	}
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	for _, e := range v.entries {
+		if e.ID == id {
+			return e, nil
+		}
+	}
+	return QuarantineEntry{}, fmt.Errorf("series: quarantined entry not found:%d", id)
+}
+
+// take removes the entry with id from the quarantine and saves it, returning the entry
+func (v *Validator) take(id int) (QuarantineEntry, error) {
+	if v == nil {
+		return QuarantineEntry{}, fmt.Errorf("series: no quarantine")
+	}
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	e, ok := v.remove(func(q QuarantineEntry) bool { return q.ID == id })
+	if !ok {
+		return QuarantineEntry{}, fmt.Errorf("series: quarantined entry not found:%d", id)
+	}
+	return e, v.save()
+}
+
+// save writes the quarantined entries to the file at Path (if set)
+// the mutex must be held by the caller
+func (v *Validator) save() error {
+	if v.Path == "" {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(strings.Split(quarantineHeader, ","))
+	for _, e := range v.entries {
+		w.Write([]string{
+			strconv.Itoa(e.ID),
+			e.Time.UTC().Format(time.RFC3339),
+			e.Source,
+			strconv.Itoa(e.AreaID),
+			e.Date.Format("2006-01-02"),
+			journalMetrics[e.Metric],
+			strconv.Itoa(e.Old),
+			strconv.Itoa(e.New),
+			e.Reason,
+		})
+	}
+	w.Flush()
+
+	err := writeFileAtomic(v.Path, buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("series: failed to save quarantine:%s", err)
+	}
+	return nil
+}
+
+// Quarantined returns the entries held for review, in the order held
+func (v *Validator) Quarantined() []QuarantineEntry {
+	if v == nil {
+		return nil
+	}
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	return append([]QuarantineEntry(nil), v.entries...)
+}
+
+// abs returns the absolute value of v
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// SetValidator sets the validator used by the default store, see Store.SetValidator
+func SetValidator(v *Validator) {
+	defaultStore.SetValidator(v)
+}
+
+// SetValidator sets a validator to check observations applied by UpdateFromSource and Replay
+func (s *Store) SetValidator(v *Validator) {
+	s.updateMutex.Lock()
+	defer s.updateMutex.Unlock()
+	s.validator = v
+}
+
+// Quarantined returns the entries held for review in the default store, see Store.Quarantined
+func Quarantined() []QuarantineEntry {
+	return defaultStore.Quarantined()
+}
+
+// Quarantined returns the entries held for review by the store validator
+func (s *Store) Quarantined() []QuarantineEntry {
+	s.updateMutex.Lock()
+	v := s.validator
+	s.updateMutex.Unlock()
+	return v.Quarantined()
+}
+
+// ApproveQuarantined applies a quarantined entry to the default store, see Store.ApproveQuarantined
+func ApproveQuarantined(id int) error {
+	return defaultStore.ApproveQuarantined(id)
+}
+
+// ApproveQuarantined applies the value of the entry with id, then removes it from quarantine
+// if the value cannot be applied the entry is left in quarantine
+func (s *Store) ApproveQuarantined(id int) error {
+	s.updateMutex.Lock()
+	v := s.validator
+	s.updateMutex.Unlock()
+
+	e, err := v.get(id)
+	if err != nil {
+		return err
+	}
+
+	err = s.UpdateFrom(e.Source, func(slice Slice) error {
+		series, err := slice.Index().FindSeries(e.AreaID)
+		if err != nil {
+			return err
+		}
+		i := series.DayIndex(e.Date)
+		if i < 0 {
+			return fmt.Errorf("series: date not found for quarantined entry:%d", id)
+		}
+		return series.SetValue(i, e.Metric, e.New)
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("series: approved quarantined value:%d for area:%d date:%s metric:%s", e.New, e.AreaID, e.Date.Format("2006-01-02"), journalMetrics[e.Metric])
+	_, err = v.take(id)
+	return err
+}
+
+// RejectQuarantined discards a quarantined entry in the default store, see Store.RejectQuarantined
+func RejectQuarantined(id int) error {
+	return defaultStore.RejectQuarantined(id)
+}
+
+// RejectQuarantined removes the entry with id from quarantine without applying it
+func (s *Store) RejectQuarantined(id int) error {
+	s.updateMutex.Lock()
+	v := s.validator
+	s.updateMutex.Unlock()
+
+	e, err := v.take(id)
+	if err != nil {
+		return err
+	}
+	log.Printf("series: rejected quarantined value:%d for area:%d date:%s metric:%s", e.New, e.AreaID, e.Date.Format("2006-01-02"), journalMetrics[e.Metric])
+	return nil
+}
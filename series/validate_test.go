@@ -0,0 +1,88 @@
+package series
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestValidator(t *testing.T) {
+	store := NewStore()
+	store.publish(Slice{{ID: 1, Country: "Testland", Population: 100000}})
+	store.Update(func(slice Slice) error {
+		slice[0].AddDays(20)
+		for i := 0; i < 20; i++ {
+			slice[0].SetValue(i, DataDeaths, i*10)
+		}
+		return nil
+	})
+	s := store.Current()[0]
+	last := s.Count() - 1
+
+	p := filepath.Join(t.TempDir(), "quarantine.csv")
+	v, err := LoadValidator(p)
+	if err != nil {
+		t.Fatalf("validate: failed to load:%s", err)
+	}
+	store.SetValidator(v)
+
+	source := &testSource{name: "test", observations: []Observation{
+		{Country: "Testland", DataKind: DataDeaths, Value: 195},                         // accepted
+		{Country: "Testland", Date: s.Date(5), DataKind: DataDeaths, Value: 10},         // large decrease
+		{Country: "Testland", Date: s.Date(1), DataKind: DataDeaths, Value: 20},         // old day revised
+		{Country: "Testland", DataKind: DataConfirmed, Value: 5000},                     // spike
+		{Country: "Testland", Date: s.Date(last - 1), DataKind: DataTested, Value: 1e6}, // above population
+	}}
+	for i := 0; i < 2; i++ {
+		_, _, err = store.UpdateFromSource(source)
+		if err != nil {
+			t.Fatalf("validate: failed to update:%s", err)
+		}
+	}
+
+	s = store.Current()[0]
+	if s.LastDay().Deaths != 195 || s.Day(5).Deaths != 50 || s.Day(1).Deaths != 10 || s.LastDay().Confirmed != 0 || s.Day(last-1).Tested != 0 {
+		t.Errorf("validate: wrong values got:%v %v %v", s.Day(1), s.Day(5), s.LastDay())
+	}
+
+	// Values sent again are not quarantined twice
+	held := store.Quarantined()
+	if len(held) != 3 || held[0].ID != 1 || held[2].ID != 3 || held[0].Old != 50 || held[0].New != 10 {
+		t.Fatalf("validate: wrong quarantine got:%v", held)
+	}
+
+	err = store.ApproveQuarantined(held[0].ID)
+	if err != nil {
+		t.Fatalf("validate: failed to approve:%s", err)
+	}
+	if store.Current()[0].Day(5).Deaths != 10 {
+		t.Errorf("validate: approved value not applied got:%v", store.Current()[0].Day(5))
+	}
+	err = store.RejectQuarantined(held[1].ID)
+	if err != nil {
+		t.Fatalf("validate: failed to reject:%s", err)
+	}
+	err = store.RejectQuarantined(held[1].ID)
+	if err == nil {
+		t.Errorf("validate: expected error for missing entry")
+	}
+
+	// The quarantine is reloaded from file, and ids are not reused
+	v, err = LoadValidator(p)
+	if err != nil {
+		t.Fatalf("validate: failed to reload:%s", err)
+	}
+	held = v.Quarantined()
+	if len(held) != 1 || held[0].ID != 3 || held[0].MetricName() != "confirmed" || held[0].New != 5000 || v.nextID != 4 {
+		t.Errorf("validate: wrong quarantine after reload got:%v", held)
+	}
+
+	// Entries which cannot be applied are kept in quarantine
+	store.SetValidator(v)
+	store.publish(Slice{{ID: 2, Country: "Otherland"}})
+	if store.ApproveQuarantined(held[0].ID) == nil {
+		t.Errorf("validate: expected error approving entry for missing area")
+	}
+	if len(v.Quarantined()) != 1 {
+		t.Errorf("validate: entry removed after failed approval")
+	}
+}
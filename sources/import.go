@@ -23,14 +23,24 @@ func main() {
 // processData reads the source data files and outputs data in our preferred format
 func processData() error {
 
+	// Import into a store of our own rather than the default store used by the server
+	store := series.NewStore()
+
 	// First load the areas data - this sets up a series per area
 	// this is loaded from the live data director
 	areaPath := filepath.Join("..", "data", "areas.csv")
-	err := series.LoadAreas(areaPath)
+	err := store.LoadAreas(areaPath)
 	if err != nil {
 		return fmt.Errorf("data: error loading areas:%s data:%s", areaPath, err)
 	}
 
+	// Use the same source priorities as the server
+	priorities, err := series.LoadPriorities(filepath.Join("..", "data", "priorities.csv"))
+	if err != nil {
+		return fmt.Errorf("data: error loading priorities:%s", err)
+	}
+	store.SetPriorities(priorities)
+
 	// Load all series in sources path
 	sourcePath := "series"
 
@@ -41,35 +51,66 @@ func processData() error {
 	}
 
 	// Now load our series files in the data dir
-	for _, p := range files {
-		name := filepath.Base(p)
-		if strings.HasPrefix(name, "time_series") {
-
-			if strings.HasSuffix(name, "_US.csv") {
-				err = loadUSJHUSeries(p)
-				if err != nil {
-					return err
-				}
-			} else {
-				err = loadJHUSeries(p)
-				if err != nil {
-					return err
+	// series are modified in a copy of the dataset which is published once all files are loaded
+	err = store.Update(func(data series.Slice) error {
+		for _, p := range files {
+			name := filepath.Base(p)
+			if strings.HasPrefix(name, "time_series") {
+
+				if strings.HasSuffix(name, "_US.csv") {
+					err := loadUSJHUSeries(data, p)
+					if err != nil {
+						return err
+					}
+				} else {
+					err := loadJHUSeries(data, p)
+					if err != nil {
+						return err
+					}
 				}
+
 			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
 
+	// Files downloaded from other sources are imported with the source, by file name prefix
+	// ECDC files (ecdc*.csv) are used to backfill days missing in the JHU data
+	// countries with ECDC listed in data/priorities.csv use ECDC data in preference
+	// covidtracking files (covidtracking*.csv) from covidtracking.com/data are used for tests in US states
+	fileSources := map[string]series.Source{
+		"ecdc":          series.NewECDCSource(),
+		"covidtracking": series.NewCovidTrackingSource(),
+	}
+	for _, p := range files {
+		for prefix, source := range fileSources {
+			if !strings.HasPrefix(filepath.Base(p), prefix) {
+				continue
+			}
+			data, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			_, _, err = store.UpdateFromData(source, data)
+			if err != nil {
+				return fmt.Errorf("data: error loading %s file:%s error:%s", prefix, p, err)
+			}
 		}
 	}
 
 	// Now we've loaded all our files we're in theory ready to write out the historical series file which the app will use.
 	// One thing we must do though is fill in global series not in the original dataset which is inconsistent in this regard
 	// Various global indices must be added	before writing out
-	err = series.CalculateGlobalSeriesData()
+	err = store.CalculateGlobalSeriesData()
 	if err != nil {
 		return err
 	}
 
 	// Now print out some of the series to test we have the data we need?
-	global, err := series.FetchSeries("", "")
+	global, err := store.FetchSeries("", "")
 	if err != nil {
 		return err
 	}
@@ -77,18 +118,17 @@ func processData() error {
 	log.Printf("GLOBAL:%s", global.LastDay())
 
 	// Now write out a series.csv file which contains all our data in the desired format cumulative totals per area per day
-	//writeHistoricSeries()
+	//writeHistoricSeries(store.Current())
 
 	p := filepath.Join("output", "series.csv")
-	return series.Save(p)
+	return store.Save(p)
 }
 
 // writeHistoricSeries writes out a series.csv file to the data dir
 // which contains a row for each date/area combo with data for a given date
 // rows which would be all zero are ignored
 // format: day, area_id, deaths, confirmed, recovered, tested
-func writeHistoricSeries() error {
-	data := series.DataSet()
+func writeHistoricSeries(data series.Slice) error {
 
 	var seriesData [][]int
 	var dayData [][]int
@@ -98,7 +138,8 @@ func writeHistoricSeries() error {
 	// for every series, write out the data to a series.csv file
 	for _, s := range data {
 		// For each day, check if it is non-zero, if so write it out
-		for i, d := range s.Days {
+		for i := 0; i < s.Count(); i++ {
+			d := s.Day(i)
 			if !d.IsZero() {
 				// Day number is days since 2020-01-22 start of dataset
 				dayNumber := i + 1
@@ -182,7 +223,7 @@ var seriesStartDate = time.Date(2020, 1, 22, 0, 0, 0, 0, time.UTC)
 // LoadJHUSeries loads a series file for a given datum
 // the file name is used to determine which datum to fill in
 // This reliased on the areas.csv file being loaded first
-func loadJHUSeries(p string) error {
+func loadJHUSeries(data series.Slice, p string) error {
 	// Decide on the datum based on file name
 	dataType := dataTypeForPath(p)
 
@@ -202,7 +243,8 @@ func loadJHUSeries(p string) error {
 	log.Printf("load: loading JHU series:%s", p)
 
 	// Fetch otherSeries for use with cruise ships etc
-	otherSeries, err := series.FetchSeries("Other", "Cruise ships etc")
+	index := data.Index()
+	otherSeries, err := index.FetchSeries("Other", "Cruise ships etc")
 	if err != nil {
 		return err
 	}
@@ -240,9 +282,7 @@ func loadJHUSeries(p string) error {
 			}
 		}
 
-		// FIXME - if in series could lock dataset for write
-
-		series, err := series.FetchSeries(country, province)
+		series, err := index.FetchSeries(country, province)
 		if err != nil || series == nil {
 			// Check if this is a known other, if not log it
 			logSeriesNotFound(country, province)
@@ -299,7 +339,7 @@ func logSeriesNotFound(country, province string) {
 // it doesn't include state level data, so we must sum all counties below states + unattributed
 // the file name is used to determine which datum to fill in
 // This reliased on the areas.csv file being loaded first
-func loadUSJHUSeries(p string) error {
+func loadUSJHUSeries(data series.Slice, p string) error {
 	// Decide on the datum based on file name
 	dataType := dataTypeForPath(p)
 
@@ -326,6 +366,7 @@ func loadUSJHUSeries(p string) error {
 	}
 
 	// Range rows loading data for each country from each row
+	index := data.Index()
 	for i, row := range rows {
 		// Validate header row
 		if i == 0 {
@@ -341,7 +382,7 @@ func loadUSJHUSeries(p string) error {
 		country := row[7]
 		province := row[6]
 
-		series, err := series.FetchSeries(country, province)
+		series, err := index.FetchSeries(country, province)
 		if err != nil || series == nil {
 			// Check if this is a known other, if not log it
 			logSeriesNotFound(country, province)
@@ -1,61 +1,85 @@
 package main
 
 import (
-	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/kennygrant/coronavirus/series"
 )
 
+// scheduler runs updates, see ScheduleUpdates, and its status is shown at /status/jobs
+var scheduler = series.NewScheduler()
+
 // ScheduleUpdates schedules data updates from our data sources
 // after each update data series is resaved and a data reload triggered
 // the changes are also committed to the git repository
 func ScheduleUpdates() {
 	log.Printf("series: scheduling updates")
 
-	// Call update frequent immediately on load to start loading data for todaay
-	go updateFrequent()
-
-	// Schedule calls daily and every 10 mins to update data
-	now := time.Now()
-
-	when := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 5, 0, time.UTC)
-	regularly := 15 * time.Minute // every 15 minutes
-	ScheduleAt(updateFrequent, when, regularly)
+	// Register the sources we update from, each is updated on its own schedule by updateFrequent
+	for _, source := range series.DefaultSources() {
+		series.RegisterSource(source)
+	}
 
-	when = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 1, 0, time.UTC)
-	daily := time.Hour * 24 // daily
-	ScheduleAt(updateDaily, when, daily)
+	// Schedule updates as often as the most frequent source, with jitter so that sources are not all fetched on the minute
+	// and add a new day and compact the journal into the series data at fixed times
+	now := time.Now().UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	scheduler.Add("update", updateFrequent, midnight.Add(5*time.Second), series.SourceInterval(), 30*time.Second)
+	scheduler.Add("daily", updateDaily, midnight.Add(time.Second), 24*time.Hour, 0)
+	scheduler.Add("compact", compactData, midnight.Add(30*time.Minute), time.Hour, 0)
 
+	// Update immediately on load to start loading data for today
+	scheduler.Run("update")
 }
 
 // updateDaily adds a new day to all of our series for today (based on yesterday's figures)
 // it should be run just after UTC zero hours
-func updateDaily() {
+func updateDaily() error {
 	log.Printf("update: updating daily at:%s", time.Now().UTC())
 
 	// Update the series to add today
 	err := series.AddToday()
 	if err != nil {
-		log.Printf("update: failed to add today to series:%s", err)
-		return
+		return fmt.Errorf("failed to add today to series:%s", err)
+	}
+
+	return nil
+}
+
+// compactData saves the series data and clears the journal of updates made since the last save
+// the series data saved is then committed, with a message listing the areas changed since the last save
+func compactData() error {
+	log.Printf("update: compacting data at:%s", time.Now().UTC())
+
+	previous := series.Saved()
+	err := series.Compact()
+	if err != nil {
+		return fmt.Errorf("failed to compact data:%s", err)
 	}
 
+	err = gitCommit(series.CommitMessage(previous, series.Saved(), time.Now().UTC()))
+	if err != nil {
+		return fmt.Errorf("failed to commit change:%s", err)
+	}
+	return nil
 }
 
 // I think for manual updates just edit files and hit the reload endpont
 
 // updateFrequent updates data frequently (every 30 minutes say)
-// Called in a goroutine
+// Called by the scheduler, which never runs it twice at once
 // the dataset is somewhat inconsistent and therefore requires some massaging
 // for example not all countries have global data
 // NB after non-essential failures we just continue rather than log an error
 // some datasources may be down for example, but some not
-func updateFrequent() {
+func updateFrequent() error {
 
 	// Pull the repo first with git to be sure we're up to date
 	err := gitPull()
@@ -63,170 +87,262 @@ func updateFrequent() {
 		log.Printf("update: failed to pull repo:%s", err)
 	}
 
-	// Use UK government data for uk series
-	err = updateUKCases()
-	if err != nil {
-		log.Printf("update: UK FAILED:%s", err)
-	}
-
-	err = updateJHUCases()
-	if err != nil {
-		log.Printf("update: JHU FAILED:%s", err)
+	// Update from each source due an update, failures are logged and recorded in the source report
+	updated, err := series.UpdateSources(time.Now().UTC())
+	if updated == 0 {
+		// If every source due failed, fail so that the scheduler backs off
+		if err != nil {
+			return fmt.Errorf("no sources updated:%s", err)
+		}
+		log.Printf("update: no sources updated")
+		return nil
 	}
 
 	// Now update our global series which are unfortunately not contained in this data
 	err = series.CalculateGlobalSeriesData()
 	if err != nil {
-		log.Printf("update: failed to calculate global series :%s", err)
-		return
+		return fmt.Errorf("failed to calculate global series:%s", err)
 	}
 
-	// Now save the series file to disk
-	err = series.Save("data/series.csv")
-	if err != nil {
-		log.Printf("server: failed to save series data:%s", err)
-		return
-	}
+	// Changes are saved to the journal as they are made, and compacted into the series data
+	// and committed by compactData
+	return nil
+}
 
-	// Finally attempt to commit the change to the report with a suitable commit message
-	message := fmt.Sprintf("Updated from external data for %s", time.Now().UTC().Format("2006-01-02"))
-	err = gitCommit(message)
-	if err != nil {
-		log.Printf("server: failed to commit change:%s", err)
+// replay rebuilds series data from the payloads in data/archive and saves it at p
+// archived payloads are applied on top of the series file at base if given, up to the time until if given
+// the network is not used, and the live series data is not changed unless p is its path
+func replay(p, base, until string) error {
+	var untilTime time.Time
+	if until != "" {
+		var err error
+		untilTime, err = time.Parse(time.RFC3339, until)
+		if err != nil {
+			return fmt.Errorf("invalid time for until:%s", err)
+		}
 	}
 
-}
+	store := series.NewStore()
+	store.SetBackend(series.NewCSVBackend("./data"))
 
-// Update UK stats linked from gov.uk
-// https://www.gov.uk/guidance/coronavirus-covid-19-information-for-the-public#number-of-cases-and-deaths
-func updateUKCases() error {
-
-	filePath := "https://c19downloads.azureedge.net/downloads/json/coronavirus-deaths_latest.json"
-	jsonData, err := downloadJSON(filePath)
+	priorities, err := series.LoadPriorities("./data/priorities.csv")
 	if err != nil {
-		return fmt.Errorf("server: failed to download UK json:%s", err)
+		return err
 	}
+	store.SetPriorities(priorities)
 
-	err = series.UpdateUKDeaths(jsonData)
+	err = store.Replay(series.NewArchive("./data/archive"), series.DefaultSources(), base, untilTime)
 	if err != nil {
-		return fmt.Errorf("server: failed to parse UK json:%s", err)
+		return err
 	}
 
-	return nil
+	return store.Save(p)
 }
 
-func updateJHUCases() error {
-
-	// Download the country cases file into csv rows
-	filePath := "https://raw.githubusercontent.com/CSSEGISandData/COVID-19/web-data/data/cases_country.csv"
-	rows, err := downloadCSV(filePath)
-	if err != nil {
-		return fmt.Errorf("server: failed to download JHU csv:%s", err)
+// handleSources shows the status of updates from each data source
+// FIXME - require authentication for admin pages
+func handleSources(w http.ResponseWriter, r *http.Request) {
+
+	log.Printf("request:%s", r.URL)
+
+	type sourceJSON struct {
+		Name         string `json:"name"`
+		Priority     int    `json:"priority"`
+		Schedule     string `json:"schedule"`
+		LastRun      string `json:"last_run"`
+		LastSuccess  string `json:"last_success"`
+		LastError    string `json:"last_error"`
+		Observations int    `json:"observations"`
+		Unmatched    int    `json:"unmatched"`
+		Requests     int    `json:"requests"`
+		Retries      int    `json:"retries"`
+		NotModified  int    `json:"not_modified"`
+		Failures     int    `json:"failures"`
+		Bytes        int64  `json:"bytes"`
+		LastStatus   int    `json:"last_status"`
+		LastDuration string `json:"last_duration"`
 	}
 
-	// This data has a specific format, ask the series to decode
-	// and update the changed series in memory
-	err = series.UpdateFromJHUCountryCases(rows)
-	if err != nil {
-		return fmt.Errorf("server: failed to update from JHU data :%s", err)
+	report := []sourceJSON{}
+	for _, s := range series.SourceReport() {
+		report = append(report, sourceJSON{
+			Name:         s.Name,
+			Priority:     s.Priority,
+			Schedule:     s.Schedule.String(),
+			LastRun:      formatTime(s.LastRun),
+			LastSuccess:  formatTime(s.LastSuccess),
+			LastError:    s.LastError,
+			Observations: s.Observations,
+			Unmatched:    s.Unmatched,
+			Requests:     s.Fetch.Requests,
+			Retries:      s.Fetch.Retries,
+			NotModified:  s.Fetch.NotModified,
+			Failures:     s.Fetch.Failures,
+			Bytes:        s.Fetch.Bytes,
+			LastStatus:   s.Fetch.LastStatus,
+			LastDuration: s.Fetch.LastDuration.String(),
+		})
 	}
 
-	// Update from the cases_states file for sub-country state data
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(report)
+}
 
-	// Download the US states cases file into csv rows
-	filePath = "https://raw.githubusercontent.com/CSSEGISandData/COVID-19/web-data/data/cases_state.csv"
-	rows, err = downloadCSV(filePath)
-	if err != nil {
-		return fmt.Errorf("server: failed to download JHU states csv:%s", err)
-	}
+// handleQuarantine lists changes from sources held for review, and approves or rejects them
+// POST with action=approve or action=reject and the id of the entry
+// FIXME - require authentication for admin pages
+func handleQuarantine(w http.ResponseWriter, r *http.Request) {
 
-	// This data has a specific format, ask the series to decode
-	// and update the changed series in memory
-	err = series.UpdateFromJHUStatesCases(rows)
-	if err != nil {
-		return fmt.Errorf("server: failed to update from JHU data :%s", err)
+	log.Printf("request:%s", r.URL)
+
+	if r.Method == http.MethodPost {
+		id, err := strconv.Atoi(r.FormValue("id"))
+		if err != nil {
+			http.Error(w, "invalid id", http.StatusBadRequest)
+			return
+		}
+		switch r.FormValue("action") {
+		case "approve":
+			err = series.ApproveQuarantined(id)
+		case "reject":
+			err = series.RejectQuarantined(id)
+		default:
+			http.Error(w, "invalid action", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Printf("quarantine: error:%s", err)
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
 	}
-	return nil
 
-}
+	type entryJSON struct {
+		ID     int    `json:"id"`
+		Time   string `json:"time"`
+		Source string `json:"source"`
+		AreaID int    `json:"area_id"`
+		Area   string `json:"area"`
+		Date   string `json:"date"`
+		Metric string `json:"metric"`
+		Old    int    `json:"old"`
+		New    int    `json:"new"`
+		Reason string `json:"reason"`
+	}
 
-// downloadJSON downloads and parses the url as generic json
-func downloadJSON(url string) (map[string]interface{}, error) {
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, err
+	entries := []entryJSON{}
+	for _, e := range series.Quarantined() {
+		entry := entryJSON{
+			ID:     e.ID,
+			Time:   formatTime(e.Time),
+			Source: e.Source,
+			AreaID: e.AreaID,
+			Date:   e.Date.Format("2006-01-02"),
+			Metric: e.MetricName(),
+			Old:    e.Old,
+			New:    e.New,
+			Reason: e.Reason,
+		}
+		s, err := series.FindSeries(e.AreaID)
+		if err == nil {
+			entry.Area = s.Title()
+		}
+		entries = append(entries, entry)
 	}
-	defer resp.Body.Close()
 
-	jsonData := make(map[string]interface{})
-	err = json.NewDecoder(resp.Body).Decode(&jsonData)
-	return jsonData, err
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(entries)
 }
 
-// downloadCSV downloads and parses the url as csv
-func downloadCSV(url string) ([][]string, error) {
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, err
+// handleJobs shows the status of each scheduled job
+func handleJobs(w http.ResponseWriter, r *http.Request) {
+
+	log.Printf("request:%s", r.URL)
+
+	type jobJSON struct {
+		Name         string `json:"name"`
+		Interval     string `json:"interval"`
+		Running      bool   `json:"running"`
+		Runs         int    `json:"runs"`
+		Failures     int    `json:"failures"`
+		Skipped      int    `json:"skipped"`
+		LastRun      string `json:"last_run"`
+		LastDuration string `json:"last_duration"`
+		LastResult   string `json:"last_result"`
+		NextRun      string `json:"next_run"`
 	}
-	defer resp.Body.Close()
 
-	reader := csv.NewReader(resp.Body)
-	rows, err := reader.ReadAll()
-	if err != nil {
-		return nil, err
+	jobs := []jobJSON{}
+	for _, j := range scheduler.Status() {
+		result := "ok"
+		if j.LastError != "" {
+			result = j.LastError
+		} else if j.LastRun.IsZero() {
+			result = ""
+		}
+		jobs = append(jobs, jobJSON{
+			Name:         j.Name,
+			Interval:     j.Interval.String(),
+			Running:      j.Running,
+			Runs:         j.Runs,
+			Failures:     j.Failures,
+			Skipped:      j.Skipped,
+			LastRun:      formatTime(j.LastRun),
+			LastDuration: j.LastDuration.String(),
+			LastResult:   result,
+			NextRun:      formatTime(j.NextRun),
+		})
 	}
 
-	return rows, nil
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(jobs)
+}
+
+// formatTime formats t for json, or returns an empty string if t is zero
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
 }
 
-// gitPull runs a git pull command
+// repo is the git repository data changes are committed to, commits are pushed if COVID_GIT_PUSH=on
+var repo = &series.GitRepo{Path: ".", Remote: "origin", Push: os.Getenv("COVID_GIT_PUSH") == "on"}
+
+// gitPull pulls changes to the repo, rebasing local commits on them
+// if they conflict the pull is aborted and the repo left unchanged
+// if the pull changed data files the data is reloaded, so that the changes are not overwritten by the next save
 func gitPull() error {
+	changed, err := repo.Pull("data")
+	if err != nil || !changed {
+		return err
+	}
 
-	return nil
+	// The series file pulled replaces ours on purpose, so accept it rather than falling back to a backup
+	// updates since the last save are kept, as the journal is replayed on load
+	log.Printf("update: data changed by pull, reloading")
+	err = series.AcceptFile("./data/series.csv")
+	if err != nil {
+		return err
+	}
+	err = loadCorrections()
+	if err != nil {
+		return err
+	}
+	return series.LoadData("./data")
 }
 
-// gitCommit runs a git commit command
+// gitCommit commits changes to the data dir only, with message
 func gitCommit(message string) error {
-
+	committed, err := repo.Commit(message, "data")
+	if err != nil {
+		return err
+	}
+	if committed {
+		log.Printf("update: committed data changes:%s", strings.SplitN(message, "\n", 2)[0])
+	}
 	return nil
 }
-
-// ScheduleAt schedules execution for a particular time and at intervals thereafter.
-// If interval is 0, the function will be called only once.
-// Callers should call close(task) before exiting the app or to stop repeating the action.
-func ScheduleAt(f func(), t time.Time, i time.Duration) chan struct{} {
-	task := make(chan struct{})
-	now := time.Now().UTC()
-
-	// Check that t is not in the past, if it is increment it by interval until it is not
-	for now.Sub(t) > 0 {
-		t = t.Add(i)
-	}
-
-	// We ignore the timer returned by AfterFunc - so no cancelling, perhaps rethink this
-	tillTime := t.Sub(now)
-	time.AfterFunc(tillTime, func() {
-		// Call f at the time specified
-		go f()
-
-		// If we have an interval, call it again repeatedly after interval
-		// stopping if the caller calls stop(task) on returned channel
-		if i > 0 {
-			ticker := time.NewTicker(i)
-			go func() {
-				for {
-					select {
-					case <-ticker.C:
-						go f()
-					case <-task:
-						ticker.Stop()
-						return
-					}
-				}
-			}()
-		}
-	})
-
-	return task // call close(task) to stop executing the task for repeated tasks
-}